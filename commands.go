@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/constants"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/airdrop"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/audit"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/clients"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/deployer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/export"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/indexer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/server"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// runCommand runs the CLI subcommand named by args[0] and reports whether there was one.
+// Without a subcommand the HTTP server is started.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "export":
+		exportCommand(args[1:])
+	case "deploy":
+		deployCommand(args[1:])
+	case "airdrop":
+		airdropCommand(args[1:])
+	case "auth":
+		authCommand(args[1:])
+	case "audit":
+		auditCommand(args[1:])
+	case "tls":
+		tlsCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		os.Exit(2)
+	}
+	return true
+}
+
+// exportCommand writes indexed events to a file. It opens the embedded store directly,
+// so the server must not be running; use the /export endpoints against a live server.
+func exportCommand(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	token := fs.String("token", "", "token symbol or address, the first configured token when empty")
+	kind := fs.String("kind", export.KindTransfer, "event kind: transfer or approval")
+	format := fs.String("format", export.FormatCSV, "output format: csv or parquet")
+	fromBlock := fs.Uint64("from-block", 0, "first block")
+	toBlock := fs.Uint64("to-block", 0, "last block, 0 for the last indexed block")
+	fromTime := fs.String("from-time", "", "start time, RFC3339")
+	toTime := fs.String("to-time", "", "end time, RFC3339")
+	out := fs.String("out", "", "output file, stdout when empty")
+	fs.Parse(args)
+
+	opts := export.Options{Kind: *kind, Format: *format, FromBlock: *fromBlock, ToBlock: *toBlock}
+	if *fromTime != "" {
+		t, err := time.Parse(time.RFC3339, *fromTime)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.FromTime = uint64(t.Unix())
+	}
+	if *toTime != "" {
+		t, err := time.Parse(time.RFC3339, *toTime)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.ToTime = uint64(t.Unix())
+	}
+	if err := opts.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := store.Open(constants.StorePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	client := clients.GetClient()
+	defer client.Close()
+
+	registry := tokens.NewRegistry(client, db)
+	for _, t := range cfg.Tokens {
+		if err := registry.Register(common.HexToAddress(t.Address), t.Symbol, t.StartBlock); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := registry.LoadStored(); err != nil {
+		log.Fatal(err)
+	}
+	resolved, _, err := registry.Resolve(*token)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	idx, err := indexer.New(client, db, resolved.Address)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := export.Write(w, idx, opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// deployCommand deploys a new token with the configured signer and adds it to the config file,
+// so it is indexed and served the next time the server starts.
+func deployCommand(args []string) {
+	fs := flag.NewFlagSet("deploy", flag.ExitOnError)
+	symbol := fs.String("symbol", "", "symbol to register the token under, the on-chain symbol when empty")
+	bin := fs.String("bin", "", "file with the hex creation bytecode, the MyContract bindings' when empty")
+	timeout := fs.Duration("timeout", 5*time.Minute, "how long to wait for the deployment to be mined")
+	fs.Parse(args)
+
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		log.Fatal(err)
+	}
+	privateKey, err := crypto.HexToECDSA(constants.PrivateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := clients.GetClient()
+	defer client.Close()
+
+	d := deployer.New(client, signer.New(client, privateKey))
+	d.Timeout, d.BinPath = *timeout, *bin
+	res, err := d.Deploy(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := registerDeployment(cfg, nil, res, *symbol); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("deployed %s in block %d (tx %s)\n", res.Address.Hex(), res.Block, res.TxHash.Hex())
+}
+
+// registerDeployment adds a deployed token to the config file and, when the server is running, the registry.
+func registerDeployment(cfg *config.Config, registry *tokens.Registry, res *deployer.Result, symbol string) error {
+	err := cfg.AddToken(config.Token{Symbol: symbol, Address: res.Address.Hex(), StartBlock: res.Block})
+	if err != nil {
+		return err
+	}
+	if registry == nil {
+		return nil
+	}
+	return registry.Register(res.Address, symbol, res.Block)
+}
+
+// airdropCommand pays every address of a CSV file once. Progress is journaled next to the
+// file, so running the same command again after an interruption resumes without paying twice.
+// It signs with the server's key, so it opens the store like export to make sure the server
+// isn't running and handing out the same nonces; the store also gives it the spending limits,
+// the recipient policy and the audit log that every transfer of the server goes through.
+func airdropCommand(args []string) {
+	fs := flag.NewFlagSet("airdrop", flag.ExitOnError)
+	token := fs.String("token", "", "token symbol or address, the first configured token when empty")
+	progressPath := fs.String("progress", "", "progress journal, <file>.progress.jsonl when empty")
+	reportPath := fs.String("report", "", "result report, <file>.report.csv when empty")
+	dryRun := fs.Bool("dry-run", false, "validate the file and print the totals without sending")
+	timeout := fs.Duration("timeout", 10*time.Minute, "how long to wait for receipts")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: airdrop [flags] recipients.csv")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	if *progressPath == "" {
+		*progressPath = path + ".progress.jsonl"
+	}
+	if *reportPath == "" {
+		*reportPath = path + ".report.csv"
+	}
+
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		log.Fatal(err)
+	}
+	privateKey, err := crypto.HexToECDSA(constants.PrivateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := store.Open(constants.StorePath)
+	if err != nil {
+		log.Fatalf("open store: %v (stop the server first, the airdrop signs with its key)", err)
+	}
+	defer db.Close()
+
+	client := clients.GetClient()
+	defer client.Close()
+
+	registry := tokens.NewRegistry(client, db)
+	for _, t := range cfg.Tokens {
+		if err := registry.Register(common.HexToAddress(t.Address), t.Symbol, t.StartBlock); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := registry.LoadStored(); err != nil {
+		log.Fatal(err)
+	}
+	if common.IsHexAddress(*token) {
+		if err := registry.Register(common.HexToAddress(*token), "", 0); err != nil && !errors.Is(err, tokens.ErrExists) {
+			log.Fatal(err)
+		}
+	}
+	resolved, instance, err := registry.Resolve(*token)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rows, problems, err := airdrop.ReadCSV(f, resolved.Decimals)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", p.Line, p.Reason)
+	}
+
+	journal, err := airdrop.OpenJournal(*progressPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer journal.Close()
+
+	auditLog, err := audit.New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	recipientPolicy, err := policy.New(client, db, cfg.Policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	txSigner := signer.New(client, privateKey)
+	txSigner.OnSent(auditLog.Transaction)
+	asset := auth.Asset{Symbol: resolved.Symbol, Address: resolved.Address, Decimals: resolved.Decimals}
+	runner := airdrop.NewRunner(client, txSigner, asset, instance, journal, limits.New(db, registry, cfg.Limits), recipientPolicy)
+	runner.Timeout = *timeout
+
+	todo, total := runner.Remaining(rows)
+	balance, err := instance.BalanceOf(nil, txSigner.Address())
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d recipients, %d skipped, %d left to pay: %s %s (balance %s)\n",
+		len(rows), len(problems), len(todo), units.FormatAmount(total, resolved.Decimals), resolved.Symbol,
+		units.FormatAmount(balance, resolved.Decimals))
+	if balance.Cmp(total) < 0 {
+		log.Fatal("insufficient token balance")
+	}
+	if *dryRun {
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	runErr := runner.Run(ctx, rows, func(done, count int) {
+		if done%100 == 0 || done == count {
+			fmt.Printf("sent %d/%d\n", done, count)
+		}
+	})
+
+	report, err := os.Create(*reportPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer report.Close()
+	if err := runner.WriteReport(report, rows, problems, resolved.Decimals); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("report written to %s\n", *reportPath)
+	if runErr != nil {
+		log.Fatalf("airdrop stopped: %v; run the same command again to resume", runErr)
+	}
+}
+
+// authCommand manages API keys in the store, mainly to create the first admin key before
+// authentication is enabled. Like export it opens the store directly, so the server must
+// not be running.
+//
+//	auth create-key -name ops -role admin
+//	auth revoke-key <id>
+func authCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: auth create-key|revoke-key ...")
+		os.Exit(2)
+	}
+
+	var run func(keys *auth.Keys)
+	switch args[0] {
+	case "create-key":
+		fs := flag.NewFlagSet("auth create-key", flag.ExitOnError)
+		name := fs.String("name", "", "name of the key")
+		role := fs.String("role", string(auth.RoleReader), "reader, operator or admin")
+		tokenList := fs.String("tokens", "", "comma separated symbols or addresses the key may transfer, \"ETH\" for native; any when empty")
+		maxAmount := fs.String("max-amount", "", "largest single transfer in raw units (wei for ETH), unlimited when empty")
+		fs.Parse(args[1:])
+		if *maxAmount != "" {
+			if _, err := units.ParseAmount(*maxAmount, 0); err != nil {
+				log.Fatalf("invalid -max-amount %q", *maxAmount)
+			}
+		}
+		var allowed []string
+		for _, t := range strings.Split(*tokenList, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				allowed = append(allowed, t)
+			}
+		}
+		run = func(keys *auth.Keys) {
+			key, secret, err := keys.Create(auth.Key{Name: *name, Role: auth.Role(*role), Tokens: allowed, MaxAmount: *maxAmount})
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Fprintf(os.Stderr, "created %s key %s (%s), the key is not shown again:\n", key.Role, key.ID, key.Name)
+			fmt.Println(secret)
+			if signing, err := keys.SigningSecret(key); err == nil {
+				fmt.Fprintln(os.Stderr, "signing secret, for HMAC-signed requests:")
+				fmt.Println(signing)
+			}
+		}
+	case "revoke-key":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: auth revoke-key <id>")
+			os.Exit(2)
+		}
+		run = func(keys *auth.Keys) {
+			if _, err := keys.Revoke(args[1]); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Fprintf(os.Stderr, "revoked key %s\n", args[1])
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown auth command %q\n", args[0])
+		os.Exit(2)
+	}
+
+	db, err := store.Open(constants.StorePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		log.Fatal(err)
+	}
+	run(auth.NewKeys(db, cfg.Auth.SigningPepper))
+}
+
+// auditCommand re-walks the audit log hash chain and exits with status 1 when it is broken.
+//
+//	audit verify
+func auditCommand(args []string) {
+	if len(args) != 1 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: audit verify")
+		os.Exit(2)
+	}
+
+	db, err := store.Open(constants.StorePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	auditLog, err := audit.New(db)
+	if err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+	v, err := auditLog.Verify()
+	db.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !v.OK {
+		fmt.Fprintf(os.Stderr, "audit chain broken after %d records: %s\n", v.Records, v.Error)
+		os.Exit(1)
+	}
+	fmt.Printf("%d records verified, head %d %s\n", v.Records, v.HeadSeq, v.HeadHash)
+}
+
+// tlsCommand generates a local CA with server and client certificates for trying TLS and
+// mutual TLS; see the server.tls and auth.client_certs config.
+//
+//	tls gen-certs [-dir certs] [-hosts localhost,127.0.0.1] [-clients name,...]
+func tlsCommand(args []string) {
+	if len(args) == 0 || args[0] != "gen-certs" {
+		fmt.Fprintln(os.Stderr, "usage: tls gen-certs [-dir certs] [-hosts localhost,127.0.0.1] [-clients name,...]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("tls gen-certs", flag.ExitOnError)
+	dir := fs.String("dir", "certs", "directory to write the certificates to")
+	hosts := fs.String("hosts", "localhost,127.0.0.1", "comma separated names and IPs of the server certificate")
+	clients := fs.String("clients", "", "comma separated common names to issue client certificates for")
+	fs.Parse(args[1:])
+
+	split := func(s string) []string {
+		var out []string
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+		return out
+	}
+	written, err := server.GenerateCerts(*dir, split(*hosts), split(*clients))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, path := range written {
+		fmt.Println(path)
+	}
+}
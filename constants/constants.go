@@ -3,4 +3,8 @@ package constants
 const (
 	ContractAddress = "0x999728D0A3Bc5b05F90Cb8647Ac83F0532658459"
 	PrivateKey      = "b8a5af23f2da900b0350ef3e0ff2307e82fa17f76e8db4a207663300c68ba71d" // example private key
+
+	ConfigPath      = "config.json" // overridden by the CONFIG_PATH environment variable
+	StorePath       = "data"        // embedded store directory
+	IndexStartBlock = 0             // first block scanned by the event indexer
 )
@@ -0,0 +1,239 @@
+package contract
+
+import (
+	"crypto/ecdsa"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"testing"
+)
+
+type account struct {
+	addr common.Address
+	opts *bind.TransactOpts
+}
+
+type testToken struct {
+	backend *backends.SimulatedBackend
+	*MyContract
+	owner, spender account
+}
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func newAccount(t *testing.T) (account, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account{addr: crypto.PubkeyToAddress(key.PublicKey), opts: opts}, key
+}
+
+// deploy deploys the embedded bytecode with DeployMyContract on a simulated chain.
+func deploy(t *testing.T) *testToken {
+	t.Helper()
+	owner, _ := newAccount(t)
+	spender, _ := newAccount(t)
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		owner.addr:   {Balance: ether(10)},
+		spender.addr: {Balance: ether(10)},
+	}, 10000000)
+	t.Cleanup(func() { backend.Close() })
+	_, _, instance, err := DeployMyContract(owner.opts, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+	return &testToken{backend: backend, MyContract: instance, owner: owner, spender: spender}
+}
+
+// send makes a transaction and mines it; it fails the test if the transaction can't be made.
+func (tt *testToken) send(t *testing.T, name string, tx func() error) {
+	t.Helper()
+	if err := tx(); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	tt.backend.Commit()
+}
+
+// refused checks that a transaction reverts, which the simulated backend reports when
+// estimating its gas.
+func (tt *testToken) refused(t *testing.T, name string, tx func() error) {
+	t.Helper()
+	if err := tx(); err == nil {
+		t.Errorf("%s: transaction was accepted, want a revert", name)
+	}
+	tt.backend.Rollback()
+}
+
+func (tt *testToken) balance(t *testing.T, a common.Address) *big.Int {
+	t.Helper()
+	b, err := tt.BalanceOf(nil, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func (tt *testToken) allowance(t *testing.T, owner, spender common.Address) *big.Int {
+	t.Helper()
+	a, err := tt.Allowance(nil, owner, spender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestMetadata(t *testing.T) {
+	tt := deploy(t)
+	name, err := tt.Name(nil)
+	if err != nil || name != "MyContract" {
+		t.Errorf("name = %q, %v", name, err)
+	}
+	symbol, err := tt.Symbol(nil)
+	if err != nil || symbol != "MCT" {
+		t.Errorf("symbol = %q, %v", symbol, err)
+	}
+	decimals, err := tt.Decimals(nil)
+	if err != nil || decimals != 18 {
+		t.Errorf("decimals = %d, %v", decimals, err)
+	}
+	supply, err := tt.TotalSupply(nil)
+	if err != nil || supply.Cmp(ether(1000000)) != 0 {
+		t.Errorf("total supply = %v, %v; want 1000000 tokens", supply, err)
+	}
+	if b := tt.balance(t, tt.owner.addr); b.Cmp(supply) != 0 {
+		t.Errorf("deployer holds %s, want the whole supply", b)
+	}
+
+	// the mint is logged as a transfer from the zero address
+	it, err := tt.FilterTransfer(&bind.FilterOpts{Start: 0}, []common.Address{{}}, []common.Address{tt.owner.addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if !it.Next() || it.Event.Value.Cmp(supply) != 0 {
+		t.Errorf("no Transfer event for the mint: %v", it.Error())
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	tt := deploy(t)
+	to := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	supply := tt.balance(t, tt.owner.addr)
+
+	tt.send(t, "transfer", func() error {
+		_, err := tt.MyContract.Transfer(tt.owner.opts, to, ether(5))
+		return err
+	})
+	if b := tt.balance(t, to); b.Cmp(ether(5)) != 0 {
+		t.Errorf("recipient balance = %s, want 5 tokens", b)
+	}
+	if b := tt.balance(t, tt.owner.addr); b.Cmp(new(big.Int).Sub(supply, ether(5))) != 0 {
+		t.Errorf("sender balance = %s", b)
+	}
+
+	head := tt.backend.Blockchain().CurrentBlock().NumberU64()
+	it, err := tt.FilterTransfer(&bind.FilterOpts{Start: head, End: &head}, []common.Address{tt.owner.addr}, []common.Address{to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if !it.Next() || it.Event.Value.Cmp(ether(5)) != 0 || it.Next() {
+		t.Errorf("want one Transfer event of 5 tokens: %v", it.Error())
+	}
+
+	tt.refused(t, "transfer above the balance", func() error {
+		_, err := tt.MyContract.Transfer(tt.spender.opts, to, big.NewInt(1))
+		return err
+	})
+	tt.refused(t, "transfer to the zero address", func() error {
+		_, err := tt.MyContract.Transfer(tt.owner.opts, common.Address{}, big.NewInt(1))
+		return err
+	})
+}
+
+func TestAllowances(t *testing.T) {
+	tt := deploy(t)
+	owner, spender := tt.owner.addr, tt.spender.addr
+	to := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+
+	tt.send(t, "approve", func() error {
+		_, err := tt.Approve(tt.owner.opts, spender, ether(10))
+		return err
+	})
+	if a := tt.allowance(t, owner, spender); a.Cmp(ether(10)) != 0 {
+		t.Fatalf("allowance = %s, want 10 tokens", a)
+	}
+	head := tt.backend.Blockchain().CurrentBlock().NumberU64()
+	it, err := tt.FilterApproval(&bind.FilterOpts{Start: head, End: &head}, []common.Address{owner}, []common.Address{spender})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() || it.Event.Value.Cmp(ether(10)) != 0 {
+		t.Errorf("no Approval event for 10 tokens: %v", it.Error())
+	}
+	it.Close()
+
+	tt.send(t, "transferFrom", func() error {
+		_, err := tt.TransferFrom(tt.spender.opts, owner, to, ether(4))
+		return err
+	})
+	if b := tt.balance(t, to); b.Cmp(ether(4)) != 0 {
+		t.Errorf("recipient balance = %s, want 4 tokens", b)
+	}
+	if a := tt.allowance(t, owner, spender); a.Cmp(ether(6)) != 0 {
+		t.Errorf("allowance after transferFrom = %s, want 6 tokens", a)
+	}
+	tt.refused(t, "transferFrom above the allowance", func() error {
+		_, err := tt.TransferFrom(tt.spender.opts, owner, to, ether(7))
+		return err
+	})
+
+	tt.send(t, "increaseAllowance", func() error {
+		_, err := tt.IncreaseAllowance(tt.owner.opts, spender, ether(3))
+		return err
+	})
+	if a := tt.allowance(t, owner, spender); a.Cmp(ether(9)) != 0 {
+		t.Errorf("allowance after increaseAllowance = %s, want 9 tokens", a)
+	}
+	tt.send(t, "decreaseAllowance", func() error {
+		_, err := tt.DecreaseAllowance(tt.owner.opts, spender, ether(2))
+		return err
+	})
+	if a := tt.allowance(t, owner, spender); a.Cmp(ether(7)) != 0 {
+		t.Errorf("allowance after decreaseAllowance = %s, want 7 tokens", a)
+	}
+	tt.refused(t, "decreaseAllowance below zero", func() error {
+		_, err := tt.DecreaseAllowance(tt.owner.opts, spender, ether(8))
+		return err
+	})
+	tt.refused(t, "increaseAllowance past 2^256-1", func() error {
+		_, err := tt.IncreaseAllowance(tt.owner.opts, spender, math.MaxBig256)
+		return err
+	})
+
+	// an unlimited allowance is not spent down
+	tt.send(t, "approve unlimited", func() error {
+		_, err := tt.Approve(tt.owner.opts, spender, math.MaxBig256)
+		return err
+	})
+	tt.send(t, "transferFrom with an unlimited allowance", func() error {
+		_, err := tt.TransferFrom(tt.spender.opts, owner, to, ether(1))
+		return err
+	})
+	if a := tt.allowance(t, owner, spender); a.Cmp(math.MaxBig256) != 0 {
+		t.Errorf("unlimited allowance became %s", a)
+	}
+}
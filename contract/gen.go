@@ -0,0 +1,6 @@
+package contract
+
+// MyContract.easm is the token in EVM assembly and MyContract.bin its creation bytecode,
+// built with the evm tool of go-ethereum; the bindings embed it to deploy new tokens.
+//go:generate sh -c "evm compile MyContract.easm > MyContract.bin"
+//go:generate abigen --abi MyContract.abi --bin MyContract.bin --pkg contract --type MyContract --out contract.go
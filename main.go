@@ -2,26 +2,170 @@ package main
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"fmt"
 	"github.com/SeogyuGim/eth-testnet-smartcontract/constants"
-	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/approval"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/audit"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
 	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/clients"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/deployer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/ether"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/export"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/faucet"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/gateway"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/holders"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/indexer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/monitor"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/multicall"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/payout"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/ratelimit"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/scheduler"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/server"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/stream"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/webhook"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"log"
 	"math/big"
 	"net/http"
+	"os"
+	"time"
 )
 
 func main() {
 
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := store.Open(constants.StorePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	clients.LimitInFlight(cfg.RateLimits.MaxRPCInFlight)
+	client := clients.GetClient()
+	registry := tokens.NewRegistry(client, db)
+	pool := indexer.NewPool(client, db, registry)
+	registry.OnAdd(func(t tokens.Token) {
+		pool.Start(context.Background(), t)
+	})
+	registry.OnRemove(pool.Stop)
+	for _, t := range cfg.Tokens {
+		if err := registry.Register(common.HexToAddress(t.Address), t.Symbol, t.StartBlock); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := registry.LoadStored(); err != nil {
+		log.Fatal(err)
+	}
+
+	holderService := holders.New(pool, registry)
+
+	var aggregator *common.Address
+	if cfg.Multicall != "" {
+		addr := common.HexToAddress(cfg.Multicall)
+		aggregator = &addr
+	}
+	balances := multicall.New(client, clients.GetRPCClient(), aggregator)
+
+	defaultToken, _, err := registry.Default()
+	if err != nil {
+		log.Fatal(err)
+	}
+	hub, err := stream.NewHub(clients.GetWSClient(), defaultToken.Address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go hub.Run(context.Background())
+
+	privateKey, err := crypto.HexToECDSA(constants.PrivateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	auditLog, err := audit.New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	txSigner := signer.New(client, privateKey)
+	txSigner.OnSent(auditLog.Transaction)
+	spendLimits := limits.New(db, registry, cfg.Limits)
+	approvals := approval.New(db, cfg.Approvals)
+	go approvals.Run(context.Background(), time.Minute)
+	recipientPolicy, err := policy.New(client, db, cfg.Policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	contractGateway := gateway.New(client, db, txSigner, spendLimits, registry, recipientPolicy, approvals)
+	approvals.Handle(gateway.ApprovalKind, contractGateway.ExecuteApproved)
+	tokenDeployer := deployer.New(client, txSigner)
+	payouts := payout.New(client, db, txSigner, spendLimits, recipientPolicy, approvals)
+	if err := payouts.Recover(); err != nil {
+		log.Fatal(err)
+	}
+	approvals.Handle(payout.ApprovalKind, payouts.ExecuteApproved(registry))
+	apiKeys := auth.NewKeys(db, cfg.Auth.SigningPepper)
+	paymentScheduler := scheduler.New(client, db, registry, txSigner, spendLimits, recipientPolicy, apiKeys, approvals)
+	approvals.Handle(scheduler.ApprovalKind, paymentScheduler.ExecuteApproved)
+	go paymentScheduler.Run(context.Background())
+	ethService := ether.New(client, txSigner, spendLimits, recipientPolicy, approvals)
+	approvals.Handle(ether.ApprovalKind, ethService.ExecuteApproved)
+	tokenFaucet := faucet.New(client, db, registry, txSigner, cfg.Faucet, recipientPolicy, spendLimits)
+
+	walletMonitor := monitor.New(client, registry, txSigner, cfg.Monitor)
+	if cfg.Monitor.Enabled {
+		go walletMonitor.Run(context.Background())
+	}
+
+	authenticator := auth.New(apiKeys, cfg.Auth)
+	rateLimiter := ratelimit.New(cfg.RateLimits)
+
+	dispatcher := webhook.NewDispatcher(db, hub, nil)
+	go dispatcher.Run(context.Background())
+
+	// requestApproval submits a legacy transfer that needs sign-off as a batch of one and
+	// answers 202; it reports whether the transfer may go out now.
+	requestApproval := func(w http.ResponseWriter, r *http.Request, token *tokens.Token, to common.Address, amount *big.Int) bool {
+		asset := auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}
+		rule, err := approvals.Required(asset, amount)
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return false
+		}
+		if rule == nil {
+			return true
+		}
+		req, err := payouts.RequestApproval(r.Context(), rule, token, []payout.Transfer{{To: to, Amount: amount}})
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return false
+		}
+		w.Header().Set("Location", "/approvals/"+req.ID)
+		api.WriteJSON(w, http.StatusAccepted, req)
+		return false
+	}
+
+	mux := router.New()
+
 	// get health status
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	mux.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte("OK"))
 		if err != nil {
 			w.WriteHeader(500)
@@ -31,19 +175,14 @@ func main() {
 	})
 
 	// get chain id
-	http.HandleFunc("/chain", func(w http.ResponseWriter, r *http.Request) {
-		client := clients.GetClient()
-		defer client.Close()
+	mux.Get("/chain", func(w http.ResponseWriter, r *http.Request) {
 		cid, _ := client.ChainID(context.Background())
 		w.Write([]byte(cid.String()))
 	})
 
 	// call contract
-	http.HandleFunc("/contract", func(w http.ResponseWriter, r *http.Request) {
-		client := clients.GetClient()
-		defer client.Close()
-		address := common.HexToAddress(constants.ContractAddress)
-		instance, _ := contract.NewMyContractCaller(address, client)
+	mux.Get("/contract", func(w http.ResponseWriter, r *http.Request) {
+		_, instance, _ := registry.Resolve(r.URL.Query().Get("token"))
 		if instance != nil {
 			w.Write([]byte("success"))
 		} else {
@@ -52,132 +191,271 @@ func main() {
 	})
 
 	// call contract method name
-	http.HandleFunc("/contract/name", func(w http.ResponseWriter, r *http.Request) {
-		client := clients.GetClient()
-		defer client.Close()
-		address := common.HexToAddress(constants.ContractAddress)
-		instance, _ := contract.NewMyContractCaller(address, client)
-		name, err := instance.Name(nil)
+	mux.Get("/contract/name", func(w http.ResponseWriter, r *http.Request) {
+		token, _, err := registry.Resolve(r.URL.Query().Get("token"))
 		if err != nil {
-			log.Fatal(err)
+			api.WriteError(w, tokens.HTTPStatus(err), err)
+			return
 		}
-		w.Write([]byte(name))
-		w.WriteHeader(200)
+		w.Write([]byte(token.Name))
 	})
 
-	// call contract method transfer
-	http.HandleFunc("/contract/transfer", func(w http.ResponseWriter, r *http.Request) {
-		client := clients.GetClient()
-		defer client.Close()
-		privateKey, err := crypto.HexToECDSA(constants.PrivateKey)
+	// call contract method transfer, amount in the token's units
+	mux.Post("/contract/transfer", func(w http.ResponseWriter, r *http.Request) {
+		toAddr, err := api.Address("to_address", r.URL.Query().Get("to_address"))
 		if err != nil {
-			log.Fatal(err)
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
 		}
-
-		toAddr := common.HexToAddress(r.URL.Query().Get("to_address"))
-
-		amount := new(big.Int)
-		chainId, _ := client.ChainID(context.Background())
-
-		cont, err := contract.NewMyContract(common.HexToAddress(constants.ContractAddress), client)
+		token, cont, err := registry.Resolve(r.URL.Query().Get("token"))
 		if err != nil {
-			log.Fatal(err)
+			api.WriteError(w, tokens.HTTPStatus(err), err)
+			return
 		}
-
-		opts, err := bind.NewKeyedTransactorWithChainID(privateKey, chainId)
+		amount, err := api.Amount("amount", r.URL.Query().Get("amount"), token.Decimals)
 		if err != nil {
-			log.Fatal(err)
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		asset := auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}
+		if err := auth.Authorize(r.Context(), asset, amount); err != nil {
+			api.WriteError(w, auth.HTTPStatus(err), err)
+			return
+		}
+		if err := recipientPolicy.Check(r.Context(), toAddr, &token.Address, "contract transfer"); err != nil {
+			api.WriteError(w, policy.HTTPStatus(err), err)
+			return
+		}
+		if !requestApproval(w, r, token, toAddr, amount) {
+			return
+		}
+		spent, err := spendLimits.Spend(r.Context(), asset, []*big.Int{amount}, "contract transfer")
+		if err != nil {
+			api.WriteError(w, limits.HTTPStatus(err), err)
+			return
 		}
 
-		transfer, err := cont.Transfer(opts, toAddr, amount)
+		transfer, err := txSigner.Transact(context.Background(), func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return cont.Transfer(opts, toAddr, amount)
+		})
 		if err != nil {
-			log.Fatal(err)
+			if releaseErr := spendLimits.Release(spent); releaseErr != nil {
+				log.Printf("contract transfer: release spend: %v", releaseErr)
+			}
+			api.WriteError(w, http.StatusBadGateway, err)
+			return
 		}
 		w.Write(transfer.Hash().Bytes())
 	})
 
-	// call raw transaction
-	http.HandleFunc("/transfer", func(w http.ResponseWriter, r *http.Request) {
-		client := clients.GetClient()
-		defer client.Close()
-
-		privateKey, err := crypto.HexToECDSA(constants.PrivateKey)
+	// call raw transaction, amount in the token's units
+	mux.Post("/transfer", func(w http.ResponseWriter, r *http.Request) {
+		toAddr, err := api.Address("to_address", r.URL.Query().Get("to_address"))
 		if err != nil {
-			log.Fatal(err)
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
 		}
-
-		pubKey := privateKey.Public()
-		pubKeyECDSA, ok := pubKey.(*ecdsa.PublicKey)
-		if !ok {
-			log.Fatal("Error occurred while casting public key to ECDSA")
+		token, _, err := registry.Resolve(r.URL.Query().Get("token"))
+		if err != nil {
+			api.WriteError(w, tokens.HTTPStatus(err), err)
+			return
 		}
-
-		fromAddr := crypto.PubkeyToAddress(*pubKeyECDSA)
-		nonce, err := client.PendingNonceAt(context.Background(), fromAddr)
+		tokenAddr := token.Address
+		amount, err := api.Amount("amount", r.URL.Query().Get("amount"), token.Decimals)
 		if err != nil {
-			log.Fatal(err)
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
 		}
-
-		balance, _ := client.BalanceAt(context.Background(), fromAddr, nil)
-		fmt.Printf("FromAddress balance: %s", balance.String())
-
-		value := big.NewInt(0)
-		gasPrice, err := client.SuggestGasPrice(context.Background())
+		asset := auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}
+		if err := auth.Authorize(r.Context(), asset, amount); err != nil {
+			api.WriteError(w, auth.HTTPStatus(err), err)
+			return
+		}
+		if err := recipientPolicy.Check(r.Context(), toAddr, &token.Address, "transfer"); err != nil {
+			api.WriteError(w, policy.HTTPStatus(err), err)
+			return
+		}
+		if !requestApproval(w, r, token, toAddr, amount) {
+			return
+		}
+		spent, err := spendLimits.Spend(r.Context(), asset, []*big.Int{amount}, "transfer")
 		if err != nil {
-			log.Fatal(err)
+			api.WriteError(w, limits.HTTPStatus(err), err)
+			return
+		}
+		// fail gives the spend back when the transfer doesn't go out
+		fail := func(err error) {
+			if releaseErr := spendLimits.Release(spent); releaseErr != nil {
+				log.Printf("transfer: release spend: %v", releaseErr)
+			}
+			api.WriteError(w, http.StatusBadGateway, err)
 		}
-
-		toAddr := common.HexToAddress(r.URL.Query().Get("to_address"))
-		tokenAddr := common.HexToAddress(constants.ContractAddress)
 
 		transferFnSig := []byte("transfer(address,uint256)")
 		hash := crypto.NewKeccakState()
 		hash.Write(transferFnSig)
 		methodID := hash.Sum(nil)[:4]
-		fmt.Printf("Method ID: %s\n", hexutil.Encode(methodID))
-
-		paddedAddr := common.LeftPadBytes(toAddr.Bytes(), 32)
-
-		amount := new(big.Int)
-		amount.SetString("10", 10)
-		paddedAmount := common.LeftPadBytes(amount.Bytes(), 32)
 
 		var data []byte
 		data = append(data, methodID...)
-		data = append(data, paddedAddr...)
-		data = append(data, paddedAmount...)
+		data = append(data, common.LeftPadBytes(toAddr.Bytes(), 32)...)
+		data = append(data, common.LeftPadBytes(amount.Bytes(), 32)...)
 
+		gasPrice, err := client.SuggestGasPrice(context.Background())
+		if err != nil {
+			fail(err)
+			return
+		}
 		gasLimit, err := client.EstimateGas(context.Background(), ethereum.CallMsg{
-			To:   &toAddr,
+			From: txSigner.Address(),
+			To:   &tokenAddr,
 			Data: data,
 		})
 		if err != nil {
-			log.Fatal(err)
+			fail(err)
+			return
 		}
 
-		chainId, err := client.ChainID(context.Background())
+		nonce, err := txSigner.Reserve(context.Background(), 1)
 		if err != nil {
-			log.Fatal(err)
+			fail(err)
+			return
 		}
-
-		tx := types.NewTransaction(nonce, tokenAddr, value, gasLimit, gasPrice, data)
-		signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainId), privateKey)
+		// abandon gives the nonce back when nothing was sent with it
+		abandon := func(err error) {
+			if abandonErr := txSigner.Abandon(context.Background(), nonce); abandonErr != nil {
+				log.Printf("transfer: abandon nonce %d: %v", nonce, abandonErr)
+			}
+			fail(err)
+		}
+		tx := types.NewTransaction(nonce, tokenAddr, new(big.Int), gasLimit, gasPrice, data)
+		signedTx, err := txSigner.SignTx(context.Background(), tx)
 		if err != nil {
-			log.Fatal(err)
+			abandon(err)
+			return
 		}
 
 		err = client.SendTransaction(context.Background(), signedTx)
 		if err != nil {
-			log.Fatal(err)
+			abandon(err)
+			return
 		}
+		txSigner.Sent(r.Context(), signedTx)
 
 		w.Write(signedTx.Hash().Bytes())
 	})
 
-	err := http.ListenAndServe(":8080", nil)
+	// send many transfers at once and poll their status
+	mux.Post("/contract/transfers/batch", payouts.CreateHandler(registry))
+	mux.Get("/contract/transfers/batch/{id}", payouts.GetHandler)
+
+	// send native ETH from the service wallet and read balances
+	mux.Post("/eth/transfer", ethService.TransferHandler)
+	mux.Get("/eth/balance/{address}", ethService.BalanceHandler)
+
+	// list, approve and reject transfers waiting for sign-off
+	mux.Get("/approvals", approvals.ListHandler)
+	mux.Get("/approvals/{id}", approvals.GetHandler)
+	mux.Post("/approvals/{id}/approve", approvals.ApproveHandler)
+	mux.Post("/approvals/{id}/reject", approvals.RejectHandler)
+	mux.Post("/approvals/{id}/cancel", approvals.CancelHandler)
+
+	// manage recipient allow and deny lists, and see rejected transfers
+	mux.Get("/policy/violations", recipientPolicy.ViolationsHandler)
+	mux.Get("/policy/{list}", recipientPolicy.ListHandler)
+	mux.Post("/policy/{list}", recipientPolicy.AddHandler)
+	mux.Delete("/policy/{list}/{address}", recipientPolicy.RemoveHandler)
+
+	// spending caps of the caller and what is left of them
+	mux.Get("/limits", spendLimits.Handler)
+
+	// hot wallet balances against the monitor thresholds
+	mux.Get("/monitor", walletMonitor.StatusHandler)
+	mux.Get("/metrics", walletMonitor.MetricsHandler)
+
+	// dispense test tokens and ETH, rate limited per address and IP
+	if cfg.Faucet.Enabled {
+		mux.Post("/faucet", tokenFaucet.ClaimHandler)
+		mux.Get("/faucet/claims", tokenFaucet.ClaimsHandler)
+	}
+
+	// manage recurring token payments
+	mux.Get("/schedules", paymentScheduler.ListHandler)
+	mux.Post("/schedules", paymentScheduler.CreateHandler)
+	mux.Get("/schedules/{id}", paymentScheduler.GetHandler)
+	mux.Delete("/schedules/{id}", paymentScheduler.DeleteHandler)
+	mux.Post("/schedules/{id}/pause", paymentScheduler.PauseHandler)
+	mux.Post("/schedules/{id}/resume", paymentScheduler.ResumeHandler)
+	mux.Get("/schedules/{id}/executions", paymentScheduler.ExecutionsHandler)
+
+	// get transfer history of the contract
+	mux.Get("/contract/transfers", pool.ContractTransfersHandler)
+
+	// get transfer history of an account
+	mux.Get("/accounts/{address}/transfers", pool.AccountTransfersHandler)
+
+	// get ranked holder balances at a block
+	mux.Get("/contract/holders", holderService.HoldersHandler)
+
+	// get many token, allowance and ETH balances at once
+	mux.Post("/contract/balances", balances.BalancesHandler(registry))
+
+	// export indexed events as CSV or Parquet
+	mux.Get("/export/transfers", export.Handler(pool, export.KindTransfer))
+	mux.Get("/export/approvals", export.Handler(pool, export.KindApproval))
+
+	// manage the token registry
+	mux.Get("/tokens", registry.ListHandler)
+	mux.Post("/tokens", registry.AddHandler)
+	mux.Get("/tokens/{id}", registry.GetHandler)
+	mux.Delete("/tokens/{id}", registry.RemoveHandler)
+
+	// deploy a new token and register it
+	mux.Post("/deploy", tokenDeployer.Handler(func(res *deployer.Result, symbol string) error {
+		return registerDeployment(cfg, registry, res, symbol)
+	}))
+
+	// call or transact any registered contract through its ABI
+	mux.Get("/contracts", contractGateway.ListHandler)
+	mux.Post("/contracts", contractGateway.RegisterHandler)
+	mux.Get("/contracts/{name}", contractGateway.GetHandler)
+	mux.Delete("/contracts/{name}", contractGateway.DeleteHandler)
+	mux.Post("/contracts/{name}/call/{method}", contractGateway.CallHandler)
+	mux.Post("/contracts/{name}/transact/{method}", contractGateway.TransactHandler)
+
+	// stream live transfer events (SSE or WebSocket)
+	mux.Get("/stream/transfers", hub.TransfersHandler)
+
+	// stream live approval events (SSE or WebSocket)
+	mux.Get("/stream/approvals", hub.ApprovalsHandler)
+
+	// manage webhook subscriptions and deliveries
+	mux.Get("/webhooks", dispatcher.ListHandler)
+	mux.Post("/webhooks", dispatcher.CreateHandler)
+	mux.Get("/webhooks/dead-letters", dispatcher.DeadLettersHandler)
+	mux.Get("/webhooks/{id}", dispatcher.GetHandler)
+	mux.Delete("/webhooks/{id}", dispatcher.DeleteHandler)
+	mux.Get("/webhooks/{id}/deliveries", dispatcher.DeliveriesHandler)
+	mux.Post("/webhooks/deliveries/{id}/replay", dispatcher.ReplayHandler)
+
+	// query and verify the audit log of write requests
+	mux.Get("/audit", auditLog.QueryHandler)
+	mux.Get("/audit/verify", auditLog.VerifyHandler)
+	mux.Get("/audit/{seq}", auditLog.GetHandler)
+
+	// manage API keys and issue bearer tokens
+	mux.Get("/auth/whoami", authenticator.WhoamiHandler)
+	mux.Post("/auth/token", authenticator.TokenHandler)
+	mux.Get("/auth/keys", authenticator.ListKeysHandler)
+	mux.Post("/auth/keys", authenticator.CreateKeyHandler)
+	mux.Get("/auth/keys/{id}", authenticator.GetKeyHandler)
+	mux.Delete("/auth/keys/{id}", authenticator.RevokeKeyHandler)
+	mux.Post("/auth/keys/{id}/rotate", authenticator.RotateKeyHandler)
+
+	err = server.ListenAndServe(context.Background(), cfg.Server, rateLimiter.ByIP(authenticator.Middleware(rateLimiter.ByKey(auditLog.Middleware(mux)))))
 
 	if err != nil {
-		log.Fatal("Server is not started")
+		log.Fatalf("Server is not started: %v", err)
 	} else {
 		fmt.Println("Server is listening on 8080 port ...")
 	}
@@ -0,0 +1,380 @@
+package airdrop
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusSigned    = "signed"    // written before sending, the raw transaction can be rebroadcast
+	StatusSent      = "sent"      // accepted by the node, waiting for a receipt
+	StatusConfirmed = "confirmed" // mined successfully, never sent again
+	StatusFailed    = "failed"    // not paid, retried on the next run
+)
+
+// Entry is the progress of one recipient. The journal keeps the last entry per address.
+type Entry struct {
+	Line    int            `json:"line"`
+	Address common.Address `json:"address"`
+	Amount  *big.Int       `json:"amount"`
+	Status  string         `json:"status"`
+	Nonce   uint64         `json:"nonce,omitempty"`
+	TxHash  *common.Hash   `json:"tx_hash,omitempty"`
+	Raw     hexutil.Bytes  `json:"raw,omitempty"`
+	Block   uint64         `json:"block,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// Journal is an append-only JSON lines file of entries, synced after every write so a
+// crash never loses the record of a signed transaction.
+type Journal struct {
+	mu      sync.Mutex
+	f       *os.File
+	entries map[common.Address]*Entry
+}
+
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{f: f, entries: make(map[common.Address]*Entry)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// a torn last line from a crash mid-write
+			log.Printf("airdrop: skipping unreadable journal line: %v", err)
+			continue
+		}
+		j.entries[e.Address] = &e
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+func (j *Journal) Get(address common.Address) *Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if e, ok := j.entries[address]; ok {
+		c := *e
+		return &c
+	}
+	return nil
+}
+
+func (j *Journal) Record(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.entries[e.Address] = &e
+	return nil
+}
+
+// Backend is what an airdrop needs from a node besides the signer.
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+}
+
+// Source names airdrop transfers in the spend ledger and the policy violation log.
+const Source = "airdrop"
+
+// Runner pays every row of an airdrop once, recording progress in the journal. Every row
+// goes through the recipient policy and the global spending limits, like any other transfer.
+type Runner struct {
+	backend    Backend
+	signer     *signer.Signer
+	asset      auth.Asset
+	instance   *contract.MyContract
+	journal    *Journal
+	spend      *limits.Engine
+	recipients *policy.Policy
+
+	Timeout     time.Duration // how long to wait for receipts at the end of a run
+	Concurrency int           // receipts awaited at once
+}
+
+func NewRunner(backend Backend, s *signer.Signer, asset auth.Asset, instance *contract.MyContract, journal *Journal, spend *limits.Engine, recipients *policy.Policy) *Runner {
+	return &Runner{
+		backend:     backend,
+		signer:      s,
+		asset:       asset,
+		instance:    instance,
+		journal:     journal,
+		spend:       spend,
+		recipients:  recipients,
+		Timeout:     10 * time.Minute,
+		Concurrency: 8,
+	}
+}
+
+// Remaining returns the rows that still need a transaction and their total.
+func (r *Runner) Remaining(rows []Row) ([]Row, *big.Int) {
+	total := new(big.Int)
+	var todo []Row
+	for _, row := range rows {
+		if e := r.journal.Get(row.Address); e != nil && e.Status != StatusFailed {
+			continue
+		}
+		todo = append(todo, row)
+		total.Add(total, row.Amount)
+	}
+	return todo, total
+}
+
+// Run rebroadcasts transactions left unconfirmed by an earlier run, pays the remaining
+// rows and then waits for every receipt. progress is called after each row is sent.
+func (r *Runner) Run(ctx context.Context, rows []Row, progress func(done, total int)) error {
+	for _, row := range rows {
+		if e := r.journal.Get(row.Address); e != nil && (e.Status == StatusSigned || e.Status == StatusSent) {
+			r.rebroadcast(ctx, e)
+		}
+	}
+
+	todo, _ := r.Remaining(rows)
+	for i, row := range todo {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := r.pay(ctx, row); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(i+1, len(todo))
+		}
+	}
+	return r.await(ctx, rows)
+}
+
+// pay signs the transfer, journals it and only then sends it. Errors returned stop the run,
+// including a spending limit being reached; a transfer that the policy refuses or that
+// cannot be built is journaled as failed instead.
+func (r *Runner) pay(ctx context.Context, row Row) error {
+	entry := Entry{Line: row.Line, Address: row.Address, Amount: row.Amount}
+
+	if err := r.recipients.Check(ctx, row.Address, &r.asset.Address, Source); err != nil {
+		var v *policy.Violation
+		if !errors.As(err, &v) {
+			return err
+		}
+		entry.Status, entry.Error = StatusFailed, err.Error()
+		return r.journal.Record(entry)
+	}
+	spent, err := r.spend.SpendAs("", r.asset, []*big.Int{row.Amount}, Source)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", row.Line, err)
+	}
+	release := func() {
+		if err := r.spend.Release(spent); err != nil {
+			log.Printf("airdrop: line %d: %v", row.Line, err)
+		}
+	}
+
+	nonce, err := r.signer.Reserve(ctx, 1)
+	if err != nil {
+		release()
+		return err
+	}
+	opts, err := r.signer.Opts(ctx, nonce)
+	if err != nil {
+		r.abandon(nonce)
+		release()
+		return err
+	}
+	opts.NoSend = true
+	tx, err := r.instance.Transfer(opts, row.Address, row.Amount)
+	if err != nil {
+		r.abandon(nonce)
+		release()
+		entry.Status, entry.Error = StatusFailed, err.Error()
+		return r.journal.Record(entry)
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		r.abandon(nonce)
+		release()
+		return err
+	}
+	hash := tx.Hash()
+	entry.Nonce, entry.TxHash, entry.Raw, entry.Status = nonce, &hash, raw, StatusSigned
+	if err := r.journal.Record(entry); err != nil {
+		r.abandon(nonce)
+		release()
+		return err
+	}
+
+	if err := r.backend.SendTransaction(ctx, tx); err != nil {
+		// The node may have accepted it anyway, so the row is never signed twice: the run
+		// stops and the next one rebroadcasts the journaled transaction.
+		return fmt.Errorf("send to %s (line %d): %w", row.Address.Hex(), row.Line, err)
+	}
+	r.signer.Sent(ctx, tx)
+	entry.Status = StatusSent
+	return r.journal.Record(entry)
+}
+
+func (r *Runner) abandon(nonce uint64) {
+	if err := r.signer.Abandon(context.Background(), nonce); err != nil {
+		log.Printf("airdrop: abandon nonce %d: %v", nonce, err)
+	}
+}
+
+// rebroadcast resends a journaled transaction unless the node already knows it.
+func (r *Runner) rebroadcast(ctx context.Context, e *Entry) {
+	if _, _, err := r.backend.TransactionByHash(ctx, *e.TxHash); err == nil {
+		return
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(e.Raw); err != nil {
+		log.Printf("airdrop: %s: decode journaled transaction: %v", e.Address.Hex(), err)
+		return
+	}
+	if err := r.backend.SendTransaction(ctx, tx); err != nil {
+		if strings.Contains(err.Error(), "nonce too low") {
+			if _, err := r.backend.TransactionReceipt(ctx, *e.TxHash); errors.Is(err, ethereum.NotFound) {
+				// the nonce went to another transaction, so this one can never be mined
+				e.Status, e.Error, e.Raw = StatusFailed, "nonce used by another transaction", nil
+				if err := r.journal.Record(*e); err != nil {
+					log.Printf("airdrop: %v", err)
+				}
+				return
+			}
+		}
+		log.Printf("airdrop: %s: rebroadcast %s: %v", e.Address.Hex(), e.TxHash.Hex(), err)
+		return
+	}
+	if e.Status == StatusSigned {
+		e.Status = StatusSent
+		if err := r.journal.Record(*e); err != nil {
+			log.Printf("airdrop: %v", err)
+		}
+	}
+}
+
+// await waits for the receipts of all sent transactions. Transactions still pending at the
+// timeout stay "sent" and are checked again by the next run.
+func (r *Runner) await(ctx context.Context, rows []Row) error {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	sem := make(chan struct{}, r.Concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for _, row := range rows {
+		e := r.journal.Get(row.Address)
+		if e == nil || e.Status != StatusSent {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			receipt, err := r.receipt(ctx, *e.TxHash)
+			if err != nil {
+				return
+			}
+			e.Block = receipt.BlockNumber.Uint64()
+			if receipt.Status == types.ReceiptStatusSuccessful {
+				e.Status, e.Raw = StatusConfirmed, nil
+			} else {
+				e.Status, e.Error, e.Raw = StatusFailed, "transaction reverted", nil
+			}
+			if err := r.journal.Record(*e); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (r *Runner) receipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		receipt, err := r.backend.TransactionReceipt(ctx, hash)
+		if err == nil {
+			return receipt, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			log.Printf("airdrop: receipt %s: %v", hash.Hex(), err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WriteReport writes one CSV line per row with its final status and transaction.
+func (r *Runner) WriteReport(w io.Writer, rows []Row, problems []Problem, decimals uint8) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"line", "address", "amount", "status", "tx_hash", "block", "error"})
+	for _, row := range rows {
+		status, txHash, block, errMsg := "pending", "", "", ""
+		if e := r.journal.Get(row.Address); e != nil {
+			status, errMsg = e.Status, e.Error
+			if e.TxHash != nil {
+				txHash = e.TxHash.Hex()
+			}
+			if e.Block != 0 {
+				block = strconv.FormatUint(e.Block, 10)
+			}
+		}
+		out.Write([]string{strconv.Itoa(row.Line), row.Address.Hex(), units.FormatAmount(row.Amount, decimals), status, txHash, block, errMsg})
+	}
+	for _, p := range problems {
+		out.Write([]string{strconv.Itoa(p.Line), "", "", "skipped", "", "", p.Reason})
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,87 @@
+package airdrop
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// Row is a recipient read from the CSV.
+type Row struct {
+	Line    int
+	Address common.Address
+	Amount  *big.Int
+}
+
+// Problem is a CSV line that was skipped.
+type Problem struct {
+	Line   int
+	Reason string
+}
+
+// ReadCSV reads "address,amount" lines, amounts in token units. An optional header row is
+// skipped. Addresses written in mixed case must carry a valid EIP-55 checksum; repeated
+// addresses are dropped after their first line so nobody is paid twice.
+func ReadCSV(r io.Reader, decimals uint8) ([]Row, []Problem, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var rows []Row
+	var problems []Problem
+	seen := make(map[common.Address]int)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 2 {
+			problems = append(problems, Problem{Line: line, Reason: "expected address,amount"})
+			continue
+		}
+		addr, amountStr := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if len(rows) == 0 && len(problems) == 0 && !common.IsHexAddress(addr) && strings.EqualFold(addr, "address") {
+			continue
+		}
+
+		if !common.IsHexAddress(addr) {
+			problems = append(problems, Problem{Line: line, Reason: fmt.Sprintf("invalid address %q", addr)})
+			continue
+		}
+		address := common.HexToAddress(addr)
+		if !validChecksum(addr, address) {
+			problems = append(problems, Problem{Line: line, Reason: fmt.Sprintf("bad checksum %q, expected %s", addr, address.Hex())})
+			continue
+		}
+		amount, err := units.ParseAmount(amountStr, decimals)
+		if err != nil || amount.Sign() <= 0 {
+			problems = append(problems, Problem{Line: line, Reason: fmt.Sprintf("invalid amount %q", amountStr)})
+			continue
+		}
+		if first, ok := seen[address]; ok {
+			problems = append(problems, Problem{Line: line, Reason: fmt.Sprintf("duplicate of line %d", first)})
+			continue
+		}
+		seen[address] = line
+		rows = append(rows, Row{Line: line, Address: address, Amount: amount})
+	}
+	return rows, problems, nil
+}
+
+// validChecksum accepts all-lowercase and all-uppercase hex, which carry no checksum.
+func validChecksum(s string, address common.Address) bool {
+	hexPart := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if hexPart == strings.ToLower(hexPart) || hexPart == strings.ToUpper(hexPart) {
+		return true
+	}
+	return "0x"+hexPart == address.Hex()
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the IP of the client that sent r. With trustProxy the service sits
+// behind one reverse proxy, which appends the address it saw to X-Forwarded-For; only
+// that right-most hop is used, the ones before it come from the client and can be
+// anything.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		hops := r.Header.Values("X-Forwarded-For")
+		if len(hops) > 0 {
+			parts := strings.Split(hops[len(hops)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(parts[len(parts)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remote     string
+		forwarded  []string // one entry per X-Forwarded-For header
+		trustProxy bool
+		want       string
+	}{
+		{"direct", "203.0.113.7:5123", nil, false, "203.0.113.7"},
+		{"ipv6", "[2001:db8::1]:443", nil, false, "2001:db8::1"},
+		{"no port", "203.0.113.7", nil, false, "203.0.113.7"},
+		{"header without a proxy", "203.0.113.7:5123", []string{"198.51.100.1"}, false, "203.0.113.7"},
+		{"proxy", "10.0.0.2:80", []string{"198.51.100.1"}, true, "198.51.100.1"},
+		{"right-most hop", "10.0.0.2:80", []string{"1.2.3.4, 198.51.100.1"}, true, "198.51.100.1"},
+		{"spaces", "10.0.0.2:80", []string{" 1.2.3.4 ,198.51.100.1 "}, true, "198.51.100.1"},
+		{"last header", "10.0.0.2:80", []string{"1.2.3.4", "5.6.7.8, 198.51.100.1"}, true, "198.51.100.1"},
+		{"forwarded ipv6", "10.0.0.2:80", []string{"2001:db8::2"}, true, "2001:db8::2"},
+		{"spoofed garbage", "10.0.0.2:80", []string{"1.2.3.4, not-an-ip"}, true, "10.0.0.2"},
+		{"empty hop", "10.0.0.2:80", []string{"1.2.3.4,"}, true, "10.0.0.2"},
+		{"proxy without the header", "10.0.0.2:80", nil, true, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for _, v := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := ClientIP(r, tt.trustProxy); got != tt.want {
+			t.Errorf("%s: ClientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
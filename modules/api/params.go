@@ -0,0 +1,81 @@
+package api
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ParseAddress returns the address in query parameter name, or nil if it is absent.
+func ParseAddress(values url.Values, name string) (*common.Address, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	addr, err := HexAddress(name, v)
+	if err != nil {
+		return nil, err
+	}
+	return &addr, nil
+}
+
+func ParseUint(values url.Values, name string) (uint64, error) {
+	v := values.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, Invalid(name, v, ReasonMalformed)
+	}
+	return n, nil
+}
+
+// ParseInt returns the non-negative integer in query parameter name, or def if it is absent.
+func ParseInt(values url.Values, name string, def int) (int, error) {
+	v := values.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, Invalid(name, v, ReasonMalformed)
+	}
+	if n < 0 {
+		return 0, Invalid(name, v, ReasonNegative)
+	}
+	return n, nil
+}
+
+// ParseTime accepts unix seconds or RFC3339 and returns unix seconds, 0 if absent.
+func ParseTime(values url.Values, name string) (uint64, error) {
+	v := values.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil || t.Unix() < 0 {
+		return 0, Invalid(name, v, ReasonMalformed)
+	}
+	return uint64(t.Unix()), nil
+}
+
+// ParseLimit returns the page size in query parameter name: def if it is absent, and at
+// most max.
+func ParseLimit(values url.Values, name string, def, max int) (int, error) {
+	n, err := ParseInt(values, name, def)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, Invalid(name, values.Get(name), ReasonZero)
+	}
+	if n > max {
+		n = max
+	}
+	return n, nil
+}
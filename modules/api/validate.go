@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"strings"
+)
+
+// Reasons reported by a ValidationError.
+const (
+	ReasonRequired    = "required"
+	ReasonMalformed   = "malformed"
+	ReasonLength      = "wrong_length"
+	ReasonChecksum    = "bad_checksum"
+	ReasonZeroAddress = "zero_address"
+	ReasonNegative    = "negative"
+	ReasonZero        = "zero"
+	ReasonPrecision   = "too_many_decimals"
+	ReasonOverflow    = "overflow"
+	ReasonTooLarge    = "too_large"
+	ReasonEmptyRange  = "empty_range" // a lower bound above its upper bound
+)
+
+// ErrInvalid is wrapped by every ValidationError.
+var ErrInvalid = errors.New("invalid parameter")
+
+// maxUint256 is the largest value a uint256 transfer amount can hold.
+var maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// ValidationError describes a rejected request parameter. WriteError renders its field
+// and reason next to the message, so clients can tell what to fix.
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Reason == ReasonRequired {
+		return fmt.Sprintf("missing %s", e.Field)
+	}
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, strings.ReplaceAll(e.Reason, "_", " "))
+}
+
+func (e *ValidationError) Unwrap() error { return ErrInvalid }
+
+// Invalid returns a ValidationError for field.
+func Invalid(field, value, reason string) error {
+	return &ValidationError{Field: field, Value: value, Reason: reason}
+}
+
+// Address parses a hex address that funds may be sent to. Unlike common.HexToAddress it
+// rejects empty input, anything but exactly 40 hex digits, mixed-case input that fails
+// the EIP-55 checksum and the zero address.
+func Address(field, s string) (common.Address, error) {
+	addr, err := HexAddress(field, s)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if addr == (common.Address{}) {
+		return common.Address{}, Invalid(field, s, ReasonZeroAddress)
+	}
+	return addr, nil
+}
+
+// HexAddress is Address for places where the zero address is meaningful, such as
+// filters and contract call arguments.
+func HexAddress(field, s string) (common.Address, error) {
+	if s == "" {
+		return common.Address{}, Invalid(field, s, ReasonRequired)
+	}
+	digits := s
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		digits = digits[2:]
+	}
+	lower, upper := false, false
+	for _, c := range digits {
+		switch {
+		case c >= '0' && c <= '9':
+		case c >= 'a' && c <= 'f':
+			lower = true
+		case c >= 'A' && c <= 'F':
+			upper = true
+		default:
+			return common.Address{}, Invalid(field, s, ReasonMalformed)
+		}
+	}
+	if len(digits) != 2*common.AddressLength {
+		return common.Address{}, Invalid(field, s, ReasonLength)
+	}
+	addr := common.HexToAddress(digits)
+	if lower && upper && addr.Hex()[2:] != digits {
+		return common.Address{}, Invalid(field, s, ReasonChecksum)
+	}
+	return addr, nil
+}
+
+// Amount parses a decimal amount in the units of an asset with the given decimals and
+// rejects anything that is not a positive value fitting in a uint256.
+func Amount(field, s string, decimals uint8) (*big.Int, error) {
+	amount, err := NonNegativeAmount(field, s, decimals)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Sign() == 0 {
+		return nil, Invalid(field, s, ReasonZero)
+	}
+	return amount, nil
+}
+
+// NonNegativeAmount is Amount for bounds and filters, where zero is allowed.
+func NonNegativeAmount(field, s string, decimals uint8) (*big.Int, error) {
+	t := strings.TrimSpace(s)
+	switch {
+	case t == "":
+		return nil, Invalid(field, s, ReasonRequired)
+	case strings.HasPrefix(t, "-"):
+		return nil, Invalid(field, s, ReasonNegative)
+	}
+	if i := strings.IndexByte(t, '.'); i >= 0 && len(t)-i-1 > int(decimals) {
+		return nil, Invalid(field, s, ReasonPrecision)
+	}
+	amount, err := units.ParseAmount(t, decimals)
+	if err != nil {
+		return nil, Invalid(field, s, ReasonMalformed)
+	}
+	if amount.Cmp(maxUint256) > 0 {
+		return nil, Invalid(field, s, ReasonOverflow)
+	}
+	return amount, nil
+}
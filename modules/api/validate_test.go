@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+)
+
+// checksummed is an EIP-55 address; changing the case of any of its letters breaks it.
+const checksummed = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+
+func reason(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalid) {
+		t.Fatalf("err = %v, want a *ValidationError", err)
+	}
+	return invalid.Reason
+}
+
+func TestHexAddress(t *testing.T) {
+	tests := []struct {
+		in     string
+		reason string // empty when valid
+	}{
+		{checksummed, ""},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", ""},
+		{"0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", ""},
+		{"5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", ""},
+		{"0X5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", ""},
+		{"0x0000000000000000000000000000000000000000", ""},
+		{"", ReasonRequired},
+		{"0x", ReasonLength},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea", ReasonLength},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed00", ReasonLength},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaeg", ReasonMalformed},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea d", ReasonMalformed},
+		{"0x5aaeb6053F3E94C9b9A09f33669435E7Ef1BeAed", ReasonChecksum},
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", ReasonChecksum},
+	}
+	for _, tt := range tests {
+		addr, err := HexAddress("to", tt.in)
+		if got := reason(t, err); got != tt.reason {
+			t.Errorf("%q: reason %q, want %q", tt.in, got, tt.reason)
+			continue
+		}
+		if tt.reason == "" && addr != common.HexToAddress(tt.in) {
+			t.Errorf("%q parsed as %s", tt.in, addr.Hex())
+		}
+	}
+}
+
+func TestAddress(t *testing.T) {
+	if addr, err := Address("to", checksummed); err != nil || addr.Hex() != checksummed {
+		t.Errorf("checksummed address: %s, %v", addr.Hex(), err)
+	}
+	for _, in := range []string{"0x0000000000000000000000000000000000000000", "0000000000000000000000000000000000000000"} {
+		if _, err := Address("to", in); reason(t, err) != ReasonZeroAddress {
+			t.Errorf("%q: %v, want the zero address refused", in, err)
+		}
+	}
+	if _, err := Address("to", "0x123"); reason(t, err) != ReasonLength {
+		t.Errorf("short address: %v, want wrong length", err)
+	}
+}
+
+func TestAmount(t *testing.T) {
+	const maxUint256Decimal = "115792089237316195423570985008687907853269984665640564039457584007913129639935"
+	tests := []struct {
+		in       string
+		decimals uint8
+		want     string // raw units, empty when invalid
+		reason   string
+	}{
+		{"1", 18, "1000000000000000000", ""},
+		{"1.5", 6, "1500000", ""},
+		{" 0.000001 ", 6, "1", ""},
+		{".5", 2, "50", ""},
+		{"1.", 2, "100", ""},
+		{maxUint256Decimal, 0, maxUint256Decimal, ""},
+		{"", 18, "", ReasonRequired},
+		{"  ", 18, "", ReasonRequired},
+		{"0", 18, "", ReasonZero},
+		{"0.000", 6, "", ReasonZero},
+		{"-1", 18, "", ReasonNegative},
+		{"-0.5", 18, "", ReasonNegative},
+		{"1.0000001", 6, "", ReasonPrecision},
+		{"0.1", 0, "", ReasonPrecision},
+		{"abc", 18, "", ReasonMalformed},
+		{"1e18", 18, "", ReasonMalformed},
+		{"0x10", 18, "", ReasonMalformed},
+		{"1.2.3", 18, "", ReasonMalformed},
+		{"115792089237316195423570985008687907853269984665640564039457584007913129639936", 0, "", ReasonOverflow},
+		{"115792089237316195423570985008687907853269984665640564039457.584007913129639936", 18, "", ReasonOverflow},
+	}
+	for _, tt := range tests {
+		amount, err := Amount("amount", tt.in, tt.decimals)
+		if got := reason(t, err); got != tt.reason {
+			t.Errorf("%q with %d decimals: reason %q, want %q", tt.in, tt.decimals, got, tt.reason)
+			continue
+		}
+		if tt.reason == "" && amount.String() != tt.want {
+			t.Errorf("%q with %d decimals = %s, want %s", tt.in, tt.decimals, amount, tt.want)
+		}
+	}
+
+	// bounds and filters may be zero
+	if amount, err := NonNegativeAmount("min_amount", "0", 18); err != nil || amount.Sign() != 0 {
+		t.Errorf("zero bound: %v, %v", amount, err)
+	}
+	if _, err := NonNegativeAmount("min_amount", "-1", 18); reason(t, err) != ReasonNegative {
+		t.Errorf("negative bound: %v", err)
+	}
+}
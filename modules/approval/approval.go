@@ -0,0 +1,399 @@
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/audit"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRejected  = "rejected"
+	StatusExpired   = "expired"
+	StatusCanceled  = "canceled"
+	StatusExecuting = "executing" // approved; stays so if the outcome could not be saved
+	StatusExecuted  = "executed"  // approved and handed to the signing path
+	StatusFailed    = "failed"    // approved, but the transfer could not be sent
+
+	defaultExpiry = 24 * time.Hour
+)
+
+var (
+	ErrNotFound     = errors.New("approval request not found")
+	ErrNotPending   = errors.New("approval request is no longer pending")
+	ErrSelfApproval = errors.New("requests can't be approved by the key that made them")
+	ErrNotApprover  = errors.New("this key is not an approver for the request")
+	ErrAlreadyVoted = errors.New("this key already decided on the request")
+	ErrNotRequester = errors.New("only the requesting key can cancel a request")
+	ErrNoExecutor   = errors.New("no executor for request kind")
+)
+
+// Decision is one approver's vote.
+type Decision struct {
+	KeyID   string    `json:"key_id"`
+	Name    string    `json:"name,omitempty"`
+	Approve bool      `json:"approve"`
+	Comment string    `json:"comment,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Request is a transfer waiting for approval. Payload holds whatever the executor of
+// Kind needs to send it.
+type Request struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Summary     string          `json:"summary"`
+	Asset       string          `json:"asset"`
+	Token       *common.Address `json:"token,omitempty"`
+	Amount      string          `json:"amount"` // in the asset's units
+	Payload     json.RawMessage `json:"payload"`
+	RequestedBy *auth.Principal `json:"requested_by,omitempty"`
+	Quorum      int             `json:"quorum"`
+	Approvers   []string        `json:"approvers,omitempty"`
+	Decisions   []Decision      `json:"decisions"`
+	Status      string          `json:"status"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	DecidedAt   *time.Time      `json:"decided_at,omitempty"`
+}
+
+func (r *Request) approvals() int {
+	n := 0
+	for _, d := range r.Decisions {
+		if d.Approve {
+			n++
+		}
+	}
+	return n
+}
+
+// Executor sends an approved request. It runs with the requester as the caller in ctx,
+// so their key restrictions and spending limits still apply.
+type Executor func(ctx context.Context, payload json.RawMessage) (interface{}, error)
+
+// Workflow holds transfers above the configured thresholds until enough approvers agree.
+type Workflow struct {
+	store *store.Store
+	cfg   config.Approvals
+
+	mu        sync.Mutex // serializes decisions
+	executors map[string]Executor
+}
+
+func New(db *store.Store, cfg config.Approvals) *Workflow {
+	return &Workflow{store: db, cfg: cfg, executors: map[string]Executor{}}
+}
+
+// Handle registers the executor for a kind of request.
+func (w *Workflow) Handle(kind string, fn Executor) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.executors[kind] = fn
+}
+
+func requestKey(id string) []byte {
+	return []byte("q/r/" + id)
+}
+
+func newID(now time.Time) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%016x%s", now.UnixNano(), hex.EncodeToString(b))
+}
+
+// Required returns the rule a transfer of amount falls under, or nil when it can go
+// through directly. With several matching rules the strictest quorum wins.
+func (w *Workflow) Required(asset auth.Asset, amount *big.Int) (*config.ApprovalRule, error) {
+	if w == nil {
+		return nil, nil
+	}
+	var found *config.ApprovalRule
+	for i, rule := range w.cfg.Rules {
+		if !asset.Matches(rule.Token) {
+			continue
+		}
+		threshold, err := units.ParseAmount(rule.Threshold, asset.Decimals)
+		if err != nil {
+			return nil, fmt.Errorf("approval threshold for %s: %w", rule.Token, err)
+		}
+		if amount.Cmp(threshold) <= 0 {
+			continue
+		}
+		if found == nil || quorum(&w.cfg.Rules[i]) > quorum(found) {
+			found = &w.cfg.Rules[i]
+		}
+	}
+	return found, nil
+}
+
+func quorum(rule *config.ApprovalRule) int {
+	if rule.Quorum <= 0 {
+		return 1
+	}
+	return rule.Quorum
+}
+
+// Submit stores a pending request for a transfer that needs approval under rule.
+func (w *Workflow) Submit(ctx context.Context, rule *config.ApprovalRule, kind, summary string, asset auth.Asset, amount *big.Int, payload interface{}) (*Request, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	expiry := time.Duration(w.cfg.Expiry)
+	if expiry <= 0 {
+		expiry = defaultExpiry
+	}
+	now := time.Now().UTC()
+	req := &Request{
+		ID:          newID(now),
+		Kind:        kind,
+		Summary:     summary,
+		Asset:       asset.Symbol,
+		Amount:      units.FormatAmount(amount, asset.Decimals),
+		Payload:     data,
+		RequestedBy: auth.FromContext(ctx),
+		Quorum:      quorum(rule),
+		Approvers:   rule.Approvers,
+		Decisions:   []Decision{},
+		Status:      StatusPending,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(expiry),
+	}
+	if asset.Address != (common.Address{}) {
+		token := asset.Address
+		req.Token = &token
+	}
+	if err := w.store.Put(requestKey(req.ID), req); err != nil {
+		return nil, err
+	}
+	log.Printf("approval: %s waits for %d approvals: %s", req.ID, req.Quorum, req.Summary)
+	audit.Note(ctx, audit.EventApproval, fmt.Sprintf("request %s waits for %d approvals: %s", req.ID, req.Quorum, req.Summary))
+	return req, nil
+}
+
+// expire marks a pending request past its deadline as expired and reports whether it did.
+func expire(req *Request, now time.Time) bool {
+	if req.Status != StatusPending || now.Before(req.ExpiresAt) {
+		return false
+	}
+	req.Status, req.DecidedAt = StatusExpired, &now
+	return true
+}
+
+func (w *Workflow) Get(id string) (*Request, error) {
+	var req Request
+	if err := w.store.Get(requestKey(id), &req); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	expire(&req, time.Now().UTC())
+	return &req, nil
+}
+
+// List returns requests newest first, only those with status when it is set.
+func (w *Workflow) List(status string, limit int) ([]*Request, error) {
+	requests := []*Request{}
+	now := time.Now().UTC()
+	var decodeErr error
+	err := w.store.Iterate([]byte("q/r/"), nil, nil, true, func(_, value []byte) bool {
+		var req Request
+		if decodeErr = json.Unmarshal(value, &req); decodeErr != nil {
+			return false
+		}
+		expire(&req, now)
+		if status == "" || req.Status == status {
+			requests = append(requests, &req)
+		}
+		return len(requests) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return requests, decodeErr
+}
+
+// Decide records an approval or rejection by the caller in ctx. A rejection closes the
+// request; the approval that reaches the quorum executes it before Decide returns. The
+// request is saved as executing before the transfer is sent, so a failure to save the
+// outcome leaves it there instead of pending, where another approval would pay it again.
+func (w *Workflow) Decide(ctx context.Context, id string, approve bool, comment string) (*Request, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req, err := w.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if req.Status == StatusExpired {
+		// persist the expiry noticed on read
+		if err := w.store.Put(requestKey(req.ID), req); err != nil {
+			return nil, err
+		}
+	}
+	if req.Status != StatusPending {
+		return nil, fmt.Errorf("%w: %s", ErrNotPending, req.Status)
+	}
+
+	d := Decision{Approve: approve, Comment: comment, At: now}
+	if p := auth.FromContext(ctx); p != nil {
+		d.KeyID, d.Name = p.ID, p.Name
+	}
+	if req.RequestedBy != nil && d.KeyID == req.RequestedBy.ID {
+		return nil, ErrSelfApproval
+	}
+	if len(req.Approvers) > 0 && !contains(req.Approvers, d.KeyID) {
+		return nil, ErrNotApprover
+	}
+	for _, prev := range req.Decisions {
+		if prev.KeyID == d.KeyID {
+			return nil, ErrAlreadyVoted
+		}
+	}
+	req.Decisions = append(req.Decisions, d)
+	verb := "rejected"
+	if approve {
+		verb = "approved"
+	}
+	audit.Note(ctx, audit.EventApproval, fmt.Sprintf("%s request %s (%d of %d approvals)", verb, req.ID, req.approvals(), req.Quorum))
+
+	switch {
+	case !approve:
+		req.Status, req.DecidedAt = StatusRejected, &now
+	case req.approvals() >= req.Quorum:
+		req.Status, req.DecidedAt = StatusExecuting, &now
+	}
+	if err := w.store.Put(requestKey(req.ID), req); err != nil {
+		return nil, err
+	}
+	if req.Status != StatusExecuting {
+		return req, nil
+	}
+	w.execute(ctx, req)
+	if err := w.store.Put(requestKey(req.ID), req); err != nil {
+		log.Printf("approval: %s %s, but the outcome was not saved: %v", req.ID, req.Status, err)
+		return nil, fmt.Errorf("request %s was executed, saving its outcome: %w", req.ID, err)
+	}
+	return req, nil
+}
+
+func (w *Workflow) execute(ctx context.Context, req *Request) {
+	fn, ok := w.executors[req.Kind]
+	if !ok {
+		req.Status, req.Error = StatusFailed, fmt.Sprintf("%v %q", ErrNoExecutor, req.Kind)
+		return
+	}
+	// run as the requester and without the approver's request deadline, but keep
+	// the approver's audit record
+	execCtx := audit.Carry(ctx, context.Background())
+	if req.RequestedBy != nil {
+		execCtx = auth.WithPrincipal(execCtx, req.RequestedBy)
+	}
+	result, err := fn(execCtx, req.Payload)
+	if err != nil {
+		req.Status, req.Error = StatusFailed, err.Error()
+		log.Printf("approval: %s failed: %v", req.ID, err)
+		return
+	}
+	req.Status = StatusExecuted
+	if data, err := json.Marshal(result); err == nil {
+		req.Result = data
+	}
+}
+
+// Cancel withdraws a pending request; only its requester may do so.
+func (w *Workflow) Cancel(ctx context.Context, id string) (*Request, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req, err := w.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != StatusPending {
+		return nil, fmt.Errorf("%w: %s", ErrNotPending, req.Status)
+	}
+	p := auth.FromContext(ctx)
+	if req.RequestedBy != nil && (p == nil || p.ID != req.RequestedBy.ID) {
+		return nil, ErrNotRequester
+	}
+	now := time.Now().UTC()
+	req.Status, req.DecidedAt = StatusCanceled, &now
+	if err := w.store.Put(requestKey(req.ID), req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Run persists expiries of stale requests every interval until ctx is cancelled.
+func (w *Workflow) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.expireStale(); err != nil {
+				log.Printf("approval: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Workflow) expireStale() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now().UTC()
+	batch := new(store.Batch)
+	var decodeErr error
+	err := w.store.Iterate([]byte("q/r/"), nil, nil, false, func(_, value []byte) bool {
+		var req Request
+		if decodeErr = json.Unmarshal(value, &req); decodeErr != nil {
+			return false
+		}
+		if expire(&req, now) {
+			decodeErr = batch.Put(requestKey(req.ID), &req)
+			log.Printf("approval: %s expired", req.ID)
+		}
+		return decodeErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return w.store.Write(batch)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
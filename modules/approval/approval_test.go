@@ -0,0 +1,226 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var usdc = auth.Asset{Symbol: "USDC", Decimals: 6}
+
+func newTestWorkflow(t *testing.T, cfg config.Approvals) (*Workflow, *store.Store) {
+	t.Helper()
+	db, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(db, cfg), db
+}
+
+func as(id string) context.Context {
+	return auth.WithPrincipal(context.Background(), &auth.Principal{ID: id, Name: id, Role: auth.RoleOperator})
+}
+
+func submit(t *testing.T, w *Workflow, requester string, amount int64) *Request {
+	t.Helper()
+	rule, err := w.Required(usdc, big.NewInt(amount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule == nil {
+		t.Fatalf("%d needs no approval", amount)
+	}
+	req, err := w.Submit(as(requester), rule, "transfer", "send to 0x1", usdc, big.NewInt(amount), map[string]int64{"amount": amount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestRequired(t *testing.T) {
+	w, _ := newTestWorkflow(t, config.Approvals{Rules: []config.ApprovalRule{
+		{Token: "usdc", Threshold: "100"},
+		{Token: "USDC", Threshold: "1000", Quorum: 3},
+		{Token: "ETH", Threshold: "1"},
+	}})
+	tests := []struct {
+		amount int64
+		quorum int // 0 when no approval is needed
+	}{
+		{100e6, 0},
+		{100e6 + 1, 1},
+		{1000e6 + 1, 3},
+	}
+	for _, tt := range tests {
+		rule, err := w.Required(usdc, big.NewInt(tt.amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case tt.quorum == 0 && rule != nil:
+			t.Errorf("%d: rule %+v, want none", tt.amount, rule)
+		case tt.quorum != 0 && (rule == nil || quorum(rule) != tt.quorum):
+			t.Errorf("%d: rule %+v, want quorum %d", tt.amount, rule, tt.quorum)
+		}
+	}
+	if rule, _ := w.Required(auth.Asset{Symbol: "DAI", Decimals: 18}, big.NewInt(1e18)); rule != nil {
+		t.Errorf("token without a rule: %+v", rule)
+	}
+	var none *Workflow
+	if rule, err := none.Required(usdc, big.NewInt(1e18)); rule != nil || err != nil {
+		t.Errorf("nil workflow: %+v, %v", rule, err)
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	w, db := newTestWorkflow(t, config.Approvals{Rules: []config.ApprovalRule{
+		{Token: "USDC", Threshold: "100", Quorum: 2, Approvers: []string{"alice", "bob", "carol"}},
+	}})
+	var ran []string
+	var id string
+	w.Handle("transfer", func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		// executors run as the requester, after the request left pending for good
+		var stored Request
+		if err := db.Get(requestKey(id), &stored); err != nil || stored.Status != StatusExecuting {
+			t.Errorf("stored status %q while executing, want executing: %v", stored.Status, err)
+		}
+		ran = append(ran, auth.FromContext(ctx).ID+" "+string(payload))
+		return map[string]string{"tx": "0xabc"}, nil
+	})
+	req := submit(t, w, "alice", 500e6)
+	id = req.ID
+	if req.Status != StatusPending || req.Amount != "500" || req.Quorum != 2 {
+		t.Fatalf("submitted %+v", req)
+	}
+
+	if _, err := w.Decide(as("alice"), req.ID, true, ""); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("approving one's own request: %v, want ErrSelfApproval", err)
+	}
+	if _, err := w.Decide(as("mallory"), req.ID, true, ""); !errors.Is(err, ErrNotApprover) {
+		t.Errorf("approval by a stranger: %v, want ErrNotApprover", err)
+	}
+	got, err := w.Decide(as("bob"), req.ID, true, "ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusPending || len(ran) != 0 {
+		t.Fatalf("after 1 of 2 approvals: status %s, executed %v", got.Status, ran)
+	}
+	if _, err := w.Decide(as("bob"), req.ID, true, ""); !errors.Is(err, ErrAlreadyVoted) {
+		t.Errorf("second vote: %v, want ErrAlreadyVoted", err)
+	}
+
+	got, err = w.Decide(as("carol"), req.ID, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusExecuted || string(got.Result) != `{"tx":"0xabc"}` || got.DecidedAt == nil {
+		t.Fatalf("after the quorum: %+v", got)
+	}
+	if len(ran) != 1 || ran[0] != `alice {"amount":500000000}` {
+		t.Fatalf("executed %v, want once as alice", ran)
+	}
+	if stored, _ := w.Get(req.ID); stored.Status != StatusExecuted || len(stored.Decisions) != 2 {
+		t.Errorf("stored request %+v", stored)
+	}
+	if _, err := w.Decide(as("bob"), req.ID, false, ""); !errors.Is(err, ErrNotPending) {
+		t.Errorf("deciding an executed request: %v, want ErrNotPending", err)
+	}
+}
+
+func TestRejectAndCancel(t *testing.T) {
+	w, _ := newTestWorkflow(t, config.Approvals{Rules: []config.ApprovalRule{{Token: "USDC", Threshold: "100", Quorum: 2}}})
+	w.Handle("transfer", func(context.Context, json.RawMessage) (interface{}, error) {
+		t.Error("a rejected or canceled request was executed")
+		return nil, nil
+	})
+
+	rejected := submit(t, w, "alice", 500e6)
+	if got, err := w.Decide(as("bob"), rejected.ID, false, "too much"); err != nil || got.Status != StatusRejected {
+		t.Fatalf("reject: %+v, %v", got, err)
+	}
+	if _, err := w.Decide(as("carol"), rejected.ID, true, ""); !errors.Is(err, ErrNotPending) {
+		t.Errorf("approving a rejected request: %v, want ErrNotPending", err)
+	}
+
+	canceled := submit(t, w, "alice", 500e6)
+	if _, err := w.Cancel(as("bob"), canceled.ID); !errors.Is(err, ErrNotRequester) {
+		t.Errorf("cancel by another key: %v, want ErrNotRequester", err)
+	}
+	if got, err := w.Cancel(as("alice"), canceled.ID); err != nil || got.Status != StatusCanceled {
+		t.Fatalf("cancel: %+v, %v", got, err)
+	}
+	if _, err := w.Decide(as("bob"), canceled.ID, true, ""); !errors.Is(err, ErrNotPending) {
+		t.Errorf("approving a canceled request: %v, want ErrNotPending", err)
+	}
+
+	pending := submit(t, w, "alice", 500e6)
+	list, err := w.List(StatusPending, defaultList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != pending.ID {
+		t.Errorf("pending requests = %v, want only %s", list, pending.ID)
+	}
+	if all, _ := w.List("", defaultList); len(all) != 3 || all[0].ID != pending.ID {
+		t.Errorf("listed %d requests, want 3 newest first", len(all))
+	}
+	if _, err := w.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing request: %v, want ErrNotFound", err)
+	}
+}
+
+func TestExecutionFailure(t *testing.T) {
+	w, _ := newTestWorkflow(t, config.Approvals{Rules: []config.ApprovalRule{{Token: "USDC", Threshold: "100"}}})
+	w.Handle("transfer", func(context.Context, json.RawMessage) (interface{}, error) {
+		return nil, errors.New("insufficient funds")
+	})
+	got, err := w.Decide(as("bob"), submit(t, w, "alice", 500e6).ID, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusFailed || got.Error != "insufficient funds" {
+		t.Errorf("failed executor: status %s, error %q", got.Status, got.Error)
+	}
+
+	req, err := w.Submit(as("alice"), &config.ApprovalRule{}, "sweep", "sweep", usdc, big.NewInt(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := w.Decide(as("bob"), req.ID, true, ""); got.Status != StatusFailed {
+		t.Errorf("kind without an executor: status %s, want failed", got.Status)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	w, db := newTestWorkflow(t, config.Approvals{
+		Rules:  []config.ApprovalRule{{Token: "USDC", Threshold: "100"}},
+		Expiry: config.Duration(50 * time.Millisecond),
+	})
+	req := submit(t, w, "alice", 500e6)
+	time.Sleep(100 * time.Millisecond)
+
+	if got, _ := w.Get(req.ID); got.Status != StatusExpired {
+		t.Fatalf("read after the deadline: status %s, want expired", got.Status)
+	}
+	var stored Request
+	if err := db.Get(requestKey(req.ID), &stored); err != nil || stored.Status != StatusPending {
+		t.Fatalf("stored status %s before the sweep: %v", stored.Status, err)
+	}
+	if err := w.expireStale(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(requestKey(req.ID), &stored); err != nil || stored.Status != StatusExpired {
+		t.Fatalf("stored status %s after the sweep, want expired: %v", stored.Status, err)
+	}
+	if _, err := w.Decide(as("bob"), req.ID, true, ""); !errors.Is(err, ErrNotPending) {
+		t.Errorf("approving an expired request: %v, want ErrNotPending", err)
+	}
+}
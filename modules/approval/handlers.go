@@ -0,0 +1,94 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"io"
+	"net/http"
+)
+
+const (
+	defaultList = 50
+	maxList     = 500
+)
+
+type decisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+// HTTPStatus maps workflow errors to response status codes.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNotPending), errors.Is(err, ErrAlreadyVoted):
+		return http.StatusConflict
+	case errors.Is(err, ErrSelfApproval), errors.Is(err, ErrNotApprover), errors.Is(err, ErrNotRequester):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ListHandler serves GET /approvals, requests newest first; ?status=pending to filter.
+func (wf *Workflow) ListHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := api.ParseLimit(r.URL.Query(), "limit", defaultList, maxList)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	requests, err := wf.List(r.URL.Query().Get("status"), limit)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, requests)
+}
+
+// GetHandler serves GET /approvals/{id}.
+func (wf *Workflow) GetHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := wf.Get(router.Param(r, "id"))
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, req)
+}
+
+// ApproveHandler serves POST /approvals/{id}/approve {"comment"}; the transfer is sent once
+// the quorum is reached.
+func (wf *Workflow) ApproveHandler(w http.ResponseWriter, r *http.Request) {
+	wf.decide(w, r, true)
+}
+
+// RejectHandler serves POST /approvals/{id}/reject {"comment"}.
+func (wf *Workflow) RejectHandler(w http.ResponseWriter, r *http.Request) {
+	wf.decide(w, r, false)
+}
+
+func (wf *Workflow) decide(w http.ResponseWriter, r *http.Request, approve bool) {
+	var body decisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	req, err := wf.Decide(r.Context(), router.Param(r, "id"), approve, body.Comment)
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, req)
+}
+
+// CancelHandler serves POST /approvals/{id}/cancel, which withdraws a request; only its
+// requester may do so.
+func (wf *Workflow) CancelHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := wf.Cancel(r.Context(), router.Param(r, "id"))
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, req)
+}
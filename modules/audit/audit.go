@@ -0,0 +1,311 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	KindRequest     = "request"
+	KindTransaction = "transaction" // sent outside of a request, e.g. by a background job
+
+	EventTx       = "tx"
+	EventPolicy   = "policy"
+	EventLimit    = "limit"
+	EventApproval = "approval"
+)
+
+var (
+	ErrNotFound = errors.New("audit record not found")
+	ErrTampered = errors.New("audit chain is broken")
+)
+
+// Event is something decided or done while handling a request.
+type Event struct {
+	Type   string    `json:"type"`
+	Detail string    `json:"detail"`
+	At     time.Time `json:"at"`
+}
+
+// Record is one entry of the chain. Hash covers every other field, including PrevHash,
+// so changing or removing a record breaks every hash after it.
+type Record struct {
+	Seq        uint64          `json:"seq"`
+	Time       time.Time       `json:"time"`
+	Kind       string          `json:"kind"`
+	Actor      *auth.Principal `json:"actor,omitempty"`
+	RemoteAddr string          `json:"remote_addr,omitempty"`
+	Method     string          `json:"method,omitempty"`
+	Path       string          `json:"path,omitempty"`
+	Query      string          `json:"query,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Events     []Event         `json:"events,omitempty"`
+	TxHashes   []string        `json:"tx_hashes,omitempty"`
+	Status     int             `json:"status,omitempty"`
+	Outcome    string          `json:"outcome"`
+	DurationMS int64           `json:"duration_ms,omitempty"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// digest is the hash of the record with its Hash field cleared.
+func (r Record) digest() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Log is the append-only audit log, stored under v/.
+type Log struct {
+	store *store.Store
+
+	mu   sync.Mutex
+	head head
+}
+
+func New(db *store.Store) (*Log, error) {
+	l := &Log{store: db}
+	if err := db.Get(headKey, &l.head); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	return l, nil
+}
+
+var headKey = []byte("v/head")
+
+func recordKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("v/r/%016x", seq))
+}
+
+// Append chains rec to the log and stores it.
+func (l *Log) Append(rec *Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Seq = l.head.Seq + 1
+	rec.PrevHash = l.head.Hash
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	hash, err := rec.digest()
+	if err != nil {
+		return err
+	}
+	rec.Hash = hash
+
+	next := head{Seq: rec.Seq, Hash: rec.Hash}
+	batch := new(store.Batch)
+	if err := batch.Put(recordKey(rec.Seq), rec); err != nil {
+		return err
+	}
+	if err := batch.Put(headKey, next); err != nil {
+		return err
+	}
+	if err := l.store.Write(batch); err != nil {
+		return err
+	}
+	l.head = next
+	return nil
+}
+
+// collector gathers the events of one request.
+type collector struct {
+	mu     sync.Mutex
+	events []Event
+	txs    []string
+}
+
+type collectorKey struct{}
+
+func withCollector(ctx context.Context, c *collector) context.Context {
+	return context.WithValue(ctx, collectorKey{}, c)
+}
+
+// Carry moves the audit record of from onto to, for work that outlives the request
+// context but still belongs to its record.
+func Carry(from, to context.Context) context.Context {
+	if c, ok := from.Value(collectorKey{}).(*collector); ok {
+		return withCollector(to, c)
+	}
+	return to
+}
+
+// Note adds an event to the record of the request in ctx and reports whether there was one.
+func Note(ctx context.Context, typ, detail string) bool {
+	c, ok := ctx.Value(collectorKey{}).(*collector)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, Event{Type: typ, Detail: detail, At: time.Now().UTC()})
+	return true
+}
+
+// Transaction records a signed transaction: on the record of the request in ctx, or as a
+// record of its own when it was sent by a background job.
+func (l *Log) Transaction(ctx context.Context, tx *types.Transaction) {
+	hash := tx.Hash().Hex()
+	if c, ok := ctx.Value(collectorKey{}).(*collector); ok {
+		c.mu.Lock()
+		c.txs = append(c.txs, hash)
+		c.events = append(c.events, Event{Type: EventTx, Detail: fmt.Sprintf("signed %s with nonce %d", hash, tx.Nonce()), At: time.Now().UTC()})
+		c.mu.Unlock()
+		return
+	}
+	rec := &Record{
+		Kind:     KindTransaction,
+		Actor:    auth.FromContext(ctx),
+		TxHashes: []string{hash},
+		Outcome:  fmt.Sprintf("signed with nonce %d", tx.Nonce()),
+	}
+	if err := l.Append(rec); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+func (l *Log) Get(seq uint64) (*Record, error) {
+	var rec Record
+	if err := l.store.Get(recordKey(seq), &rec); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// Filter selects records for Query. Zero fields match everything.
+type Filter struct {
+	Actor  string // key ID
+	Path   string // prefix
+	TxHash string
+	From   time.Time
+	To     time.Time
+	Before uint64 // only records with a lower seq, for paging
+	Limit  int
+}
+
+func (f *Filter) matches(rec *Record) bool {
+	switch {
+	case f.Actor != "" && (rec.Actor == nil || rec.Actor.ID != f.Actor):
+		return false
+	case f.Path != "" && (len(rec.Path) < len(f.Path) || rec.Path[:len(f.Path)] != f.Path):
+		return false
+	case !f.From.IsZero() && rec.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && rec.Time.After(f.To):
+		return false
+	case f.TxHash != "":
+		for _, h := range rec.TxHashes {
+			if h == f.TxHash {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Query returns matching records, newest first.
+func (l *Log) Query(f Filter) ([]*Record, error) {
+	records := []*Record{}
+	var limit []byte
+	if f.Before > 0 {
+		limit = recordKey(f.Before)
+	}
+	var decodeErr error
+	err := l.store.Iterate([]byte("v/r/"), nil, limit, true, func(_, value []byte) bool {
+		var rec Record
+		if decodeErr = json.Unmarshal(value, &rec); decodeErr != nil {
+			return false
+		}
+		if f.matches(&rec) {
+			records = append(records, &rec)
+		}
+		return len(records) < f.Limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, decodeErr
+}
+
+// Verification is the result of re-walking the chain.
+type Verification struct {
+	Records  uint64 `json:"records"`
+	HeadSeq  uint64 `json:"head_seq"`
+	HeadHash string `json:"head_hash"`
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Verify recomputes every hash and link from the first record to the stored head. Keep
+// the reported head hash somewhere else: a chain rewritten from scratch still verifies.
+func (l *Log) Verify() (*Verification, error) {
+	l.mu.Lock()
+	h := l.head
+	l.mu.Unlock()
+
+	v := &Verification{HeadSeq: h.Seq, HeadHash: h.Hash}
+	var prev head
+	var problem error
+	var decodeErr error
+	err := l.store.Iterate([]byte("v/r/"), nil, recordKey(h.Seq+1), false, func(key, value []byte) bool {
+		var rec Record
+		if decodeErr = json.Unmarshal(value, &rec); decodeErr != nil {
+			problem = fmt.Errorf("%w: %s does not decode: %v", ErrTampered, key, decodeErr)
+			return false
+		}
+		digest, err := rec.digest()
+		switch {
+		case err != nil:
+			problem = err
+		case string(key) != string(recordKey(rec.Seq)):
+			problem = fmt.Errorf("%w: record %d stored under %s", ErrTampered, rec.Seq, key)
+		case rec.Seq != prev.Seq+1:
+			problem = fmt.Errorf("%w: record %d follows %d", ErrTampered, rec.Seq, prev.Seq)
+		case rec.PrevHash != prev.Hash:
+			problem = fmt.Errorf("%w: record %d does not link to record %d", ErrTampered, rec.Seq, prev.Seq)
+		case digest != rec.Hash:
+			problem = fmt.Errorf("%w: record %d was modified", ErrTampered, rec.Seq)
+		}
+		if problem != nil {
+			return false
+		}
+		v.Records++
+		prev = head{Seq: rec.Seq, Hash: rec.Hash}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if problem == nil && prev != h {
+		problem = fmt.Errorf("%w: chain ends at record %d, head is %d", ErrTampered, prev.Seq, h.Seq)
+	}
+	if problem != nil {
+		v.Error = problem.Error()
+		return v, nil
+	}
+	v.OK = true
+	return v, nil
+}
@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestLog(t *testing.T) (*Log, *store.Store) {
+	t.Helper()
+	db, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	l, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, db
+}
+
+func appendN(t *testing.T, l *Log, n int) []*Record {
+	t.Helper()
+	records := make([]*Record, n)
+	for i := range records {
+		records[i] = &Record{Kind: KindRequest, Method: http.MethodPost, Path: "/contract/transfer", Outcome: "OK"}
+		if err := l.Append(records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return records
+}
+
+func testTx(nonce uint64) *types.Transaction {
+	return types.NewTransaction(nonce, common.HexToAddress("0x01"), big.NewInt(1), 21000, big.NewInt(1), nil)
+}
+
+func TestAppendChains(t *testing.T) {
+	l, db := newTestLog(t)
+	records := appendN(t, l, 3)
+	for i, rec := range records {
+		if rec.Seq != uint64(i+1) || rec.Hash == "" {
+			t.Fatalf("record %d: seq %d, hash %q", i, rec.Seq, rec.Hash)
+		}
+		if i > 0 && rec.PrevHash != records[i-1].Hash {
+			t.Errorf("record %d does not link to the one before", rec.Seq)
+		}
+	}
+	if records[0].PrevHash != "" {
+		t.Errorf("first record links to %q", records[0].PrevHash)
+	}
+
+	v, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.OK || v.Records != 3 || v.HeadHash != records[2].Hash {
+		t.Fatalf("verification %+v", v)
+	}
+
+	// a reopened log continues the chain
+	reopened, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := appendN(t, reopened, 1)[0]
+	if next.Seq != 4 || next.PrevHash != records[2].Hash {
+		t.Fatalf("after reopening: seq %d, prev %q", next.Seq, next.PrevHash)
+	}
+	if v, _ := reopened.Verify(); !v.OK {
+		t.Fatalf("after reopening: %s", v.Error)
+	}
+}
+
+func TestVerifyTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, db *store.Store, records []*Record)
+	}{
+		{"modified", func(t *testing.T, db *store.Store, records []*Record) {
+			rec := *records[1]
+			rec.Outcome = "rejected: Forbidden"
+			if err := db.Put(recordKey(rec.Seq), rec); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"modified and rehashed", func(t *testing.T, db *store.Store, records []*Record) {
+			rec := *records[1]
+			rec.Path = "/faucet"
+			rec.Hash, _ = rec.digest()
+			if err := db.Put(recordKey(rec.Seq), rec); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"removed", func(t *testing.T, db *store.Store, records []*Record) {
+			if err := db.Delete(recordKey(records[1].Seq)); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"truncated", func(t *testing.T, db *store.Store, records []*Record) {
+			if err := db.Delete(recordKey(records[2].Seq)); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"moved", func(t *testing.T, db *store.Store, records []*Record) {
+			if err := db.Put(recordKey(records[1].Seq), records[0]); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		l, db := newTestLog(t)
+		records := appendN(t, l, 3)
+		tt.tamper(t, db, records)
+		v, err := l.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.OK || !strings.HasPrefix(v.Error, ErrTampered.Error()) {
+			t.Errorf("%s record: verification %+v, want a broken chain", tt.name, v)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l, _ := newTestLog(t)
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			return
+		}
+		if body, _ := io.ReadAll(r.Body); !strings.Contains(string(body), "hunter2") {
+			t.Error("the handler did not get the unredacted body")
+		}
+		Note(r.Context(), EventPolicy, "recipient allowed")
+		l.Transaction(r.Context(), testTx(7))
+		if r.URL.Path == "/auth/keys" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	caller := &auth.Principal{ID: "k1", Role: auth.RoleOperator}
+	request := func(method, path, contentType, body string) {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r = r.WithContext(auth.WithPrincipal(r.Context(), caller))
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	request(http.MethodGet, "/tokens", "", "")
+	if records, _ := l.Query(Filter{Limit: 10}); len(records) != 0 {
+		t.Fatalf("a read was recorded: %+v", records[0])
+	}
+
+	request(http.MethodPost, "/contract/transfer?token=usdc", "application/json", `{"to":"0x1","nested":{"Password":"hunter2"},"secret":"hunter2"}`)
+	request(http.MethodPost, "/auth/keys", "application/json", `{"name":"ci","secret":"hunter2"}`)
+	request(http.MethodPost, "/airdrop", "text/csv", "0x1,hunter2\n")
+	records, err := l.Query(Filter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("recorded %d writes, want 3", len(records))
+	}
+	for _, rec := range records {
+		if strings.Contains(string(rec.Body), "hunter2") {
+			t.Errorf("%s: body %s was not redacted", rec.Path, rec.Body)
+		}
+	}
+
+	transfer := records[2]
+	var body map[string]interface{}
+	if err := json.Unmarshal(transfer.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["to"] != "0x1" || body["secret"] != "[redacted]" {
+		t.Errorf("transfer body %s", transfer.Body)
+	}
+	if transfer.Actor == nil || transfer.Actor.ID != "k1" || transfer.Query != "token=usdc" || transfer.Status != http.StatusOK {
+		t.Errorf("transfer record %+v", transfer)
+	}
+	if len(transfer.TxHashes) != 1 || transfer.TxHashes[0] != testTx(7).Hash().Hex() {
+		t.Errorf("transfer transactions %v", transfer.TxHashes)
+	}
+	if len(transfer.Events) != 2 || transfer.Events[0].Type != EventPolicy || transfer.Events[1].Type != EventTx {
+		t.Errorf("transfer events %+v", transfer.Events)
+	}
+	if refused := records[1]; refused.Status != http.StatusForbidden || refused.Outcome != "rejected: Forbidden" {
+		t.Errorf("refused request: status %d, outcome %q", refused.Status, refused.Outcome)
+	}
+	if upload := records[0]; string(upload.Body) != `"[12 bytes of text/csv]"` {
+		t.Errorf("upload body %s, want a summary", upload.Body)
+	}
+
+	if found, _ := l.Query(Filter{TxHash: testTx(7).Hash().Hex(), Path: "/contract", Limit: 10}); len(found) != 1 || found[0].Seq != transfer.Seq {
+		t.Errorf("query by transaction found %d records", len(found))
+	}
+	if v, _ := l.Verify(); !v.OK {
+		t.Fatalf("verification after requests: %s", v.Error)
+	}
+}
+
+func TestTransactionWithoutRequest(t *testing.T) {
+	l, _ := newTestLog(t)
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "airdrop"})
+	l.Transaction(ctx, testTx(3))
+
+	rec, err := l.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Kind != KindTransaction || rec.Actor.ID != "airdrop" || rec.Outcome != "signed with nonce 3" {
+		t.Errorf("record %+v", rec)
+	}
+	if _, err := l.Get(2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing record: %v, want ErrNotFound", err)
+	}
+	if Note(context.Background(), EventLimit, "outside a request") {
+		t.Error("noted an event without a request")
+	}
+}
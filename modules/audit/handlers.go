@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRecords = 50
+	maxRecords     = 500
+)
+
+// VerifyHandler serves GET /audit/verify, which re-walks the hash chain.
+func (l *Log) VerifyHandler(w http.ResponseWriter, r *http.Request) {
+	v, err := l.Verify()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	status := http.StatusOK
+	if !v.OK {
+		status = http.StatusConflict
+	}
+	api.WriteJSON(w, status, v)
+}
+
+// GetHandler serves GET /audit/{seq}.
+func (l *Log) GetHandler(w http.ResponseWriter, r *http.Request) {
+	seq, err := strconv.ParseUint(router.Param(r, "seq"), 10, 64)
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	rec, err := l.Get(seq)
+	if errors.Is(err, ErrNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, rec)
+}
+
+// QueryHandler serves GET /audit, records newest first. Filters: actor, path, tx_hash,
+// from, to, before.
+func (l *Log) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := Filter{Actor: q.Get("actor"), Path: q.Get("path"), TxHash: q.Get("tx_hash")}
+	var err error
+	if f.Limit, err = api.ParseLimit(q, "limit", defaultRecords, maxRecords); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if f.Before, err = api.ParseUint(q, "before"); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	for name, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		secs, err := api.ParseTime(q, name)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if secs > 0 {
+			*t = time.Unix(int64(secs), 0).UTC()
+		}
+	}
+	records, err := l.Query(f)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, records)
+}
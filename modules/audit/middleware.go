@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxBody is how much of a request body is kept in the record.
+const maxBody = 64 << 10
+
+// redacted are body fields never written to the log.
+var redacted = map[string]bool{"secret": true, "password": true, "private_key": true, "jwt_secret": true, "key": true}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if redacted[strings.ToLower(k)] {
+				v[k] = "[redacted]"
+			} else {
+				v[k] = redact(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redact(child)
+		}
+	}
+	return v
+}
+
+// captureBody returns what to log of a request body and leaves the body readable.
+func captureBody(r *http.Request) json.RawMessage {
+	if r.Body == nil {
+		return nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil || len(buf) == 0 {
+		return nil
+	}
+	summary := func(what string) json.RawMessage {
+		data, _ := json.Marshal(fmt.Sprintf("[%d bytes of %s]", len(buf), what))
+		return data
+	}
+	if len(buf) > maxBody {
+		return summary("oversized body")
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "application/json" {
+		// CSV uploads and ABI files are summarized rather than copied
+		return summary(mediaType)
+	}
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return summary("invalid JSON")
+	}
+	data, err := json.Marshal(redact(v))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// isWrite reports whether a request may change state or move funds. The router only
+// serves those on POST and DELETE.
+func isWrite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// Middleware records every write request once it has been handled. It runs inside the
+// auth middleware, so the caller is known.
+func (l *Log) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWrite(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &Record{
+			Kind:       KindRequest,
+			Time:       start.UTC(),
+			Actor:      auth.FromContext(r.Context()),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Body:       captureBody(r),
+		}
+		c := &collector{}
+		sw := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(withCollector(r.Context(), c)))
+
+		c.mu.Lock()
+		rec.Events, rec.TxHashes = c.events, c.txs
+		c.mu.Unlock()
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		rec.Status = sw.status
+		rec.Outcome = http.StatusText(sw.status)
+		if sw.status >= 400 {
+			rec.Outcome = "rejected: " + rec.Outcome
+		}
+		rec.DurationMS = time.Since(start).Milliseconds()
+		if err := l.Append(rec); err != nil {
+			log.Printf("audit: %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	})
+}
@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Role grants access to a group of endpoints; each role includes the ones below it.
+type Role string
+
+const (
+	RolePublic   Role = ""
+	RoleReader   Role = "reader"   // read-only endpoints
+	RoleOperator Role = "operator" // send transactions
+	RoleAdmin    Role = "admin"    // manage keys, tokens, contracts, webhooks and deployments
+
+	KeyHeader = "X-API-Key"
+)
+
+var (
+	ErrUnauthorized = errors.New("missing or invalid credentials")
+	ErrForbidden    = errors.New("not allowed for this key")
+	ErrInvalidRole  = errors.New("role must be reader, operator or admin")
+	ErrLoopbackOnly = errors.New("authentication is disabled, only loopback clients are served")
+)
+
+var levels = map[Role]int{RolePublic: 0, RoleReader: 1, RoleOperator: 2, RoleAdmin: 3}
+
+func (r Role) valid() bool {
+	return r != RolePublic && levels[r] > 0
+}
+
+// Includes reports whether r grants everything other does.
+func (r Role) Includes(other Role) bool {
+	return levels[r] >= levels[other]
+}
+
+// RequiredRole maps a request to the role it needs. OPTIONS only lists the methods of a
+// route, so it needs no more than a read.
+func RequiredRole(method, path string) Role {
+	read := method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch parts[0] {
+	case "health":
+		return RolePublic
+	case "faucet":
+		// claiming is meant for the public and rate limits itself; the claim ledger holds
+		// the IP of every claimant
+		if len(parts) == 1 && method == http.MethodPost {
+			return RolePublic
+		}
+		return RoleReader
+	case "auth":
+		if len(parts) == 2 && (parts[1] == "token" || parts[1] == "whoami") {
+			return RoleReader
+		}
+		return RoleAdmin
+	case "deploy", "webhooks", "policy", "audit":
+		return RoleAdmin
+	case "tokens":
+		if read {
+			return RoleReader
+		}
+		return RoleAdmin
+	case "contracts":
+		switch {
+		case read, len(parts) == 4 && parts[2] == "call":
+			return RoleReader
+		case len(parts) == 4 && parts[2] == "transact":
+			return RoleOperator
+		}
+		return RoleAdmin
+	case "contract":
+		if len(parts) == 2 && parts[1] == "balances" {
+			return RoleReader
+		}
+	}
+	if read {
+		return RoleReader
+	}
+	return RoleOperator
+}
+
+// Principal is the authenticated caller.
+type Principal struct {
+	ID        string   `json:"id"` // key ID, or the JWT subject
+	Name      string   `json:"name,omitempty"`
+	Role      Role     `json:"role"`
+	Method    string   `json:"method"` // "api_key" or "jwt"
+	Tokens    []string `json:"tokens,omitempty"`
+	MaxAmount string   `json:"max_amount,omitempty"` // raw units, see Key
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the caller, or nil when authentication is disabled.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Asset identifies what a transfer moves, for checking key restrictions.
+type Asset struct {
+	Symbol   string
+	Address  common.Address // zero for ETH
+	Decimals uint8
+}
+
+// ETH is the native asset.
+var ETH = Asset{Symbol: "ETH", Decimals: 18}
+
+// Matches reports whether id, a symbol or address as written in keys and config, names the asset.
+func (a Asset) Matches(id string) bool {
+	if strings.EqualFold(id, a.Symbol) {
+		return true
+	}
+	return a.Address != (common.Address{}) && common.IsHexAddress(id) && common.HexToAddress(id) == a.Address
+}
+
+func (p *Principal) allowsAsset(asset Asset) bool {
+	if len(p.Tokens) == 0 {
+		return true
+	}
+	for _, t := range p.Tokens {
+		if asset.Matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize checks the token and amount restrictions of the caller in ctx. MaxAmount is in
+// raw units, so it reads the same for every asset. A nil amount means it isn't known up
+// front, such as a sweep, and is refused when a maximum is set.
+func Authorize(ctx context.Context, asset Asset, amount *big.Int) error {
+	p := FromContext(ctx)
+	if p == nil {
+		return nil
+	}
+	if !p.allowsAsset(asset) {
+		return fmt.Errorf("%w: %s transfers", ErrForbidden, asset.Symbol)
+	}
+	if p.MaxAmount == "" {
+		return nil
+	}
+	max, err := units.ParseAmount(p.MaxAmount, 0)
+	if err != nil {
+		return fmt.Errorf("%w: bad max_amount %q", ErrForbidden, p.MaxAmount)
+	}
+	if amount == nil || amount.Cmp(max) > 0 {
+		return fmt.Errorf("%w: amount above the %s %s limit", ErrForbidden, units.FormatAmount(max, asset.Decimals), asset.Symbol)
+	}
+	return nil
+}
+
+// AuthorizeContract checks the token restrictions of the caller in ctx for a transaction
+// to a contract registered under name. What the transaction moves, where the gateway can
+// tell, is checked with Authorize on top.
+func AuthorizeContract(ctx context.Context, name string, address common.Address) error {
+	p := FromContext(ctx)
+	if p == nil || p.allowsAsset(Asset{Symbol: name, Address: address}) {
+		return nil
+	}
+	return fmt.Errorf("%w: transactions to %s", ErrForbidden, name)
+}
+
+// HTTPStatus maps auth errors to response status codes.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidName):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrRevoked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Authenticator checks API keys, HMAC signatures and JWTs on every request.
+type Authenticator struct {
+	keys   *Keys
+	cfg    config.Auth
+	nonces *nonceCache
+}
+
+func New(keys *Keys, cfg config.Auth) *Authenticator {
+	return &Authenticator{keys: keys, cfg: cfg, nonces: newNonceCache()}
+}
+
+// credential returns the API key or bearer token of the request.
+func credential(r *http.Request) string {
+	if key := r.Header.Get(KeyHeader); key != "" {
+		return key
+	}
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// Authenticate resolves the caller of r.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.Header.Get(SignatureHeader) != "" {
+		key, err := a.verifySigned(r, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{ID: key.ID, Name: key.Name, Role: key.Role, Method: "hmac", Tokens: key.Tokens, MaxAmount: key.MaxAmount}, nil
+	}
+	cred := credential(r)
+	if cred == "" {
+		if p := a.certPrincipal(r); p != nil {
+			return p, nil
+		}
+	}
+	switch {
+	case cred == "":
+		return nil, ErrUnauthorized
+	case strings.HasPrefix(cred, KeyPrefix):
+		key, err := a.keys.Verify(cred)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{ID: key.ID, Name: key.Name, Role: key.Role, Method: "api_key", Tokens: key.Tokens, MaxAmount: key.MaxAmount}, nil
+	case a.cfg.JWTSecret == "":
+		return nil, ErrUnauthorized
+	}
+	claims, err := ParseJWT([]byte(a.cfg.JWTSecret), cred, a.cfg.JWTIssuer, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	return &Principal{ID: claims.Subject, Role: claims.Role, Method: "jwt", Tokens: claims.Tokens, MaxAmount: claims.MaxAmount}, nil
+}
+
+// certPrincipal maps the verified TLS client certificate of r to a caller, or returns nil
+// when there is none or its subject isn't configured.
+func (a *Authenticator) certPrincipal(r *http.Request) *Principal {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	for _, c := range a.cfg.ClientCerts {
+		if c.Subject != subject.CommonName && c.Subject != subject.String() {
+			continue
+		}
+		role := Role(c.Role)
+		if !role.valid() {
+			log.Printf("auth: client cert %q has invalid role %q", c.Subject, c.Role)
+			return nil
+		}
+		return &Principal{ID: "cert:" + subject.CommonName, Name: subject.String(), Role: role, Method: "mtls", Tokens: c.Tokens, MaxAmount: c.MaxAmount}
+	}
+	return nil
+}
+
+// loopbackOnly serves next to clients connecting from a loopback address and refuses
+// everyone else. Forwarding headers are ignored, a local proxy has to authenticate.
+func loopbackOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			api.WriteError(w, http.StatusForbidden, ErrLoopbackOnly)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware rejects requests whose caller lacks the role of the endpoint and passes the
+// caller on in the request context. When authentication is disabled it only serves
+// loopback clients, without checking roles.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	if !a.cfg.IsEnabled() {
+		log.Printf("WARNING: auth: authentication is disabled, every endpoint is open to local callers; only loopback clients are served")
+		return loopbackOnly(next)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required := RequiredRole(r.Method, r.URL.Path)
+		p, err := a.Authenticate(r)
+		if err != nil && required == RolePublic {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			status := HTTPStatus(err)
+			if status == http.StatusInternalServerError {
+				log.Printf("auth: %v", err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			api.WriteError(w, status, err)
+			return
+		}
+		if !p.Role.Includes(required) {
+			api.WriteError(w, http.StatusForbidden, fmt.Errorf("%w: requires the %s role", ErrForbidden, required))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestKeys(t *testing.T, pepper string) *Keys {
+	t.Helper()
+	db, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewKeys(db, pepper)
+}
+
+// echoCaller answers with the role of the caller, or "none" without one.
+var echoCaller = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if p := FromContext(r.Context()); p != nil {
+		w.Write([]byte(string(p.Role) + " " + p.Method))
+		return
+	}
+	w.Write([]byte("none"))
+})
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRequiredRole(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         Role
+	}{
+		{http.MethodGet, "/health", RolePublic},
+		{http.MethodPost, "/faucet", RolePublic},
+		{http.MethodGet, "/faucet", RoleReader},
+		{http.MethodGet, "/faucet/claims", RoleReader},
+		{http.MethodPost, "/faucet/claims", RoleReader},
+		{http.MethodGet, "/auth/whoami", RoleReader},
+		{http.MethodPost, "/auth/token", RoleReader},
+		{http.MethodGet, "/auth/keys", RoleAdmin},
+		{http.MethodGet, "/deploy", RoleAdmin},
+		{http.MethodGet, "/tokens", RoleReader},
+		{http.MethodHead, "/tokens", RoleReader},
+		{http.MethodOptions, "/tokens", RoleReader},
+		{http.MethodOptions, "/contract/transfer", RoleReader},
+		{http.MethodOptions, "/webhooks", RoleAdmin},
+		{http.MethodPost, "/tokens", RoleAdmin},
+		{http.MethodPost, "/contracts/usdc/call/balanceOf", RoleReader},
+		{http.MethodPost, "/contracts/usdc/transact/transfer", RoleOperator},
+		{http.MethodPost, "/contracts", RoleAdmin},
+		{http.MethodPost, "/contract/balances", RoleReader},
+		{http.MethodPost, "/contract/transfer", RoleOperator},
+		{http.MethodGet, "/contract/holders", RoleReader},
+	}
+	for _, tt := range tests {
+		if got := RequiredRole(tt.method, tt.path); got != tt.want {
+			t.Errorf("RequiredRole(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDisabledServesLoopbackOnly(t *testing.T) {
+	disabled := false
+	h := New(newTestKeys(t, ""), config.Auth{Enabled: &disabled}).Middleware(echoCaller)
+
+	for addr, want := range map[string]int{
+		"127.0.0.1:5000": http.StatusOK,
+		"[::1]:5000":     http.StatusOK,
+		"10.0.0.8:5000":  http.StatusForbidden,
+		"192.0.2.1:5000": http.StatusForbidden,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/contract/transfer", nil)
+		r.RemoteAddr = addr
+		// forwarding headers can't make a remote client look local
+		r.Header.Set("X-Forwarded-For", "127.0.0.1")
+		if w := serve(h, r); w.Code != want {
+			t.Errorf("from %s: status %d, want %d", addr, w.Code, want)
+		}
+	}
+}
+
+func TestEnabledByDefault(t *testing.T) {
+	if !(config.Auth{}).IsEnabled() {
+		t.Fatal("auth is off without an enabled setting")
+	}
+	keys := newTestKeys(t, "")
+	h := New(keys, config.Auth{}).Middleware(echoCaller)
+
+	r := httptest.NewRequest(http.MethodGet, "/tokens", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	w := serve(h, r)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("anonymous read: status %d, want 401 with a challenge", w.Code)
+	}
+	if w := serve(h, httptest.NewRequest(http.MethodPost, "/faucet", nil)); w.Code != http.StatusOK || w.Body.String() != "none" {
+		t.Fatalf("anonymous faucet claim: status %d %q, want it served", w.Code, w.Body)
+	}
+	if w := serve(h, httptest.NewRequest(http.MethodGet, "/faucet/claims", nil)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous claim ledger: status %d, want 401", w.Code)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	keys := newTestKeys(t, "")
+	h := New(keys, config.Auth{}).Middleware(echoCaller)
+	reader, readerFull, err := keys.Create(Key{Name: "dashboard", Role: RoleReader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, operatorFull, err := keys.Create(Key{Name: "payments", Role: RoleOperator})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, path, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set(KeyHeader, key)
+		return serve(h, r)
+	}
+	if w := request(http.MethodGet, "/tokens", readerFull); w.Code != http.StatusOK || w.Body.String() != "reader api_key" {
+		t.Errorf("reader read: status %d %q", w.Code, w.Body)
+	}
+	if w := request(http.MethodPost, "/contract/transfer", readerFull); w.Code != http.StatusForbidden {
+		t.Errorf("reader transfer: status %d, want 403", w.Code)
+	}
+	if w := request(http.MethodPost, "/contract/transfer", operatorFull); w.Code != http.StatusOK {
+		t.Errorf("operator transfer: status %d, want 200", w.Code)
+	}
+	if w := request(http.MethodPost, "/tokens", operatorFull); w.Code != http.StatusForbidden {
+		t.Errorf("operator adding a token: status %d, want 403", w.Code)
+	}
+	if w := request(http.MethodGet, "/tokens", readerFull+"0"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: status %d, want 401", w.Code)
+	}
+
+	_, rotatedFull, err := keys.Rotate(reader.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := request(http.MethodGet, "/tokens", readerFull); w.Code != http.StatusUnauthorized {
+		t.Errorf("key before rotation: status %d, want 401", w.Code)
+	}
+	if w := request(http.MethodGet, "/tokens", rotatedFull); w.Code != http.StatusOK {
+		t.Errorf("rotated key: status %d, want 200", w.Code)
+	}
+	if _, err := keys.Revoke(reader.ID); err != nil {
+		t.Fatal(err)
+	}
+	if w := request(http.MethodGet, "/tokens", rotatedFull); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want 401", w.Code)
+	}
+	if _, _, err := keys.Rotate(reader.ID); !errors.Is(err, ErrRevoked) {
+		t.Errorf("rotating a revoked key: %v, want ErrRevoked", err)
+	}
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("jwt-secret")
+	h := New(newTestKeys(t, ""), config.Auth{JWTSecret: string(secret), JWTIssuer: "issuer"}).Middleware(echoCaller)
+	token := func(claims Claims) string {
+		s, err := SignJWT(secret, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	now := time.Now()
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"valid", token(Claims{Subject: "svc", Role: RoleOperator, Issuer: "issuer", ExpiresAt: now.Add(time.Minute).Unix()}), http.StatusOK},
+		{"expired", token(Claims{Subject: "svc", Role: RoleOperator, Issuer: "issuer", ExpiresAt: now.Add(-time.Minute).Unix()}), http.StatusUnauthorized},
+		{"other issuer", token(Claims{Subject: "svc", Role: RoleOperator, Issuer: "other", ExpiresAt: now.Add(time.Minute).Unix()}), http.StatusUnauthorized},
+		{"reader", token(Claims{Subject: "svc", Role: RoleReader, Issuer: "issuer", ExpiresAt: now.Add(time.Minute).Unix()}), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/contract/transfer", nil)
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		if w := serve(h, r); w.Code != tt.status {
+			t.Errorf("%s token: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	usdc := Asset{Symbol: "USDC", Address: common.HexToAddress("0x00000000000000000000000000000000000000aa"), Decimals: 6}
+	ctx := WithPrincipal(context.Background(), &Principal{ID: "k", Role: RoleOperator, Tokens: []string{"usdc"}, MaxAmount: "100000000"})
+
+	if err := Authorize(context.Background(), ETH, nil); err != nil {
+		t.Errorf("without a caller: %v", err)
+	}
+	if err := Authorize(ctx, usdc, big.NewInt(100e6)); err != nil {
+		t.Errorf("allowed token at the maximum: %v", err)
+	}
+	if err := Authorize(ctx, usdc, big.NewInt(100e6+1)); !errors.Is(err, ErrForbidden) {
+		t.Errorf("above the maximum: %v, want ErrForbidden", err)
+	}
+	if err := Authorize(ctx, usdc, nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("unknown amount with a maximum: %v, want ErrForbidden", err)
+	}
+	if err := Authorize(ctx, ETH, big.NewInt(1)); !errors.Is(err, ErrForbidden) {
+		t.Errorf("token not on the key: %v, want ErrForbidden", err)
+	}
+	// max_amount is in raw units, a decimal one is never valid
+	decimal := WithPrincipal(context.Background(), &Principal{ID: "k", MaxAmount: "1.5"})
+	if err := Authorize(decimal, ETH, big.NewInt(1)); !errors.Is(err, ErrForbidden) {
+		t.Errorf("decimal max_amount: %v, want ErrForbidden", err)
+	}
+
+	byAddress := WithPrincipal(context.Background(), &Principal{Tokens: []string{usdc.Address.Hex()}})
+	if err := AuthorizeContract(byAddress, "usdc-contract", usdc.Address); err != nil {
+		t.Errorf("contract by address: %v", err)
+	}
+	if err := AuthorizeContract(byAddress, "other", common.HexToAddress("0xbb")); !errors.Is(err, ErrForbidden) {
+		t.Errorf("contract not on the key: %v, want ErrForbidden", err)
+	}
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"net/http"
+	"time"
+)
+
+const defaultTokenTTL = 15 * time.Minute
+
+type createRequest struct {
+	Name      string   `json:"name"`
+	Role      Role     `json:"role"`
+	Tokens    []string `json:"tokens"`
+	MaxAmount string   `json:"max_amount"`
+}
+
+// keyResponse carries the full key and its signing secret, which are only ever returned
+// by create and rotate.
+type keyResponse struct {
+	*Key
+	Secret        string `json:"key"`
+	SigningSecret string `json:"signing_secret,omitempty"` // for HMAC-signed requests, when a pepper is configured
+}
+
+func (a *Authenticator) keyResponse(key *Key, secret string) keyResponse {
+	signing, _ := a.keys.SigningSecret(key)
+	return keyResponse{Key: key, Secret: secret, SigningSecret: signing}
+}
+
+type tokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WhoamiHandler serves GET /auth/whoami, the caller.
+func (a *Authenticator) WhoamiHandler(w http.ResponseWriter, r *http.Request) {
+	p := FromContext(r.Context())
+	if p == nil {
+		api.WriteError(w, http.StatusNotFound, errors.New("authentication is disabled"))
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, p)
+}
+
+// ListKeysHandler serves GET /auth/keys.
+func (a *Authenticator) ListKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.keys.List()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, keys)
+}
+
+// GetKeyHandler serves GET /auth/keys/{id}.
+func (a *Authenticator) GetKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := a.keys.Get(router.Param(r, "id"))
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, key)
+}
+
+// RevokeKeyHandler serves DELETE /auth/keys/{id}.
+func (a *Authenticator) RevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := a.keys.Revoke(router.Param(r, "id"))
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, key)
+}
+
+// RotateKeyHandler serves POST /auth/keys/{id}/rotate, which replaces the secret of a key
+// and returns the new key.
+func (a *Authenticator) RotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, secret, err := a.keys.Rotate(router.Param(r, "id"))
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, a.keyResponse(key, secret))
+}
+
+// CreateKeyHandler serves POST /auth/keys {"name", "role", "tokens", "max_amount"}. The key
+// is only returned here. max_amount is an integer in raw units.
+func (a *Authenticator) CreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var body createRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.MaxAmount != "" {
+		if _, err := api.NonNegativeAmount("max_amount", body.MaxAmount, 0); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	key, secret, err := a.keys.Create(Key{Name: body.Name, Role: body.Role, Tokens: body.Tokens, MaxAmount: body.MaxAmount})
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, a.keyResponse(key, secret))
+}
+
+// TokenHandler serves POST /auth/token. It issues a JWT with the caller's role and
+// restrictions, so clients can avoid sending the long-lived key on every request. Only API
+// keys, sent or used to sign, can be exchanged, otherwise a token could be refreshed forever
+// after its key was revoked.
+func (a *Authenticator) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	p := FromContext(r.Context())
+	if p == nil || a.cfg.JWTSecret == "" {
+		api.WriteError(w, http.StatusNotFound, errors.New("token issuing is not configured"))
+		return
+	}
+	if p.Method != "api_key" && p.Method != "hmac" {
+		api.WriteError(w, http.StatusForbidden, fmt.Errorf("%w: tokens are only issued for api keys", ErrForbidden))
+		return
+	}
+	ttl := time.Duration(a.cfg.TokenTTL)
+	if ttl <= 0 {
+		ttl = defaultTokenTTL
+	}
+	now := time.Now()
+	claims := Claims{
+		Subject:   p.ID,
+		Issuer:    a.cfg.JWTIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+		Role:      p.Role,
+		Tokens:    p.Tokens,
+		MaxAmount: p.MaxAmount,
+	}
+	token, err := SignJWT([]byte(a.cfg.JWTSecret), claims)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, tokenResponse{Token: token, ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC()})
+}
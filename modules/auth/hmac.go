@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of an HMAC-signed request. The signature is the hex HMAC-SHA256 of
+//
+//	<method>\n<path and query>\n<timestamp>\n<nonce>\n<body digest>
+//
+// keyed with the signing secret returned next to the API key on create and rotate. Neither
+// is sent, so they can't leak into proxy or access logs.
+const (
+	KeyIDHeader     = "X-Key-ID"
+	TimestampHeader = "X-Timestamp"      // unix seconds
+	NonceHeader     = "X-Nonce"          // unique per request, 16 to 128 characters
+	DigestHeader    = "X-Content-SHA256" // hex SHA-256 of the body, of nothing when it is empty
+	SignatureHeader = "X-Signature"
+
+	defaultSignatureSkew = 5 * time.Minute
+	maxSignedBody        = 32 << 20
+)
+
+func stringToSign(method, uri, timestamp, nonce, digest string) string {
+	return strings.Join([]string{method, uri, timestamp, nonce, digest}, "\n")
+}
+
+func sign(key []byte, s string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// SignRequest adds the signature headers for key ID id and its signing secret to r, for
+// services calling the API from Go. It reads the body and puts it back.
+func SignRequest(r *http.Request, id, signingSecret string, now time.Time) error {
+	var body []byte
+	var err error
+	if r.Body != nil {
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonce := randomHex(16)
+	sum := digest(body)
+	r.Header.Set(KeyIDHeader, id)
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(NonceHeader, nonce)
+	r.Header.Set(DigestHeader, sum)
+	r.Header.Set(SignatureHeader, sign([]byte(signingSecret), stringToSign(r.Method, r.URL.RequestURI(), timestamp, nonce, sum)))
+	return nil
+}
+
+// nonceCache remembers the nonces of signed requests until their timestamp falls out of
+// the allowed skew, after which a replay is refused for its age anyway.
+type nonceCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextPrune time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: map[string]time.Time{}}
+}
+
+// use records nonce until expires and reports whether it was new.
+func (c *nonceCache) use(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.After(c.nextPrune) {
+		for n, exp := range c.seen {
+			if now.After(exp) {
+				delete(c.seen, n)
+			}
+		}
+		c.nextPrune = now.Add(time.Minute)
+	}
+	if exp, ok := c.seen[nonce]; ok && !now.After(exp) {
+		return false
+	}
+	c.seen[nonce] = expires
+	return true
+}
+
+func signatureError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrUnauthorized, fmt.Sprintf(format, args...))
+}
+
+// verifySigned checks the signature headers of r and returns the key that signed it.
+func (a *Authenticator) verifySigned(r *http.Request, now time.Time) (*Key, error) {
+	id, timestamp, nonce := r.Header.Get(KeyIDHeader), r.Header.Get(TimestampHeader), r.Header.Get(NonceHeader)
+	sum, signature := r.Header.Get(DigestHeader), r.Header.Get(SignatureHeader)
+	for name, v := range map[string]string{KeyIDHeader: id, TimestampHeader: timestamp, NonceHeader: nonce, DigestHeader: sum} {
+		if v == "" {
+			return nil, signatureError("missing %s header", name)
+		}
+	}
+	if len(nonce) < 16 || len(nonce) > 128 {
+		return nil, signatureError("nonce must be 16 to 128 characters")
+	}
+
+	skew := time.Duration(a.cfg.SignatureSkew)
+	if skew <= 0 {
+		skew = defaultSignatureSkew
+	}
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, signatureError("invalid timestamp %q", timestamp)
+	}
+	signedAt := time.Unix(secs, 0)
+	if signedAt.Before(now.Add(-skew)) || signedAt.After(now.Add(skew)) {
+		return nil, signatureError("timestamp is more than %s off", skew)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		if body, err = io.ReadAll(io.LimitReader(r.Body, maxSignedBody+1)); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if len(body) > maxSignedBody {
+		return nil, signatureError("body is larger than %d bytes", maxSignedBody)
+	}
+	if !hmac.Equal([]byte(strings.ToLower(sum)), []byte(digest(body))) {
+		return nil, signatureError("body does not match %s", DigestHeader)
+	}
+
+	key, err := a.keys.Get(id)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	secret, err := a.keys.SigningSecret(key)
+	if err != nil {
+		return nil, signatureError("%v", err)
+	}
+	expected := sign([]byte(secret), stringToSign(r.Method, r.URL.RequestURI(), timestamp, nonce, sum))
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return nil, signatureError("signature mismatch")
+	}
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, ErrRevoked)
+	}
+	if !a.nonces.use(id+":"+nonce, signedAt.Add(skew), now) {
+		return nil, signatureError("nonce has already been used")
+	}
+	return key, nil
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPepper = "pepper"
+
+// signedRequest returns a POST /contract/transfer signed at now with secret.
+func signedRequest(t *testing.T, id, secret, body string, now time.Time) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/contract/transfer?token=usdc", strings.NewReader(body))
+	if err := SignRequest(r, id, secret, now); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func newSigningKey(t *testing.T, keys *Keys) (*Key, string) {
+	t.Helper()
+	key, _, err := keys.Create(Key{Name: "signer", Role: RoleOperator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := keys.SigningSecret(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, secret
+}
+
+func TestSignedRequest(t *testing.T) {
+	keys := newTestKeys(t, testPepper)
+	a := New(keys, config.Auth{})
+	h := a.Middleware(echoCaller)
+	key, secret := newSigningKey(t, keys)
+
+	r := signedRequest(t, key.ID, secret, `{"to":"0x1","amount":"1"}`, time.Now())
+	if w := serve(h, r); w.Code != http.StatusOK || w.Body.String() != "operator hmac" {
+		t.Fatalf("signed request: status %d %q", w.Code, w.Body)
+	}
+	// the nonce was used
+	replay := signedRequest(t, key.ID, secret, `{"to":"0x1","amount":"1"}`, time.Now())
+	replay.Header.Set(NonceHeader, r.Header.Get(NonceHeader))
+	replay.Header.Set(SignatureHeader, r.Header.Get(SignatureHeader))
+	replay.Header.Set(TimestampHeader, r.Header.Get(TimestampHeader))
+	if w := serve(h, replay); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed request: status %d, want 401", w.Code)
+	}
+}
+
+func TestSignedRequestRejected(t *testing.T) {
+	keys := newTestKeys(t, testPepper)
+	a := New(keys, config.Auth{SignatureSkew: config.Duration(time.Minute)})
+	key, secret := newSigningKey(t, keys)
+	stored, err := keys.Get(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		modify func(r *http.Request) *http.Request
+	}{
+		{"stale timestamp", func(*http.Request) *http.Request {
+			return signedRequest(t, key.ID, secret, "{}", now.Add(-2*time.Minute))
+		}},
+		{"future timestamp", func(*http.Request) *http.Request {
+			return signedRequest(t, key.ID, secret, "{}", now.Add(2*time.Minute))
+		}},
+		{"tampered body", func(r *http.Request) *http.Request {
+			tampered := httptest.NewRequest(r.Method, r.URL.String(), strings.NewReader(`{"amount":"1000"}`))
+			tampered.Header = r.Header
+			return tampered
+		}},
+		{"tampered query", func(r *http.Request) *http.Request {
+			r.URL.RawQuery = "token=eth"
+			r.RequestURI = r.URL.RequestURI()
+			return r
+		}},
+		{"signed with the stored hash", func(*http.Request) *http.Request {
+			return signedRequest(t, key.ID, stored.Hash, "{}", now)
+		}},
+		{"signed with the salt", func(*http.Request) *http.Request {
+			return signedRequest(t, key.ID, stored.Salt, "{}", now)
+		}},
+		{"unknown key", func(*http.Request) *http.Request {
+			return signedRequest(t, "0000000000000000", secret, "{}", now)
+		}},
+		{"short nonce", func(r *http.Request) *http.Request {
+			r.Header.Set(NonceHeader, "short")
+			return r
+		}},
+		{"missing digest", func(r *http.Request) *http.Request {
+			r.Header.Del(DigestHeader)
+			return r
+		}},
+	}
+	for _, tt := range tests {
+		r := tt.modify(signedRequest(t, key.ID, secret, "{}", now))
+		if _, err := a.verifySigned(r, now); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: %v, want ErrUnauthorized", tt.name, err)
+		}
+	}
+}
+
+func TestSigningSecret(t *testing.T) {
+	keys := newTestKeys(t, testPepper)
+	key, secret := newSigningKey(t, keys)
+	if secret == key.Hash || secret == key.Salt || len(secret) != 64 {
+		t.Fatalf("signing secret %q is not a derived HMAC", secret)
+	}
+	again, _ := keys.SigningSecret(key)
+	if again != secret {
+		t.Fatal("signing secret is not stable")
+	}
+	if other, _ := NewKeys(nil, "other pepper").SigningSecret(key); other == secret {
+		t.Fatal("signing secret does not depend on the pepper")
+	}
+
+	// without a pepper signed requests are refused, whatever the key
+	unpeppered := NewKeys(nil, "")
+	if _, err := unpeppered.SigningSecret(key); !errors.Is(err, ErrNoSigning) {
+		t.Fatalf("without a pepper: %v, want ErrNoSigning", err)
+	}
+	a := New(NewKeys(keys.store, ""), config.Auth{})
+	if _, err := a.verifySigned(signedRequest(t, key.ID, secret, "{}", time.Now()), time.Now()); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("signed request without a pepper: %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestSigningSecretRotation(t *testing.T) {
+	keys := newTestKeys(t, testPepper)
+	a := New(keys, config.Auth{})
+	key, secret := newSigningKey(t, keys)
+
+	rotated, _, err := keys.Rotate(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSecret, err := keys.SigningSecret(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newSecret == secret {
+		t.Fatal("rotation kept the signing secret")
+	}
+	now := time.Now()
+	if _, err := a.verifySigned(signedRequest(t, key.ID, secret, "{}", now), now); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("secret before rotation: %v, want ErrUnauthorized", err)
+	}
+	if _, err := a.verifySigned(signedRequest(t, key.ID, newSecret, "{}", now), now); err != nil {
+		t.Errorf("rotated secret: %v", err)
+	}
+
+	if _, err := keys.Revoke(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.verifySigned(signedRequest(t, key.ID, newSecret, "{}", now), now); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("revoked key: %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	c := newNonceCache()
+	now := time.Unix(1700000000, 0)
+	if !c.use("k:n", now.Add(time.Minute), now) {
+		t.Fatal("fresh nonce refused")
+	}
+	if c.use("k:n", now.Add(time.Minute), now.Add(30*time.Second)) {
+		t.Fatal("nonce reused within its window")
+	}
+	if !c.use("k:n", now.Add(3*time.Minute), now.Add(2*time.Minute)) {
+		t.Fatal("expired nonce still remembered")
+	}
+}
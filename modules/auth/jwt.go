@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var errBadToken = errors.New("invalid bearer token")
+
+// Claims are the JWT claims understood by the service. Role, Tokens and MaxAmount carry
+// the same meaning as on an API key.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	Role      Role     `json:"role"`
+	Tokens    []string `json:"tokens,omitempty"`
+	MaxAmount string   `json:"max_amount,omitempty"`
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func signHS256(secret []byte, input string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignJWT returns an HS256 JWT for the claims.
+func SignJWT(secret []byte, claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return input + "." + signHS256(secret, input), nil
+}
+
+// ParseJWT verifies an HS256 JWT and its time claims. Other algorithms are rejected, so
+// a token can't downgrade itself to "none".
+func ParseJWT(secret []byte, token, issuer string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errBadToken
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errBadToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return nil, errBadToken
+	}
+	want := signHS256(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(want), []byte(parts[2])) {
+		return nil, errBadToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errBadToken
+	}
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, errBadToken
+	}
+	switch {
+	case c.ExpiresAt == 0 || now.Unix() >= c.ExpiresAt:
+		return nil, errors.New("bearer token expired")
+	case c.NotBefore != 0 && now.Unix() < c.NotBefore:
+		return nil, errors.New("bearer token not valid yet")
+	case issuer != "" && c.Issuer != issuer:
+		return nil, errBadToken
+	case !c.Role.valid():
+		return nil, errBadToken
+	}
+	return &c, nil
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"strings"
+	"time"
+)
+
+// KeyPrefix starts every API key, so keys can be told apart from JWTs and spotted in logs.
+const KeyPrefix = "tsk_"
+
+var (
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrRevoked     = errors.New("api key has been revoked")
+	ErrInvalidName = errors.New("key name must not be empty")
+	ErrNoSigning   = errors.New("request signing is not set up for this key")
+)
+
+// Key is a stored API key. Only the SHA-256 of the secret is kept; the full key is
+// returned once, when the key is created or rotated, together with its signing secret.
+type Key struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      Role       `json:"role"`
+	Tokens    []string   `json:"tokens,omitempty"`     // symbols or addresses, "ETH" for native transfers; any when empty
+	MaxAmount string     `json:"max_amount,omitempty"` // per transfer in raw units (wei for ETH), pair it with Tokens; unlimited when empty
+	Hash      string     `json:"-"`
+	Salt      string     `json:"-"` // derives the signing secret, see Keys.SigningSecret
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// storedKey includes the hash and salt, which Key hides from API responses.
+type storedKey struct {
+	Key
+	Hash string `json:"hash"`
+	Salt string `json:"salt,omitempty"`
+}
+
+// Keys stores API keys under u/k/<id>. Signing secrets are derived from a random salt per
+// key and pepper, which is kept out of the store, so a copy of the store can neither
+// recover them nor sign requests.
+type Keys struct {
+	store  *store.Store
+	pepper string
+}
+
+func NewKeys(db *store.Store, pepper string) *Keys {
+	return &Keys{store: db, pepper: pepper}
+}
+
+func keyKey(id string) []byte {
+	return []byte("u/k/" + id)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretFor returns a new secret for the key and the full key string handed to the client.
+func secretFor(id string) (secret, full string) {
+	secret = randomHex(32)
+	return secret, KeyPrefix + id + "_" + secret
+}
+
+// Create stores a new key and returns it with the full key string.
+func (k *Keys) Create(key Key) (*Key, string, error) {
+	key.Name = strings.TrimSpace(key.Name)
+	if key.Name == "" {
+		return nil, "", ErrInvalidName
+	}
+	if !key.Role.valid() {
+		return nil, "", fmt.Errorf("%w %q", ErrInvalidRole, key.Role)
+	}
+	key.ID = randomHex(8)
+	key.CreatedAt = time.Now().UTC()
+	key.RotatedAt, key.RevokedAt = nil, nil
+	secret, full := secretFor(key.ID)
+	key.Hash, key.Salt = hashSecret(secret), randomHex(32)
+	if err := k.put(&key); err != nil {
+		return nil, "", err
+	}
+	return &key, full, nil
+}
+
+func (k *Keys) put(key *Key) error {
+	return k.store.Put(keyKey(key.ID), storedKey{Key: *key, Hash: key.Hash, Salt: key.Salt})
+}
+
+// SigningSecret returns the secret that signs requests for key. It is never the stored
+// hash, which anyone reading the store could use to forge signatures.
+func (k *Keys) SigningSecret(key *Key) (string, error) {
+	if k.pepper == "" || key.Salt == "" {
+		return "", ErrNoSigning
+	}
+	mac := hmac.New(sha256.New, []byte(k.pepper))
+	mac.Write([]byte(key.ID + "\n" + key.Salt))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (k *Keys) Get(id string) (*Key, error) {
+	var s storedKey
+	if err := k.store.Get(keyKey(id), &s); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	s.Key.Hash, s.Key.Salt = s.Hash, s.Salt
+	return &s.Key, nil
+}
+
+// List returns every key, revoked ones included.
+func (k *Keys) List() ([]*Key, error) {
+	keys := []*Key{}
+	var decodeErr error
+	err := k.store.Iterate([]byte("u/k/"), nil, nil, false, func(_, value []byte) bool {
+		var s storedKey
+		if decodeErr = json.Unmarshal(value, &s); decodeErr != nil {
+			return false
+		}
+		s.Key.Hash, s.Key.Salt = s.Hash, s.Salt
+		keys = append(keys, &s.Key)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, decodeErr
+}
+
+// Rotate replaces the secret and signing secret of a key; the old ones stop working
+// immediately.
+func (k *Keys) Rotate(id string) (*Key, string, error) {
+	key, err := k.Get(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if key.RevokedAt != nil {
+		return nil, "", ErrRevoked
+	}
+	secret, full := secretFor(key.ID)
+	now := time.Now().UTC()
+	key.Hash, key.Salt, key.RotatedAt = hashSecret(secret), randomHex(32), &now
+	if err := k.put(key); err != nil {
+		return nil, "", err
+	}
+	return key, full, nil
+}
+
+// Revoke disables a key. It is kept so the ID still resolves in logs and audits.
+func (k *Keys) Revoke(id string) (*Key, error) {
+	key, err := k.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		if err := k.put(key); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Verify returns the key for a full key string.
+func (k *Keys) Verify(full string) (*Key, error) {
+	rest := strings.TrimPrefix(full, KeyPrefix)
+	parts := strings.SplitN(rest, "_", 2)
+	if rest == full || len(parts) != 2 {
+		return nil, ErrUnauthorized
+	}
+	key, err := k.Get(parts[0])
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(parts[1])), []byte(key.Hash)) != 1 {
+		return nil, ErrUnauthorized
+	}
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, ErrRevoked)
+	}
+	return key, nil
+}
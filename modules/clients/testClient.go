@@ -3,14 +3,105 @@ package clients
 import (
 	"fmt"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"io"
 	"log"
+	"net/http"
+	"sync"
 )
 
+const (
+	rpcURL = "https://ropsten.infura.io/v3/66cd8456047a4527af2703f9ebd26c0e"
+	wsURL  = "wss://ropsten.infura.io/ws/v3/66cd8456047a4527af2703f9ebd26c0e"
+)
+
+var (
+	mu       sync.Mutex
+	inFlight chan struct{} // nil when RPC calls aren't capped
+)
+
+// LimitInFlight caps the JSON-RPC calls over HTTP in flight at once, across every client
+// created afterwards, so bursts of API requests queue here instead of exhausting the
+// provider's quota. n <= 0 removes the cap. The cap is applied at the HTTP transport, so
+// nothing sent over GetWSClient is counted: neither the stream hub's subscriptions nor the
+// log queries it makes over the same connection to replay missed events.
+func LimitInFlight(n int) {
+	mu.Lock()
+	defer mu.Unlock()
+	if n <= 0 {
+		inFlight = nil
+		return
+	}
+	inFlight = make(chan struct{}, n)
+}
+
+// limitedTransport holds a slot of sem from sending a request until its response body is closed.
+type limitedTransport struct {
+	sem chan struct{}
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case t.sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		<-t.sem
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { <-t.sem }}
+	return resp, nil
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func dialRPC() (*rpc.Client, error) {
+	mu.Lock()
+	sem := inFlight
+	mu.Unlock()
+	if sem == nil {
+		return rpc.Dial(rpcURL)
+	}
+	return rpc.DialHTTPWithClient(rpcURL, &http.Client{Transport: &limitedTransport{sem: sem}})
+}
+
 func GetClient() *ethclient.Client {
-	client, err := ethclient.Dial("https://ropsten.infura.io/v3/66cd8456047a4527af2703f9ebd26c0e")
+	rpcClient, err := dialRPC()
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Println("client created")
+	return ethclient.NewClient(rpcClient)
+}
+
+// GetWSClient returns a client over websocket, which is required for log subscriptions.
+// Calls over it bypass LimitInFlight.
+func GetWSClient() *ethclient.Client {
+	client, err := ethclient.Dial(wsURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("websocket client created")
+	return client
+}
+
+// GetRPCClient returns the raw JSON-RPC client, for batch requests.
+func GetRPCClient() *rpc.Client {
+	client, err := dialRPC()
+	if err != nil {
+		log.Fatal(err)
+	}
 	return client
 }
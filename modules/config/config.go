@@ -0,0 +1,253 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/constants"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Token struct {
+	Symbol     string `json:"symbol,omitempty"`
+	Address    string `json:"address"`
+	StartBlock uint64 `json:"start_block,omitempty"` // first block scanned by the event indexer
+}
+
+// Duration is a time.Duration written as a string such as "24h" in the config file.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Faucet configures the /faucet endpoint. Amounts are in token or ether units; an empty
+// amount is not dispensed. Claims are refused once a balance would drop below its minimum.
+type Faucet struct {
+	Enabled         bool     `json:"enabled"`
+	Token           string   `json:"token,omitempty"` // symbol or address, the default token when empty
+	TokenAmount     string   `json:"token_amount,omitempty"`
+	EthAmount       string   `json:"eth_amount,omitempty"`
+	Cooldown        Duration `json:"cooldown,omitempty"`    // between claims for the same address, 24h when empty
+	IPCooldown      Duration `json:"ip_cooldown,omitempty"` // between claims from the same client IP, 1h when empty
+	MinTokenBalance string   `json:"min_token_balance,omitempty"`
+	MinEthBalance   string   `json:"min_eth_balance,omitempty"`
+	TrustProxy      bool     `json:"trust_proxy,omitempty"` // take the client IP from the last X-Forwarded-For hop, added by the proxy
+}
+
+// Threshold is a token float the monitor keeps an eye on.
+type Threshold struct {
+	Token      string `json:"token,omitempty"` // symbol or address, the default token when empty
+	MinBalance string `json:"min_balance"`     // in token units
+}
+
+// Monitor configures the hot wallet balance monitor. Alerts are logged and posted to
+// Webhooks, signed like event webhooks when WebhookSecret is set.
+type Monitor struct {
+	Enabled       bool        `json:"enabled"`
+	Interval      Duration    `json:"interval,omitempty"` // between checks, 1m when empty
+	Repeat        Duration    `json:"repeat,omitempty"`   // re-alert while still low, 1h when empty
+	MinEthBalance string      `json:"min_eth_balance,omitempty"`
+	MinTransfers  uint64      `json:"min_transfers,omitempty"` // alert when the ETH left funds fewer token transfers
+	TransferGas   uint64      `json:"transfer_gas,omitempty"`  // gas per token transfer for the estimate, 65000 when 0
+	Tokens        []Threshold `json:"tokens,omitempty"`
+	Webhooks      []string    `json:"webhooks,omitempty"`
+	WebhookSecret string      `json:"webhook_secret,omitempty"`
+}
+
+// Auth configures API authentication. Keys are managed under /auth/keys or with the
+// "auth create-key" command; JWTs are HS256 signed with JWTSecret. It is on unless
+// Enabled is explicitly false.
+type Auth struct {
+	Enabled       *bool        `json:"enabled,omitempty"`
+	JWTSecret     string       `json:"jwt_secret,omitempty"`     // bearer JWTs are rejected when empty
+	JWTIssuer     string       `json:"jwt_issuer,omitempty"`     // required "iss" claim when set
+	TokenTTL      Duration     `json:"token_ttl,omitempty"`      // lifetime of tokens from POST /auth/token, 15m when empty
+	SignatureSkew Duration     `json:"signature_skew,omitempty"` // how far the timestamp of an HMAC-signed request may be off, 5m when empty
+	SigningPepper string       `json:"signing_pepper,omitempty"` // derives the signing secrets of API keys; signed requests are refused when empty
+	ClientCerts   []ClientCert `json:"client_certs,omitempty"`   // callers authenticated by a verified TLS client certificate
+}
+
+// IsEnabled reports whether requests have to authenticate. Without authentication only
+// loopback clients are served.
+func (a Auth) IsEnabled() bool {
+	return a.Enabled == nil || *a.Enabled
+}
+
+// ClientCert grants a role to callers presenting a TLS client certificate that was
+// verified against Server.TLS.ClientCAFile.
+type ClientCert struct {
+	Subject   string   `json:"subject"` // common name, or the full subject such as "CN=payments,O=Example"
+	Role      string   `json:"role"`    // reader, operator or admin
+	Tokens    []string `json:"tokens,omitempty"`
+	MaxAmount string   `json:"max_amount,omitempty"` // per transfer in raw units, as on an API key
+}
+
+// TLS configures HTTPS. The certificate, key and client CA files are checked for changes
+// and reloaded, so renewed certificates are picked up without a restart.
+type TLS struct {
+	Enabled           bool     `json:"enabled"`
+	CertFile          string   `json:"cert_file"`
+	KeyFile           string   `json:"key_file"`
+	ClientCAFile      string   `json:"client_ca_file,omitempty"`      // verify client certificates against these CAs
+	RequireClientCert bool     `json:"require_client_cert,omitempty"` // refuse connections without a verified client certificate
+	RedirectAddr      string   `json:"redirect_addr,omitempty"`       // plain HTTP listener redirecting to HTTPS, e.g. ":8080"
+	ReloadInterval    Duration `json:"reload_interval,omitempty"`     // between checks of the files, 30s when empty
+}
+
+// Rate is a token bucket: Burst requests at once, refilled at PerSecond. A zero
+// PerSecond means no limit.
+type Rate struct {
+	PerSecond float64 `json:"per_second,omitempty"`
+	Burst     int     `json:"burst,omitempty"` // 1 when 0
+}
+
+// Budget holds separate rates for read and write endpoints. Reads are whatever the reader
+// role may do, read-only POSTs such as contract calls included.
+type Budget struct {
+	Read  Rate `json:"read"`
+	Write Rate `json:"write"`
+}
+
+// RateLimits configures request rate limits, answered with 429 and Retry-After.
+type RateLimits struct {
+	Enabled        bool   `json:"enabled"`
+	PerKey         Budget `json:"per_key"`                     // for every authenticated caller
+	PerIP          Budget `json:"per_ip"`                      // for every client IP, checked before authentication
+	TrustProxy     bool   `json:"trust_proxy,omitempty"`       // take the client IP from the last X-Forwarded-For hop, added by the proxy
+	MaxRPCInFlight int    `json:"max_rpc_in_flight,omitempty"` // JSON-RPC calls to the node at once, uncapped when 0
+}
+
+// Server configures the HTTP listener.
+type Server struct {
+	Addr string `json:"addr,omitempty"` // ":8080" when empty
+	TLS  TLS    `json:"tls"`
+}
+
+// Limit caps transfers of one asset. Amounts are in the asset's units; an empty amount is
+// not capped. Days and months are calendar periods in UTC.
+type Limit struct {
+	Token          string `json:"token"` // symbol or address, "ETH" for native transfers
+	PerTransaction string `json:"per_transaction,omitempty"`
+	Daily          string `json:"daily,omitempty"`
+	Monthly        string `json:"monthly,omitempty"`
+}
+
+// Limits configures spending caps, checked against the ledger of transfers sent through the API.
+type Limits struct {
+	Global []Limit            `json:"global,omitempty"`  // across every caller together
+	PerKey []Limit            `json:"per_key,omitempty"` // for every API key separately
+	Keys   map[string][]Limit `json:"keys,omitempty"`    // extra caps for one key, by key ID
+}
+
+// Policy configures recipient checks. The files hold one address per line, "#" starts a
+// comment; entries added through /policy are kept in the store next to them.
+type Policy struct {
+	AllowlistFile string `json:"allowlist_file,omitempty"` // when any allowlist entry exists, only those recipients are accepted
+	DenylistFile  string `json:"denylist_file,omitempty"`
+	RequireEOA    bool   `json:"require_eoa,omitempty"` // refuse recipients with contract code
+}
+
+// ApprovalRule makes transfers of a token above Threshold wait for Quorum approvals.
+type ApprovalRule struct {
+	Token     string   `json:"token"`               // symbol or address, "ETH" for native transfers
+	Threshold string   `json:"threshold"`           // in the token's units; transfers above it need approval
+	Quorum    int      `json:"quorum,omitempty"`    // approvals needed, 1 when 0
+	Approvers []string `json:"approvers,omitempty"` // key IDs that may approve; any operator when empty
+}
+
+// Approvals configures the approval workflow for large transfers. Approvers are told apart
+// by their API key, so a quorum above 1 needs authentication enabled.
+type Approvals struct {
+	Rules  []ApprovalRule `json:"rules,omitempty"`
+	Expiry Duration       `json:"expiry,omitempty"` // pending requests expire after this, 24h when empty
+}
+
+// Config is the service configuration read from a JSON file. When the file does not exist
+// the defaults from the constants package are used.
+type Config struct {
+	Tokens     []Token    `json:"tokens"`
+	Multicall  string     `json:"multicall,omitempty"` // Multicall3 aggregator address, JSON-RPC batches are used when empty
+	Faucet     Faucet     `json:"faucet"`
+	Monitor    Monitor    `json:"monitor"`
+	Auth       Auth       `json:"auth"`
+	Limits     Limits     `json:"limits"`
+	Policy     Policy     `json:"policy"`
+	Approvals  Approvals  `json:"approvals"`
+	Server     Server     `json:"server"`
+	RateLimits RateLimits `json:"rate_limits"`
+
+	path string
+	mu   sync.Mutex
+}
+
+func Path() string {
+	if p := os.Getenv("CONFIG_PATH"); p != "" {
+		return p
+	}
+	return constants.ConfigPath
+}
+
+func Load(path string) (*Config, error) {
+	c := &Config{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.Tokens = []Token{{Address: constants.ContractAddress, StartBlock: constants.IndexStartBlock}}
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AddToken appends t unless its address is already configured, and saves the file.
+func (c *Config) AddToken(t Token) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.Tokens {
+		if strings.EqualFold(existing.Address, t.Address) {
+			return nil
+		}
+	}
+	c.Tokens = append(c.Tokens, t)
+	return c.save()
+}
+
+// Save writes the configuration back to the file it was loaded from.
+func (c *Config) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+func (c *Config) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,146 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoBytecode = errors.New("contract bytecode not found")
+	ErrReverted   = errors.New("deployment transaction reverted")
+	ErrNoCode     = errors.New("no code at the deployed address")
+)
+
+// Backend is what a deployment needs from a node: sending, receipts and code.
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+}
+
+// Result describes a mined and verified deployment.
+type Result struct {
+	Address common.Address `json:"address"`
+	TxHash  common.Hash    `json:"tx_hash"`
+	Block   uint64         `json:"block"`
+	GasUsed uint64         `json:"gas_used"`
+}
+
+// Deployer deploys new MyContract tokens with the service signer.
+type Deployer struct {
+	backend Backend
+	signer  *signer.Signer
+
+	Timeout time.Duration // how long to wait for the deployment to be mined
+	BinPath string        // file with creation bytecode to deploy instead of the MyContract bindings'
+}
+
+func New(backend Backend, s *signer.Signer) *Deployer {
+	return &Deployer{backend: backend, signer: s, Timeout: 5 * time.Minute}
+}
+
+// bytecode returns the creation bytecode: the one embedded in the bindings, or the hex
+// in BinPath, with or without the 0x prefix.
+func (d *Deployer) bytecode() ([]byte, error) {
+	if d.BinPath == "" {
+		return common.FromHex(contract.MyContractBin), nil
+	}
+	data, err := os.ReadFile(d.BinPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoBytecode
+	}
+	if err != nil {
+		return nil, err
+	}
+	code := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(code, "0x") {
+		code = "0x" + code
+	}
+	bin, err := hexutil.Decode(code)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", d.BinPath, err)
+	}
+	if len(bin) == 0 {
+		return nil, ErrNoBytecode
+	}
+	return bin, nil
+}
+
+// Pending is a sent deployment that may not be mined yet.
+type Pending struct {
+	Address common.Address `json:"address"`
+	TxHash  common.Hash    `json:"tx_hash"`
+
+	tx *types.Transaction
+}
+
+// Deploy sends the deployment, waits for its receipt and checks that code exists at the new address.
+func (d *Deployer) Deploy(ctx context.Context) (*Result, error) {
+	p, err := d.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.Wait(ctx, p)
+}
+
+// Send signs and sends the deployment without waiting for it to be mined.
+func (d *Deployer) Send(ctx context.Context) (*Pending, error) {
+	bin, err := d.bytecode()
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := contract.MyContractMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	var address common.Address
+	tx, err := d.signer.Transact(ctx, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		addr, tx, _, err := bind.DeployContract(auth, *parsed, bin, d.backend)
+		address = addr
+		return tx, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Pending{Address: address, TxHash: tx.Hash(), tx: tx}, nil
+}
+
+// Wait waits up to Timeout for a sent deployment to be mined and checks that code exists
+// at its address.
+func (d *Deployer) Wait(ctx context.Context, p *Pending) (*Result, error) {
+	tx, address := p.tx, p.Address
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+	receipt, err := bind.WaitMined(ctx, d.backend, tx)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for %s: %w", tx.Hash().Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, fmt.Errorf("%w: %s", ErrReverted, tx.Hash().Hex())
+	}
+
+	code, err := d.backend.CodeAt(ctx, address, receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrNoCode, address.Hex())
+	}
+
+	return &Result{
+		Address: address,
+		TxHash:  tx.Hash(),
+		Block:   receipt.BlockNumber.Uint64(),
+		GasUsed: receipt.GasUsed,
+	}, nil
+}
@@ -0,0 +1,52 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"io"
+	"log"
+	"net/http"
+)
+
+type deployRequest struct {
+	Symbol string `json:"symbol"`
+}
+
+// Handler serves POST /deploy. The optional body {"symbol": "..."} names the token in the
+// registry. It answers 202 with the address and transaction hash once the deployment is
+// sent; waiting for it to be mined and calling register with the verified deployment
+// happen in the background, the token shows up under /tokens when they are done.
+func (d *Deployer) Handler(register func(res *Result, symbol string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body deployRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		p, err := d.Send(r.Context())
+		if errors.Is(err, ErrNoBytecode) {
+			api.WriteError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		if err != nil {
+			api.WriteError(w, http.StatusBadGateway, err)
+			return
+		}
+		go func() {
+			res, err := d.Wait(context.Background(), p)
+			if err != nil {
+				log.Printf("deployer: %s: %v", p.TxHash.Hex(), err)
+				return
+			}
+			if err := register(res, body.Symbol); err != nil {
+				log.Printf("deployer: register %s: %v", res.Address.Hex(), err)
+				return
+			}
+			log.Printf("deployer: %s deployed in block %d", res.Address.Hex(), res.Block)
+		}()
+		api.WriteJSON(w, http.StatusAccepted, p)
+	}
+}
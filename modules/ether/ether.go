@@ -0,0 +1,223 @@
+package ether
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/approval"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"math/big"
+)
+
+const (
+	Decimals = 18
+
+	// ApprovalKind names ETH transfers in the approval workflow.
+	ApprovalKind = "eth_transfer"
+)
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrNothingToSweep    = errors.New("balance does not cover the fee")
+)
+
+// Backend is what native transfers need from a node besides the signer.
+type Backend interface {
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// Balance is an account's ETH balance at a block.
+type Balance struct {
+	Address   common.Address `json:"address"`
+	Balance   *big.Int       `json:"balance"`
+	Formatted string         `json:"formatted"`
+	Block     uint64         `json:"block"`
+}
+
+// Transfer describes a sent native transfer.
+type Transfer struct {
+	TxHash    common.Hash    `json:"tx_hash"`
+	From      common.Address `json:"from"`
+	To        common.Address `json:"to"`
+	Value     *big.Int       `json:"value"`
+	Gas       uint64         `json:"gas"`
+	MaxFee    *big.Int       `json:"max_fee"` // gas * max price per gas
+	Nonce     uint64         `json:"nonce"`
+	Swept     bool           `json:"swept,omitempty"`
+	Formatted string         `json:"formatted"`
+}
+
+// Service sends ETH from the service wallet.
+type Service struct {
+	backend   Backend
+	signer    *signer.Signer
+	limits    *limits.Engine
+	policy    *policy.Policy
+	approvals *approval.Workflow
+}
+
+func New(backend Backend, s *signer.Signer, spend *limits.Engine, recipients *policy.Policy, approvals *approval.Workflow) *Service {
+	return &Service{backend: backend, signer: s, limits: spend, policy: recipients, approvals: approvals}
+}
+
+// Balance returns the balance of account at the latest block.
+func (s *Service) Balance(ctx context.Context, account common.Address) (*Balance, error) {
+	head, err := s.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := s.backend.BalanceAt(ctx, account, head.Number)
+	if err != nil {
+		return nil, err
+	}
+	return &Balance{
+		Address:   account,
+		Balance:   balance,
+		Formatted: units.FormatAmount(balance, Decimals),
+		Block:     head.Number.Uint64(),
+	}, nil
+}
+
+// Send transfers value wei to the address.
+func (s *Service) Send(ctx context.Context, to common.Address, value *big.Int) (*Transfer, error) {
+	return s.send(ctx, to, func(gas uint64, fees *signer.Fees) (*big.Int, error) {
+		balance, err := s.backend.PendingBalanceAt(ctx, s.signer.Address())
+		if err != nil {
+			return nil, err
+		}
+		cost := new(big.Int).Add(value, maxFee(gas, fees))
+		if balance.Cmp(cost) < 0 {
+			return nil, fmt.Errorf("%w: need %s ETH including fee, have %s", ErrInsufficientFunds,
+				units.FormatAmount(cost, Decimals), units.FormatAmount(balance, Decimals))
+		}
+		return value, nil
+	})
+}
+
+// transfer records the spend against the limits of the caller in ctx and sends amount,
+// giving the spend back if sending fails.
+func (s *Service) transfer(ctx context.Context, to common.Address, amount *big.Int) (*Transfer, error) {
+	spent, err := s.limits.Spend(ctx, auth.ETH, []*big.Int{amount}, "eth transfer")
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.Send(ctx, to, amount)
+	if err != nil {
+		if releaseErr := s.limits.Release(spent); releaseErr != nil {
+			log.Printf("ether: release spend: %v", releaseErr)
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// approvedTransfer is the payload of an ETH transfer waiting for approval.
+type approvedTransfer struct {
+	To     common.Address `json:"to"`
+	Amount *big.Int       `json:"amount"`
+}
+
+// ExecuteApproved sends an ETH transfer once the approval workflow let it through. The
+// recipient is checked again, the lists may have changed while it waited.
+func (s *Service) ExecuteApproved(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var t approvedTransfer
+	if err := json.Unmarshal(payload, &t); err != nil {
+		return nil, err
+	}
+	if err := s.policy.Check(ctx, t.To, nil, "eth transfer"); err != nil {
+		return nil, err
+	}
+	return s.transfer(ctx, t.To, t.Amount)
+}
+
+// SweepAmount returns what a sweep to the address would send now: the whole pending
+// balance minus the maximum fee. It is then checked and sent like any other amount, so
+// if fees rise before it goes out the transfer fails instead of sending more. On chains
+// with a base fee, whatever part of the fee cap isn't charged is refunded and stays in
+// the wallet.
+func (s *Service) SweepAmount(ctx context.Context, to common.Address) (*big.Int, error) {
+	from := s.signer.Address()
+	gas, err := s.backend.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to})
+	if err != nil {
+		return nil, err
+	}
+	fees, err := s.signer.SuggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := s.backend.PendingBalanceAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	value := new(big.Int).Sub(balance, maxFee(gas, fees))
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: %s ETH left", ErrNothingToSweep, units.FormatAmount(balance, Decimals))
+	}
+	return value, nil
+}
+
+func maxFee(gas uint64, fees *signer.Fees) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(gas), fees.MaxPrice())
+}
+
+// send estimates gas and fees, lets amount pick the value, then signs and sends under a
+// nonce from the signer.
+func (s *Service) send(ctx context.Context, to common.Address, amount func(gas uint64, fees *signer.Fees) (*big.Int, error)) (*Transfer, error) {
+	from := s.signer.Address()
+	var t *Transfer
+	_, err := s.signer.Transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		// a plain transfer costs the same whatever the value, so estimate with none
+		gas, err := s.backend.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to})
+		if err != nil {
+			return nil, err
+		}
+		fees, err := s.signer.SuggestFees(ctx)
+		if err != nil {
+			return nil, err
+		}
+		value, err := amount(gas, fees)
+		if err != nil {
+			return nil, err
+		}
+		chainID, err := s.signer.ChainID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := opts.Signer(from, signer.NewTx(chainID, opts.Nonce.Uint64(), to, value, gas, fees, nil))
+		if err != nil {
+			return nil, err
+		}
+		if err := s.backend.SendTransaction(ctx, tx); err != nil {
+			return nil, err
+		}
+		t = &Transfer{
+			TxHash:    tx.Hash(),
+			From:      from,
+			To:        to,
+			Value:     value,
+			Gas:       gas,
+			MaxFee:    maxFee(gas, fees),
+			Nonce:     tx.Nonce(),
+			Formatted: units.FormatAmount(value, Decimals),
+		}
+		return tx, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
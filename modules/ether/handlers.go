@@ -0,0 +1,123 @@
+package ether
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"math/big"
+	"net/http"
+)
+
+type transferRequest struct {
+	To     string `json:"to"`
+	Amount string `json:"amount"`
+	Sweep  bool   `json:"sweep"`
+}
+
+func transferStatus(err error) int {
+	switch {
+	case errors.Is(err, limits.ErrLimitExceeded):
+		return limits.HTTPStatus(err)
+	case errors.Is(err, policy.ErrRejected):
+		return policy.HTTPStatus(err)
+	default:
+		return httpStatus(err)
+	}
+}
+
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrNothingToSweep):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// TransferHandler serves POST /eth/transfer {"to", "amount"} with the amount in ether,
+// or {"to", "sweep": true} to send everything but the fee.
+func (s *Service) TransferHandler(w http.ResponseWriter, r *http.Request) {
+	var body transferRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := api.Address("to", body.To)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.policy.Check(r.Context(), to, nil, "eth transfer"); err != nil {
+		api.WriteError(w, policy.HTTPStatus(err), err)
+		return
+	}
+
+	var amount *big.Int
+	switch {
+	case body.Sweep && body.Amount != "":
+		api.WriteError(w, http.StatusBadRequest, errors.New("amount and sweep are exclusive"))
+		return
+	case body.Sweep:
+		// the sweep amount is fixed here, so it goes through the same checks as any other
+		if amount, err = s.SweepAmount(r.Context(), to); err != nil {
+			api.WriteError(w, httpStatus(err), err)
+			return
+		}
+	default:
+		if amount, err = api.Amount("amount", body.Amount, Decimals); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err := auth.Authorize(r.Context(), auth.ETH, amount); err != nil {
+		api.WriteError(w, auth.HTTPStatus(err), err)
+		return
+	}
+	rule, err := s.approvals.Required(auth.ETH, amount)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if rule != nil {
+		summary := fmt.Sprintf("send %s ETH to %s", units.FormatAmount(amount, Decimals), to.Hex())
+		if body.Sweep {
+			summary = fmt.Sprintf("sweep %s ETH to %s", units.FormatAmount(amount, Decimals), to.Hex())
+		}
+		req, err := s.approvals.Submit(r.Context(), rule, ApprovalKind, summary, auth.ETH, amount, approvedTransfer{To: to, Amount: amount})
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Location", "/approvals/"+req.ID)
+		api.WriteJSON(w, http.StatusAccepted, req)
+		return
+	}
+	t, err := s.transfer(r.Context(), to, amount)
+	if err != nil {
+		api.WriteError(w, transferStatus(err), err)
+		return
+	}
+	t.Swept = body.Sweep
+	api.WriteJSON(w, http.StatusOK, t)
+}
+
+// BalanceHandler serves GET /eth/balance/{address}.
+func (s *Service) BalanceHandler(w http.ResponseWriter, r *http.Request) {
+	account, err := api.HexAddress("address", router.Param(r, "address"))
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	balance, err := s.Balance(r.Context(), account)
+	if err != nil {
+		api.WriteError(w, http.StatusBadGateway, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, balance)
+}
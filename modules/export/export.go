@@ -0,0 +1,303 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/indexer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+
+	KindTransfer = "transfer"
+	KindApproval = "approval"
+
+	etherDecimals = 18
+
+	// parquet row groups are buffered in memory until full, keep them small.
+	rowGroupSize = 8 << 20
+)
+
+var (
+	ErrInvalidFormat = errors.New("format must be \"csv\" or \"parquet\"")
+	ErrInvalidKind   = errors.New("kind must be \"transfer\" or \"approval\"")
+
+	errDone = errors.New("done")
+)
+
+// Options selects the events to export. A zero ToBlock means the last indexed block
+// and zero times mean no time bound.
+type Options struct {
+	Kind      string
+	Format    string
+	FromBlock uint64
+	ToBlock   uint64
+	FromTime  uint64
+	ToTime    uint64
+}
+
+func (o *Options) Validate() error {
+	if o.Kind != KindTransfer && o.Kind != KindApproval {
+		return ErrInvalidKind
+	}
+	if o.Format != FormatCSV && o.Format != FormatParquet {
+		return ErrInvalidFormat
+	}
+	return nil
+}
+
+// ContentType returns the MIME type of the export format.
+func (o *Options) ContentType() string {
+	if o.Format == FormatParquet {
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv"
+}
+
+type transferRow struct {
+	BlockNumber int64  `parquet:"name=block_number, type=INT64"`
+	BlockTime   int64  `parquet:"name=block_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	TxHash      string `parquet:"name=tx_hash, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LogIndex    int64  `parquet:"name=log_index, type=INT64"`
+	From        string `parquet:"name=from, type=BYTE_ARRAY, convertedtype=UTF8"`
+	To          string `parquet:"name=to, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Value       string `parquet:"name=value, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Amount      string `parquet:"name=amount, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TxFee       string `parquet:"name=tx_fee_wei, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TxFeeEth    string `parquet:"name=tx_fee_eth, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type approvalRow struct {
+	BlockNumber int64  `parquet:"name=block_number, type=INT64"`
+	BlockTime   int64  `parquet:"name=block_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	TxHash      string `parquet:"name=tx_hash, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LogIndex    int64  `parquet:"name=log_index, type=INT64"`
+	Owner       string `parquet:"name=owner, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Spender     string `parquet:"name=spender, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Value       string `parquet:"name=value, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Amount      string `parquet:"name=amount, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TxFee       string `parquet:"name=tx_fee_wei, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TxFeeEth    string `parquet:"name=tx_fee_eth, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// record is an exported event before it is encoded. Party1 and Party2 are
+// from and to for transfers, owner and spender for approvals.
+type record struct {
+	BlockNumber uint64
+	BlockTime   uint64
+	TxHash      string
+	LogIndex    uint
+	Party1      string
+	Party2      string
+	Value       *big.Int
+	TxFee       *big.Int
+}
+
+type sink interface {
+	write(r *record) error
+	close() error
+}
+
+// Write streams the indexed events selected by opts to w, one row at a time.
+func Write(w io.Writer, idx *indexer.Indexer, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	decimals, err := idx.Decimals()
+	if err != nil {
+		return err
+	}
+	last, ok, err := idx.LastBlock()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("nothing indexed yet")
+	}
+	toBlock := opts.ToBlock
+	if toBlock == 0 || toBlock > last {
+		toBlock = last
+	}
+
+	var out sink
+	if opts.Format == FormatParquet {
+		out, err = newParquetSink(w, opts.Kind, decimals)
+	} else {
+		out, err = newCSVSink(w, opts.Kind, decimals)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Block times only grow with block numbers, so the scan stops at the first event past ToTime.
+	emit := func(r *record) error {
+		if opts.FromTime != 0 && r.BlockTime < opts.FromTime {
+			return nil
+		}
+		if opts.ToTime != 0 && r.BlockTime > opts.ToTime {
+			return errDone
+		}
+		return out.write(r)
+	}
+
+	if opts.Kind == KindTransfer {
+		err = idx.EachTransfer(opts.FromBlock, toBlock, func(t *indexer.Transfer) error {
+			return emit(&record{
+				BlockNumber: t.BlockNumber,
+				BlockTime:   t.BlockTime,
+				TxHash:      t.TxHash.Hex(),
+				LogIndex:    t.LogIndex,
+				Party1:      t.From.Hex(),
+				Party2:      t.To.Hex(),
+				Value:       t.Value,
+				TxFee:       t.TxFee,
+			})
+		})
+	} else {
+		err = idx.EachApproval(opts.FromBlock, toBlock, func(a *indexer.Approval) error {
+			return emit(&record{
+				BlockNumber: a.BlockNumber,
+				BlockTime:   a.BlockTime,
+				TxHash:      a.TxHash.Hex(),
+				LogIndex:    a.LogIndex,
+				Party1:      a.Owner.Hex(),
+				Party2:      a.Spender.Hex(),
+				Value:       a.Value,
+				TxFee:       a.TxFee,
+			})
+		})
+	}
+	if err != nil && !errors.Is(err, errDone) {
+		out.close()
+		return err
+	}
+	return out.close()
+}
+
+type csvSink struct {
+	w        *csv.Writer
+	decimals uint8
+	rows     int
+}
+
+func newCSVSink(w io.Writer, kind string, decimals uint8) (*csvSink, error) {
+	s := &csvSink{w: csv.NewWriter(w), decimals: decimals}
+	header := []string{"block_number", "block_time", "tx_hash", "log_index", "from", "to", "value", "amount", "tx_fee_wei", "tx_fee_eth"}
+	if kind == KindApproval {
+		header[4], header[5] = "owner", "spender"
+	}
+	return s, s.w.Write(header)
+}
+
+func (s *csvSink) write(r *record) error {
+	err := s.w.Write([]string{
+		strconv.FormatUint(r.BlockNumber, 10),
+		time.Unix(int64(r.BlockTime), 0).UTC().Format(time.RFC3339),
+		r.TxHash,
+		strconv.FormatUint(uint64(r.LogIndex), 10),
+		r.Party1,
+		r.Party2,
+		r.Value.String(),
+		units.FormatAmount(r.Value, s.decimals),
+		feeString(r.TxFee),
+		feeEth(r.TxFee),
+	})
+	if err != nil {
+		return err
+	}
+	s.rows++
+	if s.rows%1000 == 0 {
+		s.w.Flush()
+	}
+	return s.w.Error()
+}
+
+func (s *csvSink) close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+type parquetSink struct {
+	pw       *writer.ParquetWriter
+	kind     string
+	decimals uint8
+}
+
+func newParquetSink(w io.Writer, kind string, decimals uint8) (*parquetSink, error) {
+	var schema interface{} = new(transferRow)
+	if kind == KindApproval {
+		schema = new(approvalRow)
+	}
+	pw, err := writer.NewParquetWriterFromWriter(w, schema, 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = rowGroupSize
+	return &parquetSink{pw: pw, kind: kind, decimals: decimals}, nil
+}
+
+func (s *parquetSink) write(r *record) error {
+	blockTime := int64(r.BlockTime) * 1000
+	amount := units.FormatAmount(r.Value, s.decimals)
+	if s.kind == KindApproval {
+		return s.pw.Write(approvalRow{
+			BlockNumber: int64(r.BlockNumber),
+			BlockTime:   blockTime,
+			TxHash:      r.TxHash,
+			LogIndex:    int64(r.LogIndex),
+			Owner:       r.Party1,
+			Spender:     r.Party2,
+			Value:       r.Value.String(),
+			Amount:      amount,
+			TxFee:       feeString(r.TxFee),
+			TxFeeEth:    feeEth(r.TxFee),
+		})
+	}
+	return s.pw.Write(transferRow{
+		BlockNumber: int64(r.BlockNumber),
+		BlockTime:   blockTime,
+		TxHash:      r.TxHash,
+		LogIndex:    int64(r.LogIndex),
+		From:        r.Party1,
+		To:          r.Party2,
+		Value:       r.Value.String(),
+		Amount:      amount,
+		TxFee:       feeString(r.TxFee),
+		TxFeeEth:    feeEth(r.TxFee),
+	})
+}
+
+func (s *parquetSink) close() error {
+	return s.pw.WriteStop()
+}
+
+func feeString(fee *big.Int) string {
+	if fee == nil {
+		return ""
+	}
+	return fee.String()
+}
+
+func feeEth(fee *big.Int) string {
+	if fee == nil {
+		return ""
+	}
+	return units.FormatAmount(fee, etherDecimals)
+}
+
+// Filename suggests a download name such as "transfers_100-200.csv".
+func Filename(opts Options) string {
+	to := "latest"
+	if opts.ToBlock != 0 {
+		to = strconv.FormatUint(opts.ToBlock, 10)
+	}
+	return fmt.Sprintf("%ss_%d-%s.%s", opts.Kind, opts.FromBlock, to, opts.Format)
+}
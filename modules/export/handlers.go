@@ -0,0 +1,62 @@
+package export
+
+import (
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/indexer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"log"
+	"net/http"
+)
+
+// Handler serves GET /export/transfers and /export/approvals for kind.
+//
+// Query parameters: token (symbol or address, default token when empty), format (csv|parquet,
+// default csv), from_block, to_block, from_time and to_time (unix seconds or RFC3339).
+func Handler(pool *indexer.Pool, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values := r.URL.Query()
+		idx, err := pool.Get(values.Get("token"))
+		if err != nil {
+			api.WriteError(w, tokens.HTTPStatus(err), err)
+			return
+		}
+
+		opts := Options{Kind: kind, Format: values.Get("format")}
+		if opts.Format == "" {
+			opts.Format = FormatCSV
+		}
+
+		if opts.FromBlock, err = api.ParseUint(values, "from_block"); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if opts.ToBlock, err = api.ParseUint(values, "to_block"); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if opts.FromTime, err = api.ParseTime(values, "from_time"); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if opts.ToTime, err = api.ParseTime(values, "to_time"); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := opts.Validate(); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if _, ok, err := idx.LastBlock(); err != nil || !ok {
+			api.WriteError(w, http.StatusServiceUnavailable, fmt.Errorf("nothing indexed yet"))
+			return
+		}
+
+		w.Header().Set("Content-Type", opts.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", Filename(opts)))
+		// Once rows are streamed the status is already sent, so failures can only be logged.
+		if err := Write(w, idx, opts); err != nil {
+			log.Printf("export: %v", err)
+		}
+	}
+}
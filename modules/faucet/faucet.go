@@ -0,0 +1,323 @@
+package faucet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	// Source marks faucet sends in the spending limits.
+	Source = "faucet"
+
+	etherDecimals = 18
+
+	defaultCooldown   = 24 * time.Hour
+	defaultIPCooldown = time.Hour
+)
+
+var (
+	ErrCooldown = errors.New("claimed too recently")
+	ErrDrained  = errors.New("faucet wallet is below its minimum balance")
+)
+
+// CooldownError tells the caller when they may claim again.
+type CooldownError struct {
+	Scope string // "address" or "ip"
+	Until time.Time
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("%v: this %s can claim again at %s", ErrCooldown, e.Scope, e.Until.Format(time.RFC3339))
+}
+
+func (e *CooldownError) Unwrap() error {
+	return ErrCooldown
+}
+
+// Backend is what the faucet needs from a node besides the signer.
+type Backend interface {
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// Claim is a ledger entry for one dispensed claim.
+type Claim struct {
+	ID          string         `json:"id"`
+	Address     common.Address `json:"address"`
+	IP          string         `json:"ip"`
+	Token       common.Address `json:"token"`
+	TokenAmount *big.Int       `json:"token_amount,omitempty"`
+	TokenTx     *common.Hash   `json:"token_tx,omitempty"`
+	EthAmount   *big.Int       `json:"eth_amount,omitempty"`
+	EthTx       *common.Hash   `json:"eth_tx,omitempty"`
+	Error       string         `json:"error,omitempty"` // set when only part of the claim was sent
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// Faucet dispenses the configured amounts with the service signer.
+type Faucet struct {
+	backend  Backend
+	store    *store.Store
+	registry *tokens.Registry
+	signer   *signer.Signer
+	cfg      config.Faucet
+	policy   *policy.Policy
+	spend    *limits.Engine
+
+	mu sync.Mutex // claims are handled one at a time so cooldowns can't be raced
+}
+
+// New returns a faucet. Claims are public, so their sends count against the global
+// spending limits.
+func New(backend Backend, db *store.Store, registry *tokens.Registry, s *signer.Signer, cfg config.Faucet, recipients *policy.Policy, spend *limits.Engine) *Faucet {
+	return &Faucet{backend: backend, store: db, registry: registry, signer: s, cfg: cfg, policy: recipients, spend: spend}
+}
+
+// withDefault returns d, or def when it is not set: an open faucet without cooldowns could
+// be drained by a single client.
+func withDefault(d config.Duration, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return time.Duration(d)
+}
+
+func claimKey(id string) []byte {
+	return []byte("f/c/" + id)
+}
+
+func addressKey(address common.Address) []byte {
+	return append([]byte("f/a/"), address.Bytes()...)
+}
+
+func ipKey(ip string) []byte {
+	return []byte("f/i/" + ip)
+}
+
+// newClaimID returns an ID that sorts by creation time.
+func newClaimID(now time.Time) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%016x%s", now.UnixNano(), hex.EncodeToString(b))
+}
+
+// amounts parses the configured amounts and minimums for the token decimals.
+type amounts struct {
+	token, eth, minToken, minEth *big.Int
+}
+
+func parseOptional(s string, decimals uint8) (*big.Int, error) {
+	if s == "" {
+		return new(big.Int), nil
+	}
+	return units.ParseAmount(s, decimals)
+}
+
+func (f *Faucet) amounts(decimals uint8) (*amounts, error) {
+	var a amounts
+	var err error
+	if a.token, err = parseOptional(f.cfg.TokenAmount, decimals); err != nil {
+		return nil, fmt.Errorf("faucet token_amount: %w", err)
+	}
+	if a.eth, err = parseOptional(f.cfg.EthAmount, etherDecimals); err != nil {
+		return nil, fmt.Errorf("faucet eth_amount: %w", err)
+	}
+	if a.minToken, err = parseOptional(f.cfg.MinTokenBalance, decimals); err != nil {
+		return nil, fmt.Errorf("faucet min_token_balance: %w", err)
+	}
+	if a.minEth, err = parseOptional(f.cfg.MinEthBalance, etherDecimals); err != nil {
+		return nil, fmt.Errorf("faucet min_eth_balance: %w", err)
+	}
+	return &a, nil
+}
+
+// lastClaim returns when key last claimed, or the zero time.
+func (f *Faucet) lastClaim(key []byte) (time.Time, error) {
+	var t time.Time
+	err := f.store.Get(key, &t)
+	if errors.Is(err, store.ErrNotFound) {
+		return time.Time{}, nil
+	}
+	return t, err
+}
+
+// Eligible returns a CooldownError when the address or IP claimed within its cooldown.
+func (f *Faucet) Eligible(address common.Address, ip string, now time.Time) error {
+	checks := []struct {
+		scope    string
+		key      []byte
+		cooldown time.Duration
+	}{
+		{"address", addressKey(address), withDefault(f.cfg.Cooldown, defaultCooldown)},
+		{"ip", ipKey(ip), withDefault(f.cfg.IPCooldown, defaultIPCooldown)},
+	}
+	for _, c := range checks {
+		if c.scope == "ip" && ip == "" {
+			continue
+		}
+		last, err := f.lastClaim(c.key)
+		if err != nil {
+			return err
+		}
+		if until := last.Add(c.cooldown); !last.IsZero() && now.Before(until) {
+			return &CooldownError{Scope: c.scope, Until: until}
+		}
+	}
+	return nil
+}
+
+// Claim checks cooldowns and the wallet floor, then sends the token and ETH amounts.
+// Cooldowns start once anything was sent.
+func (f *Faucet) Claim(ctx context.Context, address common.Address, ip string) (*Claim, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now().UTC()
+	if err := f.Eligible(address, ip, now); err != nil {
+		return nil, err
+	}
+
+	token, instance, err := f.registry.Resolve(f.cfg.Token)
+	if err != nil {
+		return nil, err
+	}
+	a, err := f.amounts(token.Decimals)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.policy.Check(ctx, address, &token.Address, "faucet"); err != nil {
+		return nil, err
+	}
+
+	wallet := f.signer.Address()
+	if a.token.Sign() > 0 {
+		balance, err := instance.BalanceOf(&bind.CallOpts{Context: ctx}, wallet)
+		if err != nil {
+			return nil, err
+		}
+		if new(big.Int).Sub(balance, a.token).Cmp(a.minToken) < 0 {
+			return nil, fmt.Errorf("%w: %s %s left", ErrDrained, units.FormatAmount(balance, token.Decimals), token.Symbol)
+		}
+	}
+	if a.eth.Sign() > 0 || a.minEth.Sign() > 0 {
+		balance, err := f.backend.BalanceAt(ctx, wallet, nil)
+		if err != nil {
+			return nil, err
+		}
+		if new(big.Int).Sub(balance, a.eth).Cmp(a.minEth) < 0 {
+			return nil, fmt.Errorf("%w: %s ETH left", ErrDrained, units.FormatAmount(balance, etherDecimals))
+		}
+	}
+
+	// both spends are taken before anything is sent, so a claim is never cut in half by
+	// the limits
+	asset := auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}
+	var tokenSpent, ethSpent *limits.Entry
+	if a.token.Sign() > 0 {
+		if tokenSpent, err = f.spend.SpendAs("", asset, []*big.Int{a.token}, Source); err != nil {
+			return nil, err
+		}
+	}
+	if a.eth.Sign() > 0 {
+		if ethSpent, err = f.spend.SpendAs("", auth.ETH, []*big.Int{a.eth}, Source); err != nil {
+			f.release(tokenSpent)
+			return nil, err
+		}
+	}
+
+	claim := &Claim{ID: newClaimID(now), Address: address, IP: ip, Token: token.Address, CreatedAt: now}
+	var sendErr error
+	if a.token.Sign() > 0 {
+		tx, err := f.signer.Transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return instance.Transfer(opts, address, a.token)
+		})
+		if err != nil {
+			f.release(tokenSpent)
+			sendErr = fmt.Errorf("token transfer: %w", err)
+		} else {
+			hash := tx.Hash()
+			claim.TokenAmount, claim.TokenTx = a.token, &hash
+		}
+	}
+	if a.eth.Sign() > 0 {
+		if sendErr != nil {
+			f.release(ethSpent)
+		} else if tx, err := f.signer.SendEth(ctx, address, a.eth); err != nil {
+			f.release(ethSpent)
+			sendErr = fmt.Errorf("eth transfer: %w", err)
+		} else {
+			hash := tx.Hash()
+			claim.EthAmount, claim.EthTx = a.eth, &hash
+		}
+	}
+	if claim.TokenTx == nil && claim.EthTx == nil {
+		if sendErr == nil {
+			sendErr = errors.New("faucet has nothing configured to dispense")
+		}
+		return nil, sendErr
+	}
+	if sendErr != nil {
+		claim.Error = sendErr.Error()
+	}
+
+	batch := new(store.Batch)
+	if err := batch.Put(claimKey(claim.ID), claim); err != nil {
+		return nil, err
+	}
+	if err := batch.Put(addressKey(address), now); err != nil {
+		return nil, err
+	}
+	if ip != "" {
+		if err := batch.Put(ipKey(ip), now); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.store.Write(batch); err != nil {
+		return nil, err
+	}
+	return claim, nil
+}
+
+func (f *Faucet) release(spent *limits.Entry) {
+	if err := f.spend.Release(spent); err != nil {
+		log.Printf("faucet: release spend: %v", err)
+	}
+}
+
+// Claims returns the most recent ledger entries, newest first.
+func (f *Faucet) Claims(limit int) ([]*Claim, error) {
+	claims := []*Claim{}
+	var decodeErr error
+	err := f.store.Iterate([]byte("f/c/"), nil, nil, true, func(key, value []byte) bool {
+		var c Claim
+		if decodeErr = json.Unmarshal(value, &c); decodeErr != nil {
+			return false
+		}
+		claims = append(claims, &c)
+		return len(claims) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, decodeErr
+}
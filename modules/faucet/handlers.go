@@ -0,0 +1,73 @@
+package faucet
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultClaims = 50
+	maxClaims     = 500
+)
+
+type claimRequest struct {
+	Address string `json:"address"`
+}
+
+// ClaimsHandler serves GET /faucet/claims, the claim ledger newest first.
+func (f *Faucet) ClaimsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := api.ParseLimit(r.URL.Query(), "limit", defaultClaims, maxClaims)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	claims, err := f.Claims(limit)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, claims)
+}
+
+// ClaimHandler serves POST /faucet {"address": "0x..."}.
+func (f *Faucet) ClaimHandler(w http.ResponseWriter, r *http.Request) {
+	var body claimRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	address, err := api.Address("address", body.Address)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	claim, err := f.Claim(r.Context(), address, api.ClientIP(r, f.cfg.TrustProxy))
+	var cooldown *CooldownError
+	switch {
+	case errors.As(err, &cooldown):
+		retry := math.Ceil(time.Until(cooldown.Until).Seconds())
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry)))
+		api.WriteError(w, http.StatusTooManyRequests, err)
+	case errors.Is(err, limits.ErrLimitExceeded):
+		api.WriteError(w, limits.HTTPStatus(err), err)
+	case errors.Is(err, policy.ErrRejected):
+		api.WriteError(w, policy.HTTPStatus(err), err)
+	case errors.Is(err, ErrDrained):
+		api.WriteError(w, http.StatusServiceUnavailable, err)
+	case errors.Is(err, tokens.ErrUnknownToken):
+		api.WriteError(w, tokens.HTTPStatus(err), err)
+	case err != nil:
+		api.WriteError(w, http.StatusBadGateway, err)
+	default:
+		api.WriteJSON(w, http.StatusOK, claim)
+	}
+}
@@ -0,0 +1,225 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+	"reflect"
+)
+
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// Integers wider than this are encoded as decimal strings so JSON clients don't lose precision.
+const maxJSONIntBits = 53
+
+func invalid(t abi.Type, raw json.RawMessage) error {
+	return fmt.Errorf("%w: %s is not a valid %s", ErrInvalidArgument, raw, t.String())
+}
+
+// decode converts a JSON value to the Go type the abi package packs for t.
+// Integers may be JSON numbers or decimal or 0x-prefixed hex strings; byte
+// values are 0x-prefixed hex; tuples are objects keyed by component name or arrays.
+func decode(t abi.Type, raw json.RawMessage) (reflect.Value, error) {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		n, err := decodeInt(raw)
+		if err != nil {
+			return reflect.Value{}, invalid(t, raw)
+		}
+		if !fits(t, n) {
+			return reflect.Value{}, fmt.Errorf("%w: %s overflows %s", ErrInvalidArgument, n, t.String())
+		}
+		typ := t.GetType()
+		if typ == reflect.TypeOf(&big.Int{}) {
+			return reflect.ValueOf(n), nil
+		}
+		v := reflect.New(typ).Elem()
+		if t.T == abi.IntTy {
+			v.SetInt(n.Int64())
+		} else {
+			v.SetUint(n.Uint64())
+		}
+		return v, nil
+
+	case abi.BoolTy:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return reflect.Value{}, invalid(t, raw)
+		}
+		return reflect.ValueOf(b), nil
+
+	case abi.StringTy:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return reflect.Value{}, invalid(t, raw)
+		}
+		return reflect.ValueOf(s), nil
+
+	case abi.AddressTy:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return reflect.Value{}, invalid(t, raw)
+		}
+		addr, err := api.HexAddress(t.String(), s)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+		}
+		return reflect.ValueOf(addr), nil
+
+	case abi.BytesTy:
+		b, err := decodeBytes(raw)
+		if err != nil {
+			return reflect.Value{}, invalid(t, raw)
+		}
+		return reflect.ValueOf(b), nil
+
+	case abi.FixedBytesTy, abi.HashTy:
+		b, err := decodeBytes(raw)
+		if err != nil || len(b) != t.Size {
+			return reflect.Value{}, invalid(t, raw)
+		}
+		v := reflect.New(t.GetType()).Elem()
+		reflect.Copy(v, reflect.ValueOf(b))
+		return v, nil
+
+	case abi.SliceTy, abi.ArrayTy:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return reflect.Value{}, invalid(t, raw)
+		}
+		var v reflect.Value
+		if t.T == abi.ArrayTy {
+			if len(items) != t.Size {
+				return reflect.Value{}, fmt.Errorf("%w: %s needs %d elements, got %d", ErrInvalidArgument, t.String(), t.Size, len(items))
+			}
+			v = reflect.New(t.GetType()).Elem()
+		} else {
+			v = reflect.MakeSlice(t.GetType(), len(items), len(items))
+		}
+		for i, item := range items {
+			elem, err := decode(*t.Elem, item)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("[%d]: %w", i, err)
+			}
+			v.Index(i).Set(elem)
+		}
+		return v, nil
+
+	case abi.TupleTy:
+		items := make([]json.RawMessage, len(t.TupleElems))
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			var list []json.RawMessage
+			if err := json.Unmarshal(raw, &list); err != nil || len(list) != len(items) {
+				return reflect.Value{}, invalid(t, raw)
+			}
+			copy(items, list)
+		} else {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &fields); err != nil {
+				return reflect.Value{}, invalid(t, raw)
+			}
+			for i, name := range t.TupleRawNames {
+				field, ok := fields[name]
+				if !ok {
+					return reflect.Value{}, fmt.Errorf("%w: missing tuple field %q", ErrInvalidArgument, name)
+				}
+				items[i] = field
+			}
+		}
+		v := reflect.New(t.GetType()).Elem()
+		for i, elem := range t.TupleElems {
+			field, err := decode(*elem, items[i])
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf(".%s: %w", t.TupleRawNames[i], err)
+			}
+			v.Field(i).Set(field)
+		}
+		return v, nil
+	}
+	return reflect.Value{}, fmt.Errorf("%w: unsupported type %s", ErrInvalidArgument, t.String())
+}
+
+func decodeInt(raw json.RawMessage) (*big.Int, error) {
+	s := string(raw)
+	if len(raw) > 0 && raw[0] == '"' {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+	}
+	n, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return nil, ErrInvalidArgument
+	}
+	return n, nil
+}
+
+func decodeBytes(raw json.RawMessage) ([]byte, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	return hexutil.Decode(s)
+}
+
+func fits(t abi.Type, n *big.Int) bool {
+	if t.T == abi.UintTy {
+		return n.Sign() >= 0 && n.BitLen() <= t.Size
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+	return n.Cmp(new(big.Int).Neg(limit)) >= 0 && n.Cmp(limit) < 0
+}
+
+// encode converts a value unpacked for t to JSON-friendly form.
+func encode(t abi.Type, v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		var n *big.Int
+		switch x := v.(type) {
+		case *big.Int:
+			n = x
+		default:
+			if t.T == abi.IntTy {
+				n = big.NewInt(rv.Int())
+			} else {
+				n = new(big.Int).SetUint64(rv.Uint())
+			}
+		}
+		if t.Size > maxJSONIntBits {
+			return n.String()
+		}
+		return n.Int64()
+
+	case abi.AddressTy:
+		return v.(common.Address).Hex()
+
+	case abi.BytesTy:
+		return hexutil.Encode(v.([]byte))
+
+	case abi.FixedBytesTy, abi.HashTy:
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return hexutil.Encode(b)
+
+	case abi.SliceTy, abi.ArrayTy:
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = encode(*t.Elem, rv.Index(i).Interface())
+		}
+		return items
+
+	case abi.TupleTy:
+		fields := make(map[string]interface{}, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			fields[t.TupleRawNames[i]] = encode(*elem, rv.Field(i).Interface())
+		}
+		return fields
+	}
+	return v
+}
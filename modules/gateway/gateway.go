@@ -0,0 +1,264 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/approval"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("contract not registered")
+	ErrExists        = errors.New("contract name already registered")
+	ErrInvalidName   = errors.New("name must be 1-64 letters, digits, '-' or '_'")
+	ErrUnknownMethod = errors.New("unknown method")
+	ErrReadOnly      = errors.New("method is view or pure, use call instead")
+	ErrTokenMethod   = errors.New("only transfer may be sent to a registered token, other methods need the admin role")
+
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// Contract is an ABI registered under a name and bound to an address.
+type Contract struct {
+	Name      string          `json:"name"`
+	Address   common.Address  `json:"address"`
+	ABI       json.RawMessage `json:"abi"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type bound struct {
+	contract Contract
+	abi      abi.ABI
+	instance *bind.BoundContract
+}
+
+// Gateway calls and transacts arbitrary methods of registered contracts,
+// converting JSON arguments and results against their ABIs.
+type Gateway struct {
+	backend   bind.ContractBackend
+	store     *store.Store
+	signer    *signer.Signer
+	limits    *limits.Engine
+	registry  *tokens.Registry
+	policy    *policy.Policy
+	approvals *approval.Workflow
+
+	mu        sync.Mutex
+	contracts map[string]*bound
+}
+
+func New(backend bind.ContractBackend, db *store.Store, s *signer.Signer, spend *limits.Engine, registry *tokens.Registry, recipients *policy.Policy, approvals *approval.Workflow) *Gateway {
+	return &Gateway{
+		backend:   backend,
+		store:     db,
+		signer:    s,
+		limits:    spend,
+		registry:  registry,
+		policy:    recipients,
+		approvals: approvals,
+		contracts: make(map[string]*bound),
+	}
+}
+
+func contractKey(name string) []byte {
+	return append([]byte("g/"), strings.ToLower(name)...)
+}
+
+func (g *Gateway) bind(c Contract) (*bound, error) {
+	parsed, err := abi.JSON(strings.NewReader(string(c.ABI)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid abi: %w", err)
+	}
+	return &bound{
+		contract: c,
+		abi:      parsed,
+		instance: bind.NewBoundContract(c.Address, parsed, g.backend, g.backend, g.backend),
+	}, nil
+}
+
+// Register parses and stores an ABI under name. Names are case-insensitive.
+func (g *Gateway) Register(name string, address common.Address, abiJSON json.RawMessage) (*Contract, error) {
+	if !namePattern.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+	b, err := g.bind(Contract{Name: name, Address: address, ABI: abiJSON, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := contractKey(name)
+	ok, err := g.store.Has(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, ErrExists
+	}
+	if err := g.store.Put(key, b.contract); err != nil {
+		return nil, err
+	}
+	g.contracts[strings.ToLower(name)] = b
+	c := b.contract
+	return &c, nil
+}
+
+// Get returns the contract registered under name, parsing its ABI on first use.
+func (g *Gateway) Get(name string) (*Contract, error) {
+	b, err := g.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	c := b.contract
+	return &c, nil
+}
+
+func (g *Gateway) lookup(name string) (*bound, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if b, ok := g.contracts[strings.ToLower(name)]; ok {
+		return b, nil
+	}
+	var c Contract
+	err := g.store.Get(contractKey(name), &c)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := g.bind(c)
+	if err != nil {
+		return nil, err
+	}
+	g.contracts[strings.ToLower(name)] = b
+	return b, nil
+}
+
+func (g *Gateway) List() ([]Contract, error) {
+	contracts := []Contract{}
+	var decodeErr error
+	err := g.store.Iterate([]byte("g/"), nil, nil, false, func(key, value []byte) bool {
+		var c Contract
+		if decodeErr = json.Unmarshal(value, &c); decodeErr != nil {
+			return false
+		}
+		contracts = append(contracts, c)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contracts, decodeErr
+}
+
+func (g *Gateway) Delete(name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := contractKey(name)
+	ok, err := g.store.Has(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	delete(g.contracts, strings.ToLower(name))
+	return g.store.Delete(key)
+}
+
+// Value is a typed method output.
+type Value struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// Call runs method against the node without sending a transaction, at block or the latest block when nil.
+func (g *Gateway) Call(ctx context.Context, name, method string, args []json.RawMessage, block *big.Int) ([]Value, error) {
+	b, m, params, err := g.prepare(name, method, args)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	if err := b.instance.Call(&bind.CallOpts{Context: ctx, BlockNumber: block}, &out, m.Name, params...); err != nil {
+		return nil, err
+	}
+
+	values := make([]Value, len(m.Outputs))
+	for i, arg := range m.Outputs {
+		values[i] = Value{Name: arg.Name, Type: arg.Type.String(), Value: encode(arg.Type, out[i])}
+	}
+	return values, nil
+}
+
+// TransactOpts are the optional transaction parameters; zero values are filled in by the node.
+type TransactOpts struct {
+	Value    *big.Int
+	GasLimit uint64
+}
+
+// Transact signs and sends a transaction calling method with the service signer.
+func (g *Gateway) Transact(ctx context.Context, name, method string, args []json.RawMessage, opts TransactOpts) (*types.Transaction, error) {
+	b, m, params, err := g.prepare(name, method, args)
+	if err != nil {
+		return nil, err
+	}
+	if m.IsConstant() {
+		return nil, fmt.Errorf("%w: %s", ErrReadOnly, m.Name)
+	}
+	if opts.Value != nil && opts.Value.Sign() > 0 && !m.IsPayable() {
+		return nil, fmt.Errorf("%w: %s is not payable", ErrInvalidArgument, m.Name)
+	}
+
+	return g.signer.Transact(ctx, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		auth.Value = opts.Value
+		auth.GasLimit = opts.GasLimit
+		return b.instance.Transact(auth, m.Name, params...)
+	})
+}
+
+// prepare looks up the contract and method and converts args against the method inputs.
+func (g *Gateway) prepare(name, method string, args []json.RawMessage) (*bound, abi.Method, []interface{}, error) {
+	b, err := g.lookup(name)
+	if err != nil {
+		return nil, abi.Method{}, nil, err
+	}
+	m, ok := b.abi.Methods[method]
+	if !ok {
+		return nil, abi.Method{}, nil, fmt.Errorf("%w %q on %s", ErrUnknownMethod, method, name)
+	}
+	if len(args) != len(m.Inputs) {
+		return nil, abi.Method{}, nil, fmt.Errorf("%w: %s takes %d arguments, got %d", ErrInvalidArgument, m.Sig, len(m.Inputs), len(args))
+	}
+
+	params := make([]interface{}, len(args))
+	for i, input := range m.Inputs {
+		v, err := decode(input.Type, args[i])
+		if err != nil {
+			label := input.Name
+			if label == "" {
+				label = fmt.Sprintf("#%d", i)
+			}
+			return nil, abi.Method{}, nil, fmt.Errorf("argument %s: %w", label, err)
+		}
+		params[i] = v.Interface()
+	}
+	return b, m, params, nil
+}
@@ -0,0 +1,225 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+type registerRequest struct {
+	Name    string          `json:"name"`
+	Address string          `json:"address"`
+	ABI     json.RawMessage `json:"abi"`
+}
+
+type callRequest struct {
+	Args  []json.RawMessage `json:"args"`
+	Block *uint64           `json:"block"`
+}
+
+type transactRequest struct {
+	Args     []json.RawMessage `json:"args"`
+	Value    string            `json:"value"`
+	GasLimit uint64            `json:"gas_limit"`
+}
+
+type callResponse struct {
+	Outputs []Value `json:"outputs"`
+}
+
+type transactResponse struct {
+	TxHash   string `json:"tx_hash"`
+	Nonce    uint64 `json:"nonce"`
+	GasLimit uint64 `json:"gas_limit"`
+}
+
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrForbidden), errors.Is(err, ErrTokenMethod):
+		return http.StatusForbidden
+	case errors.Is(err, policy.ErrRejected):
+		return policy.HTTPStatus(err)
+	case errors.Is(err, limits.ErrLimitExceeded):
+		return limits.HTTPStatus(err)
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrUnknownMethod):
+		return http.StatusNotFound
+	case errors.Is(err, ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidArgument), errors.Is(err, ErrInvalidName), errors.Is(err, ErrReadOnly):
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// ListHandler serves GET /contracts, the registered contracts.
+func (g *Gateway) ListHandler(w http.ResponseWriter, req *http.Request) {
+	contracts, err := g.List()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, contracts)
+}
+
+// GetHandler serves GET /contracts/{name}, a contract and its ABI.
+func (g *Gateway) GetHandler(w http.ResponseWriter, req *http.Request) {
+	c, err := g.Get(router.Param(req, "name"))
+	if err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, c)
+}
+
+// DeleteHandler serves DELETE /contracts/{name}.
+func (g *Gateway) DeleteHandler(w http.ResponseWriter, req *http.Request) {
+	if err := g.Delete(router.Param(req, "name")); err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegisterHandler serves POST /contracts {"name", "address", "abi"}, or a raw ABI file
+// uploaded with ?name=&address=.
+func (g *Gateway) RegisterHandler(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var r registerRequest
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		// a raw ABI file, e.g. curl --data-binary @MyContract.abi
+		r.Name = req.URL.Query().Get("name")
+		r.Address = req.URL.Query().Get("address")
+		r.ABI = body
+	} else if err := json.Unmarshal(body, &r); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	// the ABI may also be given as a JSON-encoded string
+	var s string
+	if json.Unmarshal(r.ABI, &s) == nil {
+		r.ABI = json.RawMessage(s)
+	}
+	address, err := api.Address("address", r.Address)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := g.Register(r.Name, address, r.ABI)
+	if err != nil {
+		status := httpStatus(err)
+		if status == http.StatusBadGateway {
+			status = http.StatusBadRequest
+		}
+		api.WriteError(w, status, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, c)
+}
+
+// CallHandler serves POST /contracts/{name}/call/{method} {"args": [...], "block": n}, a
+// call without a transaction.
+func (g *Gateway) CallHandler(w http.ResponseWriter, req *http.Request) {
+	name, method := router.Param(req, "name"), router.Param(req, "method")
+	var r callRequest
+	if err := decodeBody(req, &r); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var block *big.Int
+	if r.Block != nil {
+		block = new(big.Int).SetUint64(*r.Block)
+	}
+
+	outputs, err := g.Call(req.Context(), name, method, r.Args, block)
+	if err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, callResponse{Outputs: outputs})
+}
+
+// TransactHandler serves POST /contracts/{name}/transact/{method} {"args": [...],
+// "value": "wei", "gas_limit": n}. Transactions are checked like transfers for the ETH they
+// send and, for transfer on a registered token, the tokens, and wait for approval when a
+// rule applies.
+func (g *Gateway) TransactHandler(w http.ResponseWriter, req *http.Request) {
+	name, method := router.Param(req, "name"), router.Param(req, "method")
+	var r transactRequest
+	if err := decodeBody(req, &r); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts := TransactOpts{GasLimit: r.GasLimit}
+	if r.Value != "" {
+		// in wei
+		value, err := api.NonNegativeAmount("value", r.Value, 0)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		opts.Value = value
+	}
+
+	c, err := g.Get(name)
+	if err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	move, err := g.check(req.Context(), c, method, r.Args, opts.Value)
+	if err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	if move != nil {
+		rule, err := g.approvals.Required(move.asset, move.amount)
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if rule != nil {
+			summary := fmt.Sprintf("%s.%s sending %s", c.Name, method, move)
+			payload := approvedTransaction{Name: c.Name, Method: method, Args: r.Args, Value: opts.Value, GasLimit: opts.GasLimit}
+			areq, err := g.approvals.Submit(req.Context(), rule, ApprovalKind, summary, move.asset, move.amount, payload)
+			if err != nil {
+				api.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+			w.Header().Set("Location", "/approvals/"+areq.ID)
+			api.WriteJSON(w, http.StatusAccepted, areq)
+			return
+		}
+	}
+
+	tx, err := g.send(req.Context(), c, method, r.Args, opts, move)
+	if err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusAccepted, transactResponse{TxHash: tx.Hash().Hex(), Nonce: tx.Nonce(), GasLimit: tx.Gas()})
+}
+
+// decodeBody decodes a JSON body; an empty body leaves v unchanged.
+func decodeBody(req *http.Request, v interface{}) error {
+	err := json.NewDecoder(req.Body).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
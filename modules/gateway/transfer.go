@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"math/big"
+)
+
+const (
+	// ApprovalKind names gateway transactions in the approval workflow.
+	ApprovalKind = "contract_transact"
+
+	transferSig = "transfer(address,uint256)"
+)
+
+// movement is what a transaction takes out of the service wallet: ETH sent as value, or
+// tokens sent with transfer on a registered token.
+type movement struct {
+	asset  auth.Asset
+	amount *big.Int
+	to     *common.Address // token recipient, nil for ETH value
+}
+
+func (m *movement) String() string {
+	return units.FormatAmount(m.amount, m.asset.Decimals) + " " + m.asset.Symbol
+}
+
+// check works out what calling method on c with args moves and checks it like a transfer
+// of the same amount: the token and amount restrictions of the caller in ctx and the
+// recipient policy. Methods of registered tokens other than transfer, such as approve,
+// could move tokens past those checks and need the admin role.
+func (g *Gateway) check(ctx context.Context, c *Contract, method string, args []json.RawMessage, value *big.Int) (*movement, error) {
+	if err := auth.AuthorizeContract(ctx, c.Name, c.Address); err != nil {
+		return nil, err
+	}
+	var move *movement
+	if value != nil && value.Sign() > 0 {
+		move = &movement{asset: auth.ETH, amount: value}
+	}
+
+	token, _, err := g.registry.Resolve(c.Address.Hex())
+	if errors.Is(err, tokens.ErrUnknownToken) {
+		return move, checkMovement(ctx, move)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, m, params, err := g.prepare(c.Name, method, args)
+	if err != nil {
+		return nil, err
+	}
+	if m.Sig != transferSig {
+		if m.IsConstant() {
+			return nil, fmt.Errorf("%w: %s", ErrReadOnly, m.Name)
+		}
+		if p := auth.FromContext(ctx); p != nil && !p.Role.Includes(auth.RoleAdmin) {
+			return nil, fmt.Errorf("%w: %s", ErrTokenMethod, m.Sig)
+		}
+		return move, checkMovement(ctx, move)
+	}
+	to, _ := params[0].(common.Address)
+	amount, _ := params[1].(*big.Int)
+	if move != nil {
+		// transfer isn't payable, Transact refuses it
+		return nil, fmt.Errorf("%w: %s is not payable", ErrInvalidArgument, m.Name)
+	}
+	move = &movement{
+		asset:  auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals},
+		amount: amount,
+		to:     &to,
+	}
+	if err := checkMovement(ctx, move); err != nil {
+		return nil, err
+	}
+	if err := g.policy.Check(ctx, to, &token.Address, "contract "+c.Name+"."+method); err != nil {
+		return nil, err
+	}
+	return move, nil
+}
+
+func checkMovement(ctx context.Context, move *movement) error {
+	if move == nil {
+		return nil
+	}
+	return auth.Authorize(ctx, move.asset, move.amount)
+}
+
+// send records move against the limits of the caller in ctx and sends the transaction,
+// giving the spend back if sending fails.
+func (g *Gateway) send(ctx context.Context, c *Contract, method string, args []json.RawMessage, opts TransactOpts, move *movement) (*types.Transaction, error) {
+	var spent *limits.Entry
+	if move != nil {
+		var err error
+		if spent, err = g.limits.Spend(ctx, move.asset, []*big.Int{move.amount}, "contract "+c.Name+"."+method); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := g.Transact(ctx, c.Name, method, args, opts)
+	if err != nil {
+		if releaseErr := g.limits.Release(spent); releaseErr != nil {
+			log.Printf("gateway: release spend: %v", releaseErr)
+		}
+		return nil, err
+	}
+	return tx, nil
+}
+
+// approvedTransaction is the payload of a gateway transaction waiting for approval.
+type approvedTransaction struct {
+	Name     string            `json:"name"`
+	Method   string            `json:"method"`
+	Args     []json.RawMessage `json:"args"`
+	Value    *big.Int          `json:"value,omitempty"`
+	GasLimit uint64            `json:"gas_limit,omitempty"`
+}
+
+// ExecuteApproved sends a gateway transaction once the approval workflow let it through.
+// Everything is checked again, the contract, lists and key may have changed while it
+// waited.
+func (g *Gateway) ExecuteApproved(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var t approvedTransaction
+	if err := json.Unmarshal(payload, &t); err != nil {
+		return nil, err
+	}
+	c, err := g.Get(t.Name)
+	if err != nil {
+		return nil, err
+	}
+	move, err := g.check(ctx, c, t.Method, t.Args, t.Value)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := g.send(ctx, c, t.Method, t.Args, TransactOpts{Value: t.Value, GasLimit: t.GasLimit}, move)
+	if err != nil {
+		return nil, err
+	}
+	return transactResponse{TxHash: tx.Hash().Hex(), Nonce: tx.Nonce(), GasLimit: tx.Gas()}, nil
+}
@@ -0,0 +1,163 @@
+package holders
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"math/big"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+	// maxVerify bounds verify, which costs one BalanceOf call per sampled holder.
+	maxVerify = 50
+)
+
+type holderResponse struct {
+	Rank             int    `json:"rank"`
+	Address          string `json:"address"`
+	Balance          string `json:"balance"`
+	BalanceFormatted string `json:"balance_formatted"`
+}
+
+type mismatchResponse struct {
+	Address string `json:"address"`
+	Indexed string `json:"indexed"`
+	OnChain string `json:"on_chain"`
+}
+
+type driftResponse struct {
+	Checked    int                `json:"checked"`
+	Mismatches []mismatchResponse `json:"mismatches"`
+	Errors     []string           `json:"errors"`
+}
+
+type holdersResponse struct {
+	Block          uint64           `json:"block"`
+	HolderCount    int              `json:"holder_count"`
+	Total          string           `json:"total"`
+	TotalFormatted string           `json:"total_formatted"`
+	Holders        []holderResponse `json:"holders"`
+	NextOffset     *int             `json:"next_offset,omitempty"`
+	Incomplete     bool             `json:"incomplete"`
+	Warning        string           `json:"warning,omitempty"`
+	Drift          *driftResponse   `json:"drift,omitempty"`
+}
+
+// HoldersHandler serves GET /contract/holders.
+//
+// token selects the token (default token when empty), block defaults to the last indexed block. Holders are ranked by balance and paged with
+// offset and limit. verify=N cross-checks N (at most 50) sampled balances against BalanceOf at that block.
+//
+// The snapshot is marked incomplete when the index misses transfers, such as when it starts
+// after the token was deployed: some account went negative, or the balances don't add up
+// to TotalSupply at the block. The supply check needs an archive node for old blocks and
+// is skipped when the call fails.
+func (s *Service) HoldersHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	token, instance, err := s.registry.Resolve(values.Get("token"))
+	if err != nil {
+		api.WriteError(w, tokens.HTTPStatus(err), err)
+		return
+	}
+	idx, err := s.pool.Get(token.Address.Hex())
+	if err != nil {
+		api.WriteError(w, tokens.HTTPStatus(err), err)
+		return
+	}
+
+	last, ok, err := idx.LastBlock()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		api.WriteError(w, http.StatusServiceUnavailable, ErrNotIndexed)
+		return
+	}
+
+	block := last
+	if v := values.Get("block"); v != "" {
+		if block, err = strconv.ParseUint(v, 10, 64); err != nil {
+			api.WriteError(w, http.StatusBadRequest, api.Invalid("block", v, api.ReasonMalformed))
+			return
+		}
+	}
+	offset, err := api.ParseInt(values, "offset", 0)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := api.ParseLimit(values, "limit", defaultLimit, maxLimit)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	sample, err := api.ParseInt(values, "verify", 0)
+	if err == nil && sample > maxVerify {
+		err = api.Invalid("verify", values.Get("verify"), api.ReasonTooLarge)
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	decimals := token.Decimals
+
+	snap, err := s.Snapshot(idx, block)
+	if errors.Is(err, ErrNotIndexed) {
+		api.WriteError(w, http.StatusConflict, fmt.Errorf("%w: last indexed block is %d", err, last))
+		return
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := holdersResponse{
+		Block:          snap.Block,
+		HolderCount:    len(snap.Holders),
+		Total:          snap.Total.String(),
+		TotalFormatted: units.FormatAmount(snap.Total, decimals),
+		Holders:        []holderResponse{},
+	}
+	for i := offset; i < len(snap.Holders) && i < offset+limit; i++ {
+		h := snap.Holders[i]
+		resp.Holders = append(resp.Holders, holderResponse{
+			Rank:             i + 1,
+			Address:          h.Address.Hex(),
+			Balance:          h.Balance.String(),
+			BalanceFormatted: units.FormatAmount(h.Balance, decimals),
+		})
+	}
+	if next := offset + limit; next < len(snap.Holders) {
+		resp.NextOffset = &next
+	}
+	if snap.Negative > 0 {
+		resp.Incomplete = true
+		resp.Warning = fmt.Sprintf("%d accounts sent more than they received since block %d and are left out; earlier transfers are not indexed", snap.Negative, idx.StartBlock)
+	} else if supply, err := instance.TotalSupply(&bind.CallOpts{Context: r.Context(), BlockNumber: new(big.Int).SetUint64(snap.Block)}); err == nil && supply.Cmp(snap.Total) != 0 {
+		resp.Incomplete = true
+		resp.Warning = fmt.Sprintf("balances add up to %s but the total supply is %s; transfers before block %d are not indexed", resp.TotalFormatted, units.FormatAmount(supply, decimals), idx.StartBlock)
+	}
+
+	if sample > 0 {
+		report := s.Verify(r.Context(), instance, snap, sample)
+		resp.Drift = &driftResponse{Checked: report.Checked, Mismatches: []mismatchResponse{}, Errors: report.Errors}
+		for _, m := range report.Mismatches {
+			resp.Drift.Mismatches = append(resp.Drift.Mismatches, mismatchResponse{
+				Address: m.Address.Hex(),
+				Indexed: m.Indexed.String(),
+				OnChain: m.OnChain.String(),
+			})
+		}
+	}
+	api.WriteJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,214 @@
+package holders
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/indexer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+const cacheSize = 8
+
+var ErrNotIndexed = errors.New("block is not indexed yet")
+
+type Holder struct {
+	Address common.Address
+	Balance *big.Int
+}
+
+// Snapshot holds every positive balance at the end of Block, ranked by balance.
+type Snapshot struct {
+	Block   uint64
+	Holders []Holder
+	Total   *big.Int
+	// Negative counts the accounts that sent more than they received in the indexed
+	// transfers. Their earlier transfers are missing, so they are left out of Holders.
+	Negative int
+
+	balances map[common.Address]*big.Int // every replayed balance, later blocks continue from it
+}
+
+// Mismatch is a holder whose indexed balance differs from BalanceOf at the snapshot block.
+type Mismatch struct {
+	Address common.Address
+	Indexed *big.Int
+	OnChain *big.Int
+}
+
+type DriftReport struct {
+	Checked    int
+	Mismatches []Mismatch
+	Errors     []string
+}
+
+type cacheKey struct {
+	token common.Address
+	block uint64
+}
+
+// Service derives holder balances from the indexed Transfer stream of each token.
+type Service struct {
+	pool     *indexer.Pool
+	registry *tokens.Registry
+
+	mu    sync.Mutex
+	cache map[cacheKey]*Snapshot
+	order []cacheKey
+}
+
+func New(pool *indexer.Pool, registry *tokens.Registry) *Service {
+	return &Service{
+		pool:     pool,
+		registry: registry,
+		cache:    make(map[cacheKey]*Snapshot),
+	}
+}
+
+// Snapshot replays the transfers indexed by idx up to block. Recent snapshots are cached
+// since a block's balances never change once it is indexed, and a snapshot continues from
+// the latest cached one before its block, so only the first replays the whole index.
+func (s *Service) Snapshot(idx *indexer.Indexer, block uint64) (*Snapshot, error) {
+	last, ok, err := idx.LastBlock()
+	if err != nil {
+		return nil, err
+	}
+	if !ok || block > last {
+		return nil, ErrNotIndexed
+	}
+
+	key := cacheKey{token: idx.Token(), block: block}
+	s.mu.Lock()
+	snap, cached := s.cache[key]
+	base := s.checkpoint(key)
+	s.mu.Unlock()
+	if cached {
+		return snap, nil
+	}
+
+	balances := make(map[common.Address]*big.Int)
+	from := uint64(0)
+	if base != nil {
+		for addr, balance := range base.balances {
+			balances[addr] = new(big.Int).Set(balance)
+		}
+		from = base.Block + 1
+	}
+	err = idx.EachTransfer(from, block, func(t *indexer.Transfer) error {
+		if t.From != (common.Address{}) {
+			sub(balances, t.From, t.Value)
+		}
+		if t.To != (common.Address{}) {
+			add(balances, t.To, t.Value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	snap = &Snapshot{Block: block, Total: new(big.Int), balances: balances}
+	for addr, balance := range balances {
+		if balance.Sign() < 0 {
+			snap.Negative++
+		}
+		if balance.Sign() <= 0 {
+			continue
+		}
+		snap.Holders = append(snap.Holders, Holder{Address: addr, Balance: balance})
+		snap.Total.Add(snap.Total, balance)
+	}
+	sort.Slice(snap.Holders, func(a, b int) bool {
+		if c := snap.Holders[a].Balance.Cmp(snap.Holders[b].Balance); c != 0 {
+			return c > 0
+		}
+		return bytes.Compare(snap.Holders[a].Address.Bytes(), snap.Holders[b].Address.Bytes()) < 0
+	})
+
+	s.mu.Lock()
+	if _, ok := s.cache[key]; !ok {
+		s.cache[key] = snap
+		s.order = append(s.order, key)
+		if len(s.order) > cacheSize {
+			delete(s.cache, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+	s.mu.Unlock()
+	return snap, nil
+}
+
+// checkpoint returns the cached snapshot of the same token with the highest block before
+// key's, or nil. The caller holds s.mu.
+func (s *Service) checkpoint(key cacheKey) *Snapshot {
+	var best *Snapshot
+	for k, snap := range s.cache {
+		if k.token == key.token && k.block < key.block && (best == nil || k.block > best.Block) {
+			best = snap
+		}
+	}
+	return best
+}
+
+// Verify compares up to sample randomly chosen holders, plus the top holder, against BalanceOf
+// at the snapshot block. Calls for old blocks need an archive node; failures are reported, not fatal.
+func (s *Service) Verify(ctx context.Context, instance *contract.MyContract, snap *Snapshot, sample int) *DriftReport {
+	report := &DriftReport{Mismatches: []Mismatch{}, Errors: []string{}}
+	if sample <= 0 || len(snap.Holders) == 0 {
+		return report
+	}
+
+	picks := rand.Perm(len(snap.Holders))
+	if len(picks) > sample {
+		picks = picks[:sample]
+	}
+	if !contains(picks, 0) {
+		picks[len(picks)-1] = 0
+	}
+
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(snap.Block)}
+	for _, i := range picks {
+		holder := snap.Holders[i]
+		onChain, err := instance.BalanceOf(opts, holder.Address)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", holder.Address.Hex(), err))
+			continue
+		}
+		report.Checked++
+		if onChain.Cmp(holder.Balance) != 0 {
+			report.Mismatches = append(report.Mismatches, Mismatch{Address: holder.Address, Indexed: holder.Balance, OnChain: onChain})
+		}
+	}
+	return report
+}
+
+func add(balances map[common.Address]*big.Int, addr common.Address, value *big.Int) {
+	if _, ok := balances[addr]; !ok {
+		balances[addr] = new(big.Int)
+	}
+	balances[addr].Add(balances[addr], value)
+}
+
+func sub(balances map[common.Address]*big.Int, addr common.Address, value *big.Int) {
+	if _, ok := balances[addr]; !ok {
+		balances[addr] = new(big.Int)
+	}
+	balances[addr].Sub(balances[addr], value)
+}
+
+func contains(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package indexer
+
+import (
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"net/http"
+	"net/url"
+)
+
+type transferResponse struct {
+	BlockNumber    uint64 `json:"block_number"`
+	BlockTime      uint64 `json:"block_time"`
+	TxHash         string `json:"tx_hash"`
+	LogIndex       uint   `json:"log_index"`
+	From           string `json:"from"`
+	To             string `json:"to"`
+	Value          string `json:"value"`
+	ValueFormatted string `json:"value_formatted"`
+}
+
+type transferPageResponse struct {
+	Transfers  []transferResponse `json:"transfers"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// ContractTransfersHandler serves GET /contract/transfers.
+//
+// Query parameters: token (symbol or address, default token when empty), from, to,
+// from_block, to_block, from_time, to_time (unix seconds or RFC3339),
+// min_amount, max_amount (decimal token amounts), order (asc|desc), limit and cursor.
+// A lower bound above its upper bound is a 400; a cursor stays within the block range.
+func (p *Pool) ContractTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	idx, err := p.Get(r.URL.Query().Get("token"))
+	if err != nil {
+		api.WriteError(w, tokens.HTTPStatus(err), err)
+		return
+	}
+	idx.serveTransfers(w, r, nil)
+}
+
+// AccountTransfersHandler serves GET /accounts/{address}/transfers with the same parameters
+// as ContractTransfersHandler, restricted to transfers sent or received by address.
+func (p *Pool) AccountTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	account, err := api.HexAddress("address", router.Param(r, "address"))
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	idx, err := p.Get(r.URL.Query().Get("token"))
+	if err != nil {
+		api.WriteError(w, tokens.HTTPStatus(err), err)
+		return
+	}
+	idx.serveTransfers(w, r, &account)
+}
+
+func (i *Indexer) serveTransfers(w http.ResponseWriter, r *http.Request, account *common.Address) {
+	decimals, err := i.Decimals()
+	if err != nil {
+		api.WriteError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	q, err := parseTransferQuery(r.URL.Query(), decimals)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	q.Account = account
+
+	page, err := i.Transfers(q)
+	if errors.Is(err, ErrInvalidCursor) {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := transferPageResponse{Transfers: make([]transferResponse, 0, len(page.Transfers)), NextCursor: page.NextCursor}
+	for _, t := range page.Transfers {
+		resp.Transfers = append(resp.Transfers, transferResponse{
+			BlockNumber:    t.BlockNumber,
+			BlockTime:      t.BlockTime,
+			TxHash:         t.TxHash.Hex(),
+			LogIndex:       t.LogIndex,
+			From:           t.From.Hex(),
+			To:             t.To.Hex(),
+			Value:          t.Value.String(),
+			ValueFormatted: units.FormatAmount(t.Value, decimals),
+		})
+	}
+	api.WriteJSON(w, http.StatusOK, resp)
+}
+
+func parseTransferQuery(values url.Values, decimals uint8) (TransferQuery, error) {
+	var q TransferQuery
+	var err error
+
+	if q.From, err = api.ParseAddress(values, "from"); err != nil {
+		return q, err
+	}
+	if q.To, err = api.ParseAddress(values, "to"); err != nil {
+		return q, err
+	}
+	if q.FromBlock, err = api.ParseUint(values, "from_block"); err != nil {
+		return q, err
+	}
+	if q.ToBlock, err = api.ParseUint(values, "to_block"); err != nil {
+		return q, err
+	}
+	if q.FromTime, err = api.ParseTime(values, "from_time"); err != nil {
+		return q, err
+	}
+	if q.ToTime, err = api.ParseTime(values, "to_time"); err != nil {
+		return q, err
+	}
+	if v := values.Get("min_amount"); v != "" {
+		if q.MinAmount, err = api.NonNegativeAmount("min_amount", v, decimals); err != nil {
+			return q, err
+		}
+	}
+	if v := values.Get("max_amount"); v != "" {
+		if q.MaxAmount, err = api.NonNegativeAmount("max_amount", v, decimals); err != nil {
+			return q, err
+		}
+	}
+
+	if q.ToBlock != 0 && q.FromBlock > q.ToBlock {
+		return q, api.Invalid("from_block", values.Get("from_block"), api.ReasonEmptyRange)
+	}
+	if q.ToTime != 0 && q.FromTime > q.ToTime {
+		return q, api.Invalid("from_time", values.Get("from_time"), api.ReasonEmptyRange)
+	}
+	if q.MinAmount != nil && q.MaxAmount != nil && q.MinAmount.Cmp(q.MaxAmount) > 0 {
+		return q, api.Invalid("min_amount", values.Get("min_amount"), api.ReasonEmptyRange)
+	}
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return q, api.Invalid("order", values.Get("order"), api.ReasonMalformed)
+	}
+
+	if q.Limit, err = api.ParseInt(values, "limit", 0); err != nil {
+		return q, err
+	}
+	q.Cursor = values.Get("cursor")
+	return q, nil
+}
@@ -0,0 +1,300 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const lastBlockMeta = "events/last_block"
+
+// Backend is what the indexer needs from a node: log filtering, headers
+// for block times, and transactions and receipts for fees.
+type Backend interface {
+	bind.ContractBackend
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+	TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+}
+
+// Transfer is an indexed Transfer event.
+type Transfer struct {
+	BlockNumber uint64         `json:"block_number"`
+	BlockTime   uint64         `json:"block_time"`
+	TxHash      common.Hash    `json:"tx_hash"`
+	TxFee       *big.Int       `json:"tx_fee"` // wei paid by the transaction that emitted the event
+	LogIndex    uint           `json:"log_index"`
+	From        common.Address `json:"from"`
+	To          common.Address `json:"to"`
+	Value       *big.Int       `json:"value"`
+}
+
+// Approval is an indexed Approval event.
+type Approval struct {
+	BlockNumber uint64         `json:"block_number"`
+	BlockTime   uint64         `json:"block_time"`
+	TxHash      common.Hash    `json:"tx_hash"`
+	TxFee       *big.Int       `json:"tx_fee"`
+	LogIndex    uint           `json:"log_index"`
+	Owner       common.Address `json:"owner"`
+	Spender     common.Address `json:"spender"`
+	Value       *big.Int       `json:"value"`
+}
+
+// Indexer copies Transfer and Approval events of a token contract into the store
+// so that history can be queried without scanning the chain.
+type Indexer struct {
+	backend  Backend
+	store    *store.Store
+	token    common.Address
+	instance *contract.MyContract
+
+	StartBlock    uint64        // first block to index, usually the deployment block
+	Confirmations uint64        // blocks behind head to stay clear of reorgs
+	BatchSize     uint64        // blocks per eth_getLogs request
+	Interval      time.Duration // delay between polls once caught up
+
+	mu       sync.Mutex
+	decimals *uint8
+}
+
+func New(backend Backend, db *store.Store, token common.Address) (*Indexer, error) {
+	instance, err := contract.NewMyContract(token, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &Indexer{
+		backend:       backend,
+		store:         db,
+		token:         token,
+		instance:      instance,
+		Confirmations: 6,
+		BatchSize:     2000,
+		Interval:      15 * time.Second,
+	}, nil
+}
+
+func (i *Indexer) Token() common.Address {
+	return i.token
+}
+
+// Decimals returns the token decimals, cached after the first successful call.
+func (i *Indexer) Decimals() (uint8, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.decimals != nil {
+		return *i.decimals, nil
+	}
+	decimals, err := i.instance.Decimals(nil)
+	if err != nil {
+		return 0, err
+	}
+	i.decimals = &decimals
+	return decimals, nil
+}
+
+// LastBlock returns the last fully indexed block and whether anything has been indexed yet.
+func (i *Indexer) LastBlock() (uint64, bool, error) {
+	var last uint64
+	err := i.store.Get(metaKey(i.token, lastBlockMeta), &last)
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return last, true, nil
+}
+
+// Run indexes until ctx is cancelled.
+func (i *Indexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(i.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := i.Sync(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("indexer: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync indexes every confirmed block that has not been indexed yet.
+func (i *Indexer) Sync(ctx context.Context) error {
+	head, err := i.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if head.Number.Uint64() < i.Confirmations {
+		return nil
+	}
+	target := head.Number.Uint64() - i.Confirmations
+
+	next := i.StartBlock
+	last, ok, err := i.LastBlock()
+	if err != nil {
+		return err
+	}
+	if ok {
+		next = last + 1
+	}
+
+	for next <= target {
+		end := next + i.BatchSize - 1
+		if end > target {
+			end = target
+		}
+		if err := i.indexRange(ctx, next, end); err != nil {
+			return err
+		}
+		next = end + 1
+	}
+	return nil
+}
+
+// blockInfo caches headers and transaction fees while indexing a range.
+type blockInfo struct {
+	backend Backend
+	headers map[uint64]*types.Header
+	fees    map[common.Hash]*big.Int
+}
+
+func (b *blockInfo) header(ctx context.Context, number uint64) (*types.Header, error) {
+	if h, ok := b.headers[number]; ok {
+		return h, nil
+	}
+	h, err := b.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, err
+	}
+	b.headers[number] = h
+	return h, nil
+}
+
+// fee returns gas used times the effective gas price, which for dynamic fee
+// transactions is the base fee plus the tip, capped by the fee cap.
+func (b *blockInfo) fee(ctx context.Context, hash common.Hash, header *types.Header) (*big.Int, error) {
+	if fee, ok := b.fees[hash]; ok {
+		return fee, nil
+	}
+	tx, _, err := b.backend.TransactionByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := b.backend.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	price := tx.GasPrice()
+	if tx.Type() == types.DynamicFeeTxType && header.BaseFee != nil {
+		price = new(big.Int).Add(header.BaseFee, tx.GasTipCap())
+		if price.Cmp(tx.GasFeeCap()) > 0 {
+			price = tx.GasFeeCap()
+		}
+	}
+	fee := new(big.Int).Mul(price, new(big.Int).SetUint64(receipt.GasUsed))
+	b.fees[hash] = fee
+	return fee, nil
+}
+
+func (i *Indexer) indexRange(ctx context.Context, start, end uint64) error {
+	info := &blockInfo{backend: i.backend, headers: make(map[uint64]*types.Header), fees: make(map[common.Hash]*big.Int)}
+	batch := new(store.Batch)
+	opts := &bind.FilterOpts{Start: start, End: &end, Context: ctx}
+
+	transfers, err := i.instance.FilterTransfer(opts, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer transfers.Close()
+	for transfers.Next() {
+		ev := transfers.Event
+		if ev.Raw.Removed {
+			continue
+		}
+		header, err := info.header(ctx, ev.Raw.BlockNumber)
+		if err != nil {
+			return err
+		}
+		fee, err := info.fee(ctx, ev.Raw.TxHash, header)
+		if err != nil {
+			return err
+		}
+
+		pos := position(ev.Raw.BlockNumber, ev.Raw.Index)
+		err = batch.Put(transferKey(i.token, pos), &Transfer{
+			BlockNumber: ev.Raw.BlockNumber,
+			BlockTime:   header.Time,
+			TxHash:      ev.Raw.TxHash,
+			TxFee:       fee,
+			LogIndex:    ev.Raw.Index,
+			From:        ev.From,
+			To:          ev.To,
+			Value:       ev.Value,
+		})
+		if err != nil {
+			return err
+		}
+		batch.PutRaw(accountKey(i.token, ev.From, pos), nil)
+		if ev.To != ev.From {
+			batch.PutRaw(accountKey(i.token, ev.To, pos), nil)
+		}
+	}
+	if err := transfers.Error(); err != nil {
+		return err
+	}
+
+	approvals, err := i.instance.FilterApproval(opts, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer approvals.Close()
+	for approvals.Next() {
+		ev := approvals.Event
+		if ev.Raw.Removed {
+			continue
+		}
+		header, err := info.header(ctx, ev.Raw.BlockNumber)
+		if err != nil {
+			return err
+		}
+		fee, err := info.fee(ctx, ev.Raw.TxHash, header)
+		if err != nil {
+			return err
+		}
+
+		err = batch.Put(approvalKey(i.token, position(ev.Raw.BlockNumber, ev.Raw.Index)), &Approval{
+			BlockNumber: ev.Raw.BlockNumber,
+			BlockTime:   header.Time,
+			TxHash:      ev.Raw.TxHash,
+			TxFee:       fee,
+			LogIndex:    ev.Raw.Index,
+			Owner:       ev.Owner,
+			Spender:     ev.Spender,
+			Value:       ev.Value,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := approvals.Error(); err != nil {
+		return err
+	}
+
+	if err := batch.Put(metaKey(i.token, lastBlockMeta), end); err != nil {
+		return err
+	}
+	return i.store.Write(batch)
+}
@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Key layout:
+//
+//	t/<token>/<position>            -> Transfer
+//	p/<token>/<position>            -> Approval
+//	a/<token>/<account>/<position>  -> (empty) index of transfers by sender and recipient
+//	m/<token>/<name>                -> indexer metadata such as the last indexed block
+//
+// position is the big-endian block number followed by the big-endian log index,
+// so events are stored in chain order.
+const (
+	prefixTransfer = "t/"
+	prefixApproval = "p/"
+	prefixAccount  = "a/"
+	prefixMeta     = "m/"
+
+	positionLen = 12
+)
+
+func position(block uint64, logIndex uint) []byte {
+	pos := make([]byte, positionLen)
+	binary.BigEndian.PutUint64(pos[:8], block)
+	binary.BigEndian.PutUint32(pos[8:], uint32(logIndex))
+	return pos
+}
+
+func join(parts ...[]byte) []byte {
+	var key []byte
+	for _, p := range parts {
+		key = append(key, p...)
+	}
+	return key
+}
+
+func transferPrefix(token common.Address) []byte {
+	return join([]byte(prefixTransfer), token.Bytes())
+}
+
+func transferKey(token common.Address, pos []byte) []byte {
+	return join(transferPrefix(token), pos)
+}
+
+func approvalPrefix(token common.Address) []byte {
+	return join([]byte(prefixApproval), token.Bytes())
+}
+
+func approvalKey(token common.Address, pos []byte) []byte {
+	return join(approvalPrefix(token), pos)
+}
+
+func accountPrefix(token, account common.Address) []byte {
+	return join([]byte(prefixAccount), token.Bytes(), account.Bytes())
+}
+
+func accountKey(token, account common.Address, pos []byte) []byte {
+	return join(accountPrefix(token, account), pos)
+}
+
+func metaKey(token common.Address, name string) []byte {
+	return join([]byte(prefixMeta), token.Bytes(), []byte(name))
+}
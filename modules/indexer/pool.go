@@ -0,0 +1,82 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/ethereum/go-ethereum/common"
+	"log"
+	"sync"
+)
+
+// Pool runs one indexer per registered token.
+type Pool struct {
+	backend  Backend
+	store    *store.Store
+	registry *tokens.Registry
+
+	mu       sync.Mutex
+	indexers map[common.Address]*Indexer
+	cancels  map[common.Address]context.CancelFunc
+}
+
+func NewPool(backend Backend, db *store.Store, registry *tokens.Registry) *Pool {
+	return &Pool{
+		backend:  backend,
+		store:    db,
+		registry: registry,
+		indexers: make(map[common.Address]*Indexer),
+		cancels:  make(map[common.Address]context.CancelFunc),
+	}
+}
+
+// Start begins indexing token until ctx is cancelled or the token is stopped.
+func (p *Pool) Start(ctx context.Context, token tokens.Token) {
+	idx, err := New(p.backend, p.store, token.Address)
+	if err != nil {
+		log.Printf("indexer: %s: %v", token.Address.Hex(), err)
+		return
+	}
+	idx.StartBlock = token.StartBlock
+
+	ctx, cancel := context.WithCancel(ctx)
+	p.mu.Lock()
+	if _, ok := p.indexers[token.Address]; ok {
+		p.mu.Unlock()
+		cancel()
+		return
+	}
+	p.indexers[token.Address] = idx
+	p.cancels[token.Address] = cancel
+	p.mu.Unlock()
+
+	go idx.Run(ctx)
+}
+
+// Stop stops indexing token. Already indexed events are kept.
+func (p *Pool) Stop(token tokens.Token) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cancel, ok := p.cancels[token.Address]; ok {
+		cancel()
+	}
+	delete(p.indexers, token.Address)
+	delete(p.cancels, token.Address)
+}
+
+// Get returns the indexer of the token identified by id, a symbol or an address.
+// An empty id means the default token.
+func (p *Pool) Get(id string) (*Indexer, error) {
+	token, _, err := p.registry.Resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idx, ok := p.indexers[token.Address]
+	if !ok {
+		return nil, fmt.Errorf("%w %q: not indexed", tokens.ErrUnknownToken, id)
+	}
+	return idx, nil
+}
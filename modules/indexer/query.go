@@ -0,0 +1,199 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TransferQuery filters indexed transfers. Zero values mean "no filter".
+type TransferQuery struct {
+	Account   *common.Address // sender or recipient
+	From      *common.Address
+	To        *common.Address
+	FromBlock uint64
+	ToBlock   uint64
+	FromTime  uint64 // unix seconds, inclusive
+	ToTime    uint64 // unix seconds, inclusive
+	MinAmount *big.Int
+	MaxAmount *big.Int
+
+	Cursor     string
+	Limit      int
+	Descending bool
+}
+
+type TransferPage struct {
+	Transfers  []*Transfer
+	NextCursor string
+}
+
+func (q *TransferQuery) match(t *Transfer) bool {
+	if q.Account != nil && t.From != *q.Account && t.To != *q.Account {
+		return false
+	}
+	if q.From != nil && t.From != *q.From {
+		return false
+	}
+	if q.To != nil && t.To != *q.To {
+		return false
+	}
+	if q.FromTime != 0 && t.BlockTime < q.FromTime {
+		return false
+	}
+	if q.ToTime != 0 && t.BlockTime > q.ToTime {
+		return false
+	}
+	if q.MinAmount != nil && t.Value.Cmp(q.MinAmount) < 0 {
+		return false
+	}
+	if q.MaxAmount != nil && t.Value.Cmp(q.MaxAmount) > 0 {
+		return false
+	}
+	return true
+}
+
+// past reports whether t and every transfer after it in iteration order are out of the time range.
+func (q *TransferQuery) past(t *Transfer) bool {
+	if q.Descending {
+		return q.FromTime != 0 && t.BlockTime < q.FromTime
+	}
+	return q.ToTime != 0 && t.BlockTime > q.ToTime
+}
+
+// Transfers returns one page of indexed transfers in chain order.
+func (i *Indexer) Transfers(q TransferQuery) (*TransferPage, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+
+	// Walk the narrowest index available. Account index entries carry no value
+	// and point at the primary record through their position suffix.
+	prefix := transferPrefix(i.token)
+	indexed := true
+	switch {
+	case q.Account != nil:
+		prefix = accountPrefix(i.token, *q.Account)
+	case q.From != nil:
+		prefix = accountPrefix(i.token, *q.From)
+	case q.To != nil:
+		prefix = accountPrefix(i.token, *q.To)
+	default:
+		indexed = false
+	}
+
+	var start, limit []byte
+	if q.FromBlock != 0 {
+		start = join(prefix, position(q.FromBlock, 0))
+	}
+	if q.ToBlock != 0 {
+		limit = join(prefix, position(q.ToBlock+1, 0))
+	}
+	if q.Cursor != "" {
+		pos, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil || len(pos) != positionLen {
+			return nil, ErrInvalidCursor
+		}
+		// the cursor narrows the block range, it never widens it
+		if q.Descending {
+			if before := join(prefix, pos); limit == nil || bytes.Compare(before, limit) < 0 {
+				limit = before
+			}
+		} else if after := join(prefix, pos, []byte{0}); bytes.Compare(after, start) > 0 {
+			start = after
+		}
+	}
+
+	page := &TransferPage{Transfers: []*Transfer{}}
+	var lastPos []byte
+	var iterErr error
+	err := i.store.Iterate(prefix, start, limit, q.Descending, func(key, value []byte) bool {
+		pos := key[len(key)-positionLen:]
+
+		t := new(Transfer)
+		if indexed {
+			iterErr = i.store.Get(transferKey(i.token, pos), t)
+		} else {
+			iterErr = json.Unmarshal(value, t)
+		}
+		if iterErr != nil {
+			return false
+		}
+
+		if q.past(t) {
+			return false
+		}
+		if !q.match(t) {
+			return true
+		}
+		if len(page.Transfers) == q.Limit {
+			page.NextCursor = base64.RawURLEncoding.EncodeToString(lastPos)
+			return false
+		}
+		page.Transfers = append(page.Transfers, t)
+		lastPos = append([]byte(nil), pos...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if iterErr != nil {
+		return nil, iterErr
+	}
+	return page, nil
+}
+
+// EachTransfer calls fn for every indexed transfer in blocks [fromBlock, toBlock], in chain order.
+func (i *Indexer) EachTransfer(fromBlock, toBlock uint64, fn func(*Transfer) error) error {
+	prefix := transferPrefix(i.token)
+	start := join(prefix, position(fromBlock, 0))
+	limit := join(prefix, position(toBlock+1, 0))
+
+	var fnErr error
+	err := i.store.Iterate(prefix, start, limit, false, func(key, value []byte) bool {
+		t := new(Transfer)
+		if fnErr = json.Unmarshal(value, t); fnErr != nil {
+			return false
+		}
+		fnErr = fn(t)
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// EachApproval calls fn for every indexed approval in blocks [fromBlock, toBlock], in chain order.
+func (i *Indexer) EachApproval(fromBlock, toBlock uint64, fn func(*Approval) error) error {
+	prefix := approvalPrefix(i.token)
+	start := join(prefix, position(fromBlock, 0))
+	limit := join(prefix, position(toBlock+1, 0))
+
+	var fnErr error
+	err := i.store.Iterate(prefix, start, limit, false, func(key, value []byte) bool {
+		a := new(Approval)
+		if fnErr = json.Unmarshal(value, a); fnErr != nil {
+			return false
+		}
+		fnErr = fn(a)
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
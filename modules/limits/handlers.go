@@ -0,0 +1,39 @@
+package limits
+
+import (
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"net/http"
+)
+
+// HTTPStatus maps limit errors to response status codes.
+func HTTPStatus(err error) int {
+	if errors.Is(err, ErrLimitExceeded) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// Handler serves GET /limits, the caps that apply to the caller and what is left of them.
+// Admins can look at another key with ?key=<id>.
+func (e *Engine) Handler(w http.ResponseWriter, r *http.Request) {
+	keyID := ""
+	p := auth.FromContext(r.Context())
+	if p != nil {
+		keyID = p.ID
+	}
+	if other := r.URL.Query().Get("key"); other != "" && other != keyID {
+		if p != nil && !p.Role.Includes(auth.RoleAdmin) {
+			api.WriteError(w, http.StatusForbidden, errors.New("only admins can view the limits of another key"))
+			return
+		}
+		keyID = other
+	}
+	allowances, err := e.Allowances(keyID)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, allowances)
+}
@@ -0,0 +1,387 @@
+package limits
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/audit"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ScopeGlobal = "global"
+	ScopeKey    = "key"
+
+	PeriodTransaction = "per_transaction"
+	PeriodDaily       = "daily"
+	PeriodMonthly     = "monthly"
+)
+
+var ErrLimitExceeded = errors.New("spending limit exceeded")
+
+// LimitError explains which cap a request ran into.
+type LimitError struct {
+	Scope     string
+	KeyID     string
+	Asset     string
+	Period    string
+	Limit     string
+	Used      string
+	Requested string
+}
+
+func (e *LimitError) Error() string {
+	scope := e.Scope
+	if e.Scope == ScopeKey {
+		scope = "key " + e.KeyID
+	}
+	if e.Period == PeriodTransaction {
+		return fmt.Sprintf("%v: %s %s per transaction limit for %s is %s, requested %s", ErrLimitExceeded, scope, e.Asset, e.Asset, e.Limit, e.Requested)
+	}
+	return fmt.Sprintf("%v: %s %s limit for %s is %s, %s already used, requested %s", ErrLimitExceeded, scope, e.Period, e.Asset, e.Limit, e.Used, e.Requested)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Entry is one transfer in the spend ledger.
+type Entry struct {
+	ID     string         `json:"id"`
+	KeyID  string         `json:"key_id,omitempty"` // empty when authentication is disabled
+	Asset  string         `json:"asset"`
+	Token  common.Address `json:"token"` // zero for ETH
+	Amount *big.Int       `json:"amount"`
+	Source string         `json:"source"` // endpoint or job that sent it
+	At     time.Time      `json:"at"`
+}
+
+// assetID identifies tokens by address, so renaming a symbol keeps its history.
+func assetID(symbol string, token common.Address) string {
+	if token == (common.Address{}) {
+		return strings.ToUpper(symbol)
+	}
+	return token.Hex()
+}
+
+func (e *Entry) assetID() string {
+	return assetID(e.Asset, e.Token)
+}
+
+// Engine enforces the configured caps. Spends are written to the ledger before the
+// transfer is sent, so concurrent requests can't both fit under the same allowance; a
+// send that fails gives its spend back with Release.
+type Engine struct {
+	store    *store.Store
+	registry *tokens.Registry
+	cfg      config.Limits
+
+	mu sync.Mutex
+}
+
+func New(db *store.Store, registry *tokens.Registry, cfg config.Limits) *Engine {
+	return &Engine{store: db, registry: registry, cfg: cfg}
+}
+
+func entryKey(id string) []byte {
+	return []byte("l/e/" + id)
+}
+
+// periodKey is the first ledger key at or after t.
+func periodKey(t time.Time) []byte {
+	return entryKey(fmt.Sprintf("%016x", t.UnixNano()))
+}
+
+func newEntryID(now time.Time) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%016x%s", now.UnixNano(), hex.EncodeToString(b))
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// rule is a configured limit that applies to a request.
+type rule struct {
+	scope string
+	limit config.Limit
+}
+
+func (e *Engine) rules(keyID string, asset auth.Asset) []rule {
+	var rules []rule
+	for _, l := range e.cfg.Global {
+		if asset.Matches(l.Token) {
+			rules = append(rules, rule{ScopeGlobal, l})
+		}
+	}
+	if keyID == "" {
+		return rules
+	}
+	for _, l := range append(append([]config.Limit{}, e.cfg.PerKey...), e.cfg.Keys[keyID]...) {
+		if asset.Matches(l.Token) {
+			rules = append(rules, rule{ScopeKey, l})
+		}
+	}
+	return rules
+}
+
+// usage is what was spent of one asset this day and month.
+type usage struct {
+	day, month *big.Int
+}
+
+// used sums the ledger for asset since the start of the month, globally and for keyID.
+func (e *Engine) used(keyID string, asset auth.Asset, now time.Time) (global, key usage, err error) {
+	global = usage{new(big.Int), new(big.Int)}
+	key = usage{new(big.Int), new(big.Int)}
+	today := dayStart(now)
+	var decodeErr error
+	err = e.store.Iterate([]byte("l/e/"), periodKey(monthStart(now)), nil, false, func(_, value []byte) bool {
+		var entry Entry
+		if decodeErr = json.Unmarshal(value, &entry); decodeErr != nil {
+			return false
+		}
+		if entry.assetID() != assetID(asset.Symbol, asset.Address) {
+			return true
+		}
+		add := func(u usage) {
+			u.month.Add(u.month, entry.Amount)
+			if !entry.At.Before(today) {
+				u.day.Add(u.day, entry.Amount)
+			}
+		}
+		add(global)
+		if keyID != "" && entry.KeyID == keyID {
+			add(key)
+		}
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	return global, key, err
+}
+
+func parseCap(s string, decimals uint8) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return units.ParseAmount(s, decimals)
+}
+
+// Spend checks the amounts against the caps of the caller in ctx and records them. Each
+// amount is one transfer; a nil amount is a transfer whose size isn't known up front,
+// such as a sweep, and is refused whenever a cap applies.
+func (e *Engine) Spend(ctx context.Context, asset auth.Asset, amounts []*big.Int, source string) (*Entry, error) {
+	keyID := ""
+	if p := auth.FromContext(ctx); p != nil {
+		keyID = p.ID
+	}
+	entry, err := e.SpendAs(keyID, asset, amounts, source)
+	if errors.Is(err, ErrLimitExceeded) {
+		audit.Note(ctx, audit.EventLimit, err.Error())
+	}
+	return entry, err
+}
+
+// SpendAs is Spend on behalf of a key, for jobs that run without a request.
+func (e *Engine) SpendAs(keyID string, asset auth.Asset, amounts []*big.Int, source string) (*Entry, error) {
+	if e == nil {
+		return nil, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now().UTC()
+	total := new(big.Int)
+	known := true
+	for _, a := range amounts {
+		if a == nil {
+			known = false
+			continue
+		}
+		total.Add(total, a)
+	}
+
+	rules := e.rules(keyID, asset)
+	if len(rules) > 0 {
+		if !known {
+			return nil, fmt.Errorf("%w: the %s amount must be known when limits apply", ErrLimitExceeded, asset.Symbol)
+		}
+		global, key, err := e.used(keyID, asset, now)
+		if err != nil {
+			return nil, err
+		}
+		format := func(v *big.Int) string {
+			return units.FormatAmount(v, asset.Decimals)
+		}
+		for _, c := range rules {
+			u := global
+			if c.scope == ScopeKey {
+				u = key
+			}
+			checks := []struct {
+				period string
+				limit  string
+				used   *big.Int
+			}{
+				{PeriodDaily, c.limit.Daily, u.day},
+				{PeriodMonthly, c.limit.Monthly, u.month},
+			}
+			perTx, err := parseCap(c.limit.PerTransaction, asset.Decimals)
+			if err != nil {
+				return nil, fmt.Errorf("%s limit for %s: %w", c.scope, c.limit.Token, err)
+			}
+			for _, a := range amounts {
+				if perTx != nil && a.Cmp(perTx) > 0 {
+					return nil, &LimitError{Scope: c.scope, KeyID: keyID, Asset: asset.Symbol, Period: PeriodTransaction, Limit: c.limit.PerTransaction, Requested: format(a)}
+				}
+			}
+			for _, check := range checks {
+				limit, err := parseCap(check.limit, asset.Decimals)
+				if err != nil {
+					return nil, fmt.Errorf("%s limit for %s: %w", c.scope, c.limit.Token, err)
+				}
+				if limit != nil && new(big.Int).Add(check.used, total).Cmp(limit) > 0 {
+					return nil, &LimitError{Scope: c.scope, KeyID: keyID, Asset: asset.Symbol, Period: check.period, Limit: check.limit, Used: format(check.used), Requested: format(total)}
+				}
+			}
+		}
+	}
+
+	if !known {
+		// nothing to record, and nothing limits it
+		return nil, nil
+	}
+	entry := &Entry{
+		ID:     newEntryID(now),
+		KeyID:  keyID,
+		Asset:  asset.Symbol,
+		Token:  asset.Address,
+		Amount: total,
+		Source: source,
+		At:     now,
+	}
+	if err := e.store.Put(entryKey(entry.ID), entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Release removes a spend whose transfer was never sent.
+func (e *Engine) Release(entry *Entry) error {
+	if e == nil || entry == nil {
+		return nil
+	}
+	return e.store.Delete(entryKey(entry.ID))
+}
+
+// Window is a daily or monthly cap and what is left of it.
+type Window struct {
+	Limit     string    `json:"limit"`
+	Used      string    `json:"used"`
+	Remaining string    `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// Allowance is one configured cap as it applies to a key right now.
+type Allowance struct {
+	Scope          string          `json:"scope"`
+	Asset          string          `json:"asset"`
+	Token          *common.Address `json:"token,omitempty"`
+	PerTransaction string          `json:"per_transaction,omitempty"`
+	Daily          *Window         `json:"daily,omitempty"`
+	Monthly        *Window         `json:"monthly,omitempty"`
+}
+
+func (e *Engine) resolve(id string) (auth.Asset, error) {
+	if strings.EqualFold(id, auth.ETH.Symbol) {
+		return auth.ETH, nil
+	}
+	token, _, err := e.registry.Resolve(id)
+	if err != nil {
+		return auth.Asset{}, err
+	}
+	return auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}, nil
+}
+
+// Allowances returns the caps that apply to keyID, or only the global ones when it is empty.
+func (e *Engine) Allowances(keyID string) ([]Allowance, error) {
+	allowances := []Allowance{}
+	if e == nil {
+		return allowances, nil
+	}
+	now := time.Now().UTC()
+	limits := make([]rule, 0, len(e.cfg.Global))
+	for _, l := range e.cfg.Global {
+		limits = append(limits, rule{ScopeGlobal, l})
+	}
+	if keyID != "" {
+		for _, l := range append(append([]config.Limit{}, e.cfg.PerKey...), e.cfg.Keys[keyID]...) {
+			limits = append(limits, rule{ScopeKey, l})
+		}
+	}
+
+	for _, c := range limits {
+		asset, err := e.resolve(c.limit.Token)
+		if err != nil {
+			return nil, fmt.Errorf("%s limit for %s: %w", c.scope, c.limit.Token, err)
+		}
+		global, key, err := e.used(keyID, asset, now)
+		if err != nil {
+			return nil, err
+		}
+		u := global
+		if c.scope == ScopeKey {
+			u = key
+		}
+		a := Allowance{Scope: c.scope, Asset: asset.Symbol, PerTransaction: c.limit.PerTransaction}
+		if asset.Address != (common.Address{}) {
+			token := asset.Address
+			a.Token = &token
+		}
+		window := func(limitStr string, used *big.Int, resets time.Time) (*Window, error) {
+			limit, err := parseCap(limitStr, asset.Decimals)
+			if err != nil || limit == nil {
+				return nil, err
+			}
+			remaining := new(big.Int).Sub(limit, used)
+			if remaining.Sign() < 0 {
+				remaining.SetInt64(0)
+			}
+			return &Window{
+				Limit:     limitStr,
+				Used:      units.FormatAmount(used, asset.Decimals),
+				Remaining: units.FormatAmount(remaining, asset.Decimals),
+				ResetsAt:  resets,
+			}, nil
+		}
+		if a.Daily, err = window(c.limit.Daily, u.day, dayStart(now).AddDate(0, 0, 1)); err != nil {
+			return nil, err
+		}
+		if a.Monthly, err = window(c.limit.Monthly, u.month, monthStart(now).AddDate(0, 1, 0)); err != nil {
+			return nil, err
+		}
+		allowances = append(allowances, a)
+	}
+	return allowances, nil
+}
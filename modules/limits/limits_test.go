@@ -0,0 +1,146 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func newTestEngine(t *testing.T, cfg config.Limits) *Engine {
+	t.Helper()
+	db, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(db, nil, cfg)
+}
+
+func limitError(t *testing.T, err error) *LimitError {
+	t.Helper()
+	var le *LimitError
+	if !errors.As(err, &le) {
+		t.Fatalf("err = %v, want a *LimitError", err)
+	}
+	return le
+}
+
+func TestPerTransaction(t *testing.T) {
+	e := newTestEngine(t, config.Limits{Global: []config.Limit{{Token: "eth", PerTransaction: "1.5"}}})
+	if _, err := e.SpendAs("", auth.ETH, []*big.Int{ether(1), ether(1)}, "test"); err != nil {
+		t.Fatalf("two transfers under the cap: %v", err)
+	}
+	_, err := e.SpendAs("", auth.ETH, []*big.Int{ether(1), ether(2)}, "test")
+	if le := limitError(t, err); le.Period != PeriodTransaction || le.Requested != "2" {
+		t.Fatalf("limit error = %+v, want the per transaction cap for 2", le)
+	}
+}
+
+func TestDailyAndRelease(t *testing.T) {
+	e := newTestEngine(t, config.Limits{Global: []config.Limit{{Token: "ETH", Daily: "10", Monthly: "100"}}})
+	first, err := e.SpendAs("", auth.ETH, []*big.Int{ether(6)}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.SpendAs("", auth.ETH, []*big.Int{ether(5)}, "test")
+	if le := limitError(t, err); le.Period != PeriodDaily || le.Used != "6" || le.Requested != "5" {
+		t.Fatalf("limit error = %+v, want the daily cap with 6 used", le)
+	}
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatal("limit error does not wrap ErrLimitExceeded")
+	}
+
+	// a transfer that was never sent gives its spend back
+	if err := e.Release(first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.SpendAs("", auth.ETH, []*big.Int{ether(5), ether(5)}, "test"); err != nil {
+		t.Fatalf("after the release: %v", err)
+	}
+	allowances, err := e.Allowances("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allowances) != 1 || allowances[0].Daily.Used != "10" || allowances[0].Daily.Remaining != "0" || allowances[0].Monthly.Remaining != "90" {
+		t.Fatalf("allowances = %+v", allowances)
+	}
+}
+
+func TestEarlierDays(t *testing.T) {
+	e := newTestEngine(t, config.Limits{Global: []config.Limit{{Token: "ETH", Daily: "10", Monthly: "12"}}})
+	now := time.Now().UTC()
+	yesterday := dayStart(now).Add(-time.Second)
+	old := &Entry{ID: newEntryID(yesterday), Asset: "ETH", Amount: ether(8), Source: "test", At: yesterday}
+	if err := e.store.Put(entryKey(old.ID), old); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := e.SpendAs("", auth.ETH, []*big.Int{ether(5)}, "test")
+	if !yesterday.Before(monthStart(now)) {
+		// yesterday counts against this month, but not today
+		if le := limitError(t, err); le.Period != PeriodMonthly || le.Used != "8" {
+			t.Fatalf("limit error = %+v, want the monthly cap with 8 used", le)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("first day of the month: %v", err)
+	}
+}
+
+func TestPerKey(t *testing.T) {
+	e := newTestEngine(t, config.Limits{
+		PerKey: []config.Limit{{Token: "ETH", Daily: "3"}},
+		Keys:   map[string][]config.Limit{"tight": {{Token: "ETH", PerTransaction: "0.5"}}},
+	})
+	ctx := func(id string) context.Context {
+		return auth.WithPrincipal(context.Background(), &auth.Principal{ID: id, Role: auth.RoleOperator})
+	}
+	if _, err := e.Spend(ctx("a"), auth.ETH, []*big.Int{ether(3)}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := e.Spend(ctx("a"), auth.ETH, []*big.Int{ether(1)}, "test")
+	if le := limitError(t, err); le.Scope != ScopeKey || le.KeyID != "a" {
+		t.Fatalf("limit error = %+v, want key a's cap", le)
+	}
+	if _, err := e.Spend(ctx("b"), auth.ETH, []*big.Int{ether(3)}, "test"); err != nil {
+		t.Fatalf("another key: %v", err)
+	}
+	_, err = e.Spend(ctx("tight"), auth.ETH, []*big.Int{ether(1)}, "test")
+	if le := limitError(t, err); le.Period != PeriodTransaction {
+		t.Fatalf("limit error = %+v, want the extra per transaction cap", le)
+	}
+	// per-key caps don't apply without a key
+	if _, err := e.Spend(context.Background(), auth.ETH, []*big.Int{ether(50)}, "test"); err != nil {
+		t.Fatalf("without a key: %v", err)
+	}
+}
+
+func TestUnknownAmount(t *testing.T) {
+	usdc := auth.Asset{Symbol: "USDC", Decimals: 6}
+	e := newTestEngine(t, config.Limits{Global: []config.Limit{{Token: "ETH", Daily: "1"}}})
+	if _, err := e.SpendAs("", auth.ETH, []*big.Int{nil}, "sweep"); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("sweep under a cap: %v, want ErrLimitExceeded", err)
+	}
+	entry, err := e.SpendAs("", usdc, []*big.Int{nil}, "sweep")
+	if err != nil || entry != nil {
+		t.Fatalf("sweep without a cap: %v, %v; want nothing recorded", entry, err)
+	}
+
+	var none *Engine
+	if entry, err := none.SpendAs("", auth.ETH, []*big.Int{ether(1000)}, "test"); entry != nil || err != nil {
+		t.Fatalf("nil engine: %v, %v", entry, err)
+	}
+	if err := none.Release(nil); err != nil {
+		t.Fatal(err)
+	}
+}
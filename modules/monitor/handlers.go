@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// StatusHandler serves GET /monitor with the latest check. ?refresh=true checks now.
+func (m *Monitor) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := m.Status()
+	if status == nil || r.URL.Query().Get("refresh") == "true" {
+		status = m.Check(r.Context())
+	}
+	api.WriteJSON(w, http.StatusOK, status)
+}
+
+// MetricsHandler serves GET /metrics in the Prometheus text format.
+func (m *Monitor) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	status, checks, failures, alerts := m.status, m.checks, m.failures, m.alerts
+	m.mu.Unlock()
+
+	var b strings.Builder
+	gauge := func(name, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	counter("wallet_monitor_checks_total", "Balance checks run.", checks)
+	counter("wallet_monitor_check_errors_total", "Balance checks with at least one failed reading.", failures)
+	counter("wallet_monitor_alerts_total", "Low balance and recovery alerts fired.", alerts)
+	if status != nil {
+		readings := append([]*Reading{}, status.Tokens...)
+		if status.Eth != nil {
+			readings = append(readings, status.Eth)
+		}
+		gauge("wallet_balance", "Hot wallet balance in base units.")
+		for _, rd := range readings {
+			fmt.Fprintf(&b, "wallet_balance{asset=%q} %s\n", rd.Asset, float(rd.Balance))
+		}
+		gauge("wallet_balance_minimum", "Configured minimum balance in base units.")
+		for _, rd := range readings {
+			fmt.Fprintf(&b, "wallet_balance_minimum{asset=%q} %s\n", rd.Asset, float(rd.Minimum))
+		}
+		gauge("wallet_balance_low", "1 when the balance is below its threshold.")
+		for _, rd := range readings {
+			low := 0
+			if rd.Low {
+				low = 1
+			}
+			fmt.Fprintf(&b, "wallet_balance_low{asset=%q} %d\n", rd.Asset, low)
+		}
+		if status.Transfers != nil {
+			gauge("wallet_transfers_fundable", "Token transfers the ETH balance can pay gas for at the current price.")
+			fmt.Fprintf(&b, "wallet_transfers_fundable %d\n", *status.Transfers)
+		}
+		gauge("wallet_monitor_last_check_timestamp_seconds", "Unix time of the latest check.")
+		fmt.Fprintf(&b, "wallet_monitor_last_check_timestamp_seconds %d\n", status.CheckedAt.Unix())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+func float(v *big.Int) string {
+	return new(big.Float).SetInt(v).Text('g', -1)
+}
@@ -0,0 +1,320 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/webhook"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	etherDecimals = 18
+
+	defaultInterval    = time.Minute
+	defaultRepeat      = time.Hour
+	defaultTransferGas = 65000
+
+	AlertLow       = "low"
+	AlertRecovered = "recovered"
+)
+
+// Backend is what the monitor needs from a node besides the signer.
+type Backend interface {
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// Reading is one balance checked against its minimum.
+type Reading struct {
+	Asset     string          `json:"asset"` // "ETH" or the token symbol
+	Token     *common.Address `json:"token,omitempty"`
+	Balance   *big.Int        `json:"balance"`
+	Formatted string          `json:"formatted"`
+	Minimum   *big.Int        `json:"minimum"`
+	Low       bool            `json:"low"`
+
+	decimals uint8
+}
+
+// Status is the result of the latest check.
+type Status struct {
+	Address   common.Address `json:"address"`
+	CheckedAt time.Time      `json:"checked_at"`
+	Eth       *Reading       `json:"eth,omitempty"`
+	GasPrice  *big.Int       `json:"gas_price,omitempty"` // max price per gas a transfer would pay now
+	Transfers *uint64        `json:"transfers_fundable,omitempty"`
+	Tokens    []*Reading     `json:"tokens"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// Alert is posted to the configured webhooks when a balance drops below its minimum,
+// periodically while it stays there, and once when it recovers.
+type Alert struct {
+	Kind      string         `json:"kind"`
+	Asset     string         `json:"asset"`
+	Address   common.Address `json:"address"`
+	Balance   string         `json:"balance"`
+	Minimum   string         `json:"minimum"`
+	Transfers *uint64        `json:"transfers_fundable,omitempty"`
+	Message   string         `json:"message"`
+	At        time.Time      `json:"at"`
+}
+
+// Monitor periodically checks the signer's ETH and token balances against thresholds.
+type Monitor struct {
+	backend  Backend
+	registry *tokens.Registry
+	signer   *signer.Signer
+	cfg      config.Monitor
+	client   *http.Client
+
+	mu        sync.Mutex
+	status    *Status
+	lastAlert map[string]time.Time // asset -> last low alert, present while low
+	checks    uint64
+	failures  uint64
+	alerts    uint64
+}
+
+func New(backend Backend, registry *tokens.Registry, s *signer.Signer, cfg config.Monitor) *Monitor {
+	return &Monitor{
+		backend:   backend,
+		registry:  registry,
+		signer:    s,
+		cfg:       cfg,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		lastAlert: map[string]time.Time{},
+	}
+}
+
+// Run checks balances every interval until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	interval := time.Duration(m.cfg.Interval)
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status := m.Check(ctx)
+		if status.Error != "" {
+			log.Printf("monitor: %s", status.Error)
+		}
+		m.alert(ctx, status)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Status returns the latest check, or nil before the first one.
+func (m *Monitor) Status() *Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Check reads the balances and stores the result. Readings that fail are left out and
+// reported in Error.
+func (m *Monitor) Check(ctx context.Context) *Status {
+	status := &Status{Address: m.signer.Address(), CheckedAt: time.Now().UTC(), Tokens: []*Reading{}}
+	var errs []string
+
+	if eth, err := m.checkEth(ctx, status); err != nil {
+		errs = append(errs, fmt.Sprintf("eth balance: %v", err))
+	} else {
+		status.Eth = eth
+	}
+	for _, t := range m.cfg.Tokens {
+		reading, err := m.checkToken(ctx, t)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("token %q: %v", t.Token, err))
+			continue
+		}
+		status.Tokens = append(status.Tokens, reading)
+	}
+	for i, e := range errs {
+		if i > 0 {
+			status.Error += "; "
+		}
+		status.Error += e
+	}
+
+	m.mu.Lock()
+	m.status = status
+	m.checks++
+	if status.Error != "" {
+		m.failures++
+	}
+	m.mu.Unlock()
+	return status
+}
+
+func (m *Monitor) checkEth(ctx context.Context, status *Status) (*Reading, error) {
+	balance, err := m.backend.BalanceAt(ctx, status.Address, nil)
+	if err != nil {
+		return nil, err
+	}
+	minimum, err := parseOptional(m.cfg.MinEthBalance, etherDecimals)
+	if err != nil {
+		return nil, fmt.Errorf("min_eth_balance: %w", err)
+	}
+	reading := &Reading{
+		Asset:     "ETH",
+		Balance:   balance,
+		Formatted: units.FormatAmount(balance, etherDecimals),
+		Minimum:   minimum,
+		Low:       minimum.Sign() > 0 && balance.Cmp(minimum) < 0,
+		decimals:  etherDecimals,
+	}
+
+	fees, err := m.signer.SuggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gas := m.cfg.TransferGas
+	if gas == 0 {
+		gas = defaultTransferGas
+	}
+	status.GasPrice = fees.MaxPrice()
+	perTransfer := new(big.Int).Mul(new(big.Int).SetUint64(gas), status.GasPrice)
+	if perTransfer.Sign() > 0 {
+		n := new(big.Int).Quo(balance, perTransfer).Uint64()
+		status.Transfers = &n
+		if m.cfg.MinTransfers > 0 && n < m.cfg.MinTransfers {
+			reading.Low = true
+		}
+	}
+	return reading, nil
+}
+
+func (m *Monitor) checkToken(ctx context.Context, t config.Threshold) (*Reading, error) {
+	token, instance, err := m.registry.Resolve(t.Token)
+	if err != nil {
+		return nil, err
+	}
+	minimum, err := parseOptional(t.MinBalance, token.Decimals)
+	if err != nil {
+		return nil, fmt.Errorf("min_balance: %w", err)
+	}
+	balance, err := instance.BalanceOf(&bind.CallOpts{Context: ctx}, m.signer.Address())
+	if err != nil {
+		return nil, err
+	}
+	address := token.Address
+	return &Reading{
+		Asset:     token.Symbol,
+		Token:     &address,
+		Balance:   balance,
+		Formatted: units.FormatAmount(balance, token.Decimals),
+		Minimum:   minimum,
+		Low:       minimum.Sign() > 0 && balance.Cmp(minimum) < 0,
+		decimals:  token.Decimals,
+	}, nil
+}
+
+func parseOptional(s string, decimals uint8) (*big.Int, error) {
+	if s == "" {
+		return new(big.Int), nil
+	}
+	return units.ParseAmount(s, decimals)
+}
+
+// alert fires for readings that went low, are still low after the repeat interval, or recovered.
+func (m *Monitor) alert(ctx context.Context, status *Status) {
+	repeat := time.Duration(m.cfg.Repeat)
+	if repeat <= 0 {
+		repeat = defaultRepeat
+	}
+	readings := append([]*Reading{}, status.Tokens...)
+	if status.Eth != nil {
+		readings = append(readings, status.Eth)
+	}
+
+	var fired []Alert
+	m.mu.Lock()
+	for _, r := range readings {
+		a := Alert{
+			Asset:   r.Asset,
+			Address: status.Address,
+			Balance: r.Formatted,
+			Minimum: units.FormatAmount(r.Minimum, r.decimals),
+			At:      status.CheckedAt,
+		}
+		if r.Token == nil {
+			a.Transfers = status.Transfers
+		}
+		last, wasLow := m.lastAlert[r.Asset]
+		switch {
+		case r.Low && (!wasLow || status.CheckedAt.Sub(last) >= repeat):
+			m.lastAlert[r.Asset] = status.CheckedAt
+			a.Kind = AlertLow
+			a.Message = fmt.Sprintf("%s balance of %s is low: %s (minimum %s)", r.Asset, status.Address.Hex(), a.Balance, a.Minimum)
+			if a.Transfers != nil {
+				a.Message += fmt.Sprintf(", enough gas for about %d transfers", *a.Transfers)
+			}
+		case !r.Low && wasLow:
+			delete(m.lastAlert, r.Asset)
+			a.Kind = AlertRecovered
+			a.Message = fmt.Sprintf("%s balance of %s recovered: %s", r.Asset, status.Address.Hex(), a.Balance)
+		default:
+			continue
+		}
+		fired = append(fired, a)
+		m.alerts++
+	}
+	m.mu.Unlock()
+
+	for _, a := range fired {
+		log.Printf("monitor: %s", a.Message)
+		for _, url := range m.cfg.Webhooks {
+			if err := m.post(ctx, url, a); err != nil {
+				log.Printf("monitor: alert webhook %s: %v", url, err)
+			}
+		}
+	}
+}
+
+// post sends the alert with the same headers as event webhooks.
+func (m *Monitor) post(ctx context.Context, url string, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.EventHeader, "balance_alert")
+	if m.cfg.WebhookSecret != "" {
+		req.Header.Set(webhook.TimestampHeader, timestamp)
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(m.cfg.WebhookSecret, timestamp, body))
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return nil
+}
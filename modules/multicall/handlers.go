@@ -0,0 +1,161 @@
+package multicall
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"net/http"
+)
+
+const (
+	maxQueries    = 5000
+	etherDecimals = 18
+)
+
+type allowanceRequest struct {
+	Owner   string `json:"owner"`
+	Spender string `json:"spender"`
+}
+
+type balancesRequest struct {
+	Token      string             `json:"token"`
+	Accounts   []string           `json:"accounts"`
+	IncludeEth bool               `json:"include_eth"`
+	Allowances []allowanceRequest `json:"allowances"`
+}
+
+type balanceResponse struct {
+	Address             string `json:"address"`
+	Balance             string `json:"balance,omitempty"`
+	BalanceFormatted    string `json:"balance_formatted,omitempty"`
+	EthBalance          string `json:"eth_balance,omitempty"`
+	EthBalanceFormatted string `json:"eth_balance_formatted,omitempty"`
+	Error               string `json:"error,omitempty"`
+}
+
+type allowanceResponse struct {
+	Owner              string `json:"owner"`
+	Spender            string `json:"spender"`
+	Allowance          string `json:"allowance,omitempty"`
+	AllowanceFormatted string `json:"allowance_formatted,omitempty"`
+	Error              string `json:"error,omitempty"`
+}
+
+type balancesResponse struct {
+	Token      string              `json:"token"`
+	Block      uint64              `json:"block"`
+	Method     string              `json:"method"`
+	Balances   []balanceResponse   `json:"balances"`
+	Allowances []allowanceResponse `json:"allowances"`
+}
+
+func parseAddress(s string) (common.Address, error) {
+	return api.HexAddress("address", s)
+}
+
+// BalancesHandler serves POST /contract/balances:
+//
+//	{"token": "...", "accounts": ["0x..."], "include_eth": true, "allowances": [{"owner": "0x...", "spender": "0x..."}]}
+//
+// Every value is read at the same block. A failed lookup sets error on its entry instead of failing the request.
+func (c *Client) BalancesHandler(registry *tokens.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body balancesRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		token, _, err := registry.Resolve(body.Token)
+		if err != nil {
+			api.WriteError(w, tokens.HTTPStatus(err), err)
+			return
+		}
+
+		perAccount := 1
+		if body.IncludeEth {
+			perAccount = 2
+		}
+		if n := len(body.Accounts)*perAccount + len(body.Allowances); n > maxQueries {
+			api.WriteError(w, http.StatusBadRequest, fmt.Errorf("too many lookups, %d > %d", n, maxQueries))
+			return
+		}
+
+		var queries []Query
+		for _, a := range body.Accounts {
+			owner, err := parseAddress(a)
+			if err != nil {
+				api.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			queries = append(queries, Query{Kind: KindBalance, Token: token.Address, Owner: owner})
+			if body.IncludeEth {
+				queries = append(queries, Query{Kind: KindEthBalance, Owner: owner})
+			}
+		}
+		for _, a := range body.Allowances {
+			owner, err := parseAddress(a.Owner)
+			if err != nil {
+				api.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			spender, err := parseAddress(a.Spender)
+			if err != nil {
+				api.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			queries = append(queries, Query{Kind: KindAllowance, Token: token.Address, Owner: owner, Spender: spender})
+		}
+
+		block, results, err := c.Query(r.Context(), queries)
+		if err != nil {
+			api.WriteError(w, http.StatusBadGateway, err)
+			return
+		}
+
+		resp := balancesResponse{
+			Token:      token.Address.Hex(),
+			Block:      block,
+			Method:     c.Method(),
+			Balances:   []balanceResponse{},
+			Allowances: []allowanceResponse{},
+		}
+		i := 0
+		for range body.Accounts {
+			q, res := queries[i], results[i]
+			i++
+			b := balanceResponse{Address: q.Owner.Hex()}
+			if res.Err != nil {
+				b.Error = res.Err.Error()
+			} else {
+				b.Balance = res.Value.String()
+				b.BalanceFormatted = units.FormatAmount(res.Value, token.Decimals)
+			}
+			if body.IncludeEth {
+				res = results[i]
+				i++
+				if res.Err != nil {
+					b.Error = res.Err.Error()
+				} else {
+					b.EthBalance = res.Value.String()
+					b.EthBalanceFormatted = units.FormatAmount(res.Value, etherDecimals)
+				}
+			}
+			resp.Balances = append(resp.Balances, b)
+		}
+		for ; i < len(queries); i++ {
+			q, res := queries[i], results[i]
+			a := allowanceResponse{Owner: q.Owner.Hex(), Spender: q.Spender.Hex()}
+			if res.Err != nil {
+				a.Error = res.Err.Error()
+			} else {
+				a.Allowance = res.Value.String()
+				a.AllowanceFormatted = units.FormatAmount(res.Value, token.Decimals)
+			}
+			resp.Allowances = append(resp.Allowances, a)
+		}
+		api.WriteJSON(w, http.StatusOK, resp)
+	}
+}
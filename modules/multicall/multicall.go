@@ -0,0 +1,257 @@
+package multicall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"strings"
+)
+
+// Multicall3ABI covers the parts of Multicall3 used here.
+const Multicall3ABI = `[
+{"inputs":[{"components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"},
+{"inputs":[{"name":"addr","type":"address"}],"name":"getEthBalance","outputs":[{"name":"balance","type":"uint256"}],"stateMutability":"view","type":"function"}
+]`
+
+const (
+	KindBalance    = "balance"
+	KindAllowance  = "allowance"
+	KindEthBalance = "eth_balance"
+
+	aggregateSize = 500 // calls per aggregate3
+	batchSize     = 100 // requests per JSON-RPC batch
+)
+
+var (
+	erc20ABI     = mustParse(contract.MyContractABI)
+	multicallABI = mustParse(Multicall3ABI)
+)
+
+func mustParse(s string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// Query is a single lookup. Owner is the account for balances; Spender is only used by allowances.
+type Query struct {
+	Kind    string
+	Token   common.Address
+	Owner   common.Address
+	Spender common.Address
+}
+
+// Result is the value of a query, or the reason it failed.
+type Result struct {
+	Value *big.Int
+	Err   error
+}
+
+// call3 and result3 mirror the Multicall3 Call3 and Result structs.
+type call3 struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type result3 struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// Client runs many read-only queries at once: through a Multicall3 aggregator contract when
+// one is configured, otherwise as JSON-RPC batches. All results are read at the same block.
+type Client struct {
+	backend    bind.ContractBackend
+	rpc        *rpc.Client
+	aggregator *common.Address
+}
+
+// New returns a client; aggregator may be nil, rpc may be nil when an aggregator is set.
+func New(backend bind.ContractBackend, rpcClient *rpc.Client, aggregator *common.Address) *Client {
+	return &Client{backend: backend, rpc: rpcClient, aggregator: aggregator}
+}
+
+// Method reports how queries are sent, "multicall" or "batch".
+func (c *Client) Method() string {
+	if c.aggregator != nil {
+		return "multicall"
+	}
+	return "batch"
+}
+
+// Query runs queries at the latest block and returns that block number with one result per query.
+func (c *Client) Query(ctx context.Context, queries []Query) (uint64, []Result, error) {
+	head, err := c.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	results := make([]Result, len(queries))
+	if c.aggregator != nil {
+		err = c.aggregate(ctx, head.Number, queries, results)
+	} else {
+		err = c.batch(ctx, head.Number, queries, results)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return head.Number.Uint64(), results, nil
+}
+
+// calldata returns the target and input of a token query.
+func calldata(q Query) (common.Address, []byte, error) {
+	switch q.Kind {
+	case KindBalance:
+		data, err := erc20ABI.Pack("balanceOf", q.Owner)
+		return q.Token, data, err
+	case KindAllowance:
+		data, err := erc20ABI.Pack("allowance", q.Owner, q.Spender)
+		return q.Token, data, err
+	}
+	return common.Address{}, nil, fmt.Errorf("unknown query kind %q", q.Kind)
+}
+
+func unpackUint(method string, data []byte) (*big.Int, error) {
+	out, err := erc20ABI.Unpack(method, data)
+	if err != nil {
+		return nil, err
+	}
+	return abi.ConvertType(out[0], new(big.Int)).(*big.Int), nil
+}
+
+func outputMethod(kind string) string {
+	if kind == KindAllowance {
+		return "allowance"
+	}
+	return "balanceOf"
+}
+
+func (c *Client) aggregate(ctx context.Context, block *big.Int, queries []Query, results []Result) error {
+	for start := 0; start < len(queries); start += aggregateSize {
+		end := start + aggregateSize
+		if end > len(queries) {
+			end = len(queries)
+		}
+
+		calls := make([]call3, 0, end-start)
+		for _, q := range queries[start:end] {
+			var target common.Address
+			var data []byte
+			var err error
+			if q.Kind == KindEthBalance {
+				target = *c.aggregator
+				data, err = multicallABI.Pack("getEthBalance", q.Owner)
+			} else {
+				target, data, err = calldata(q)
+			}
+			if err != nil {
+				return err
+			}
+			calls = append(calls, call3{Target: target, AllowFailure: true, CallData: data})
+		}
+
+		input, err := multicallABI.Pack("aggregate3", calls)
+		if err != nil {
+			return err
+		}
+		output, err := c.backend.CallContract(ctx, ethereum.CallMsg{To: c.aggregator, Data: input}, block)
+		if err != nil {
+			return err
+		}
+		out, err := multicallABI.Unpack("aggregate3", output)
+		if err != nil {
+			return err
+		}
+		returned := *abi.ConvertType(out[0], new([]result3)).(*[]result3)
+		if len(returned) != len(calls) {
+			return fmt.Errorf("aggregate3 returned %d results for %d calls", len(returned), len(calls))
+		}
+
+		for i, r := range returned {
+			q := queries[start+i]
+			if !r.Success {
+				results[start+i].Err = errors.New("call reverted")
+				continue
+			}
+			if q.Kind == KindEthBalance {
+				// getEthBalance returns a single uint256, like the ERC-20 getters
+				if len(r.ReturnData) != 32 {
+					results[start+i].Err = errors.New("invalid getEthBalance result")
+					continue
+				}
+				results[start+i].Value = new(big.Int).SetBytes(r.ReturnData)
+				continue
+			}
+			results[start+i].Value, results[start+i].Err = unpackUint(outputMethod(q.Kind), r.ReturnData)
+		}
+	}
+	return nil
+}
+
+type callArgs struct {
+	To   common.Address `json:"to"`
+	Data hexutil.Bytes  `json:"data"`
+}
+
+func (c *Client) batch(ctx context.Context, block *big.Int, queries []Query, results []Result) error {
+	if c.rpc == nil {
+		return errors.New("no aggregator or rpc client configured")
+	}
+	blockArg := hexutil.EncodeBig(block)
+
+	for start := 0; start < len(queries); start += batchSize {
+		end := start + batchSize
+		if end > len(queries) {
+			end = len(queries)
+		}
+
+		elems := make([]rpc.BatchElem, 0, end-start)
+		for _, q := range queries[start:end] {
+			if q.Kind == KindEthBalance {
+				elems = append(elems, rpc.BatchElem{
+					Method: "eth_getBalance",
+					Args:   []interface{}{q.Owner, blockArg},
+					Result: new(hexutil.Big),
+				})
+				continue
+			}
+			target, data, err := calldata(q)
+			if err != nil {
+				return err
+			}
+			elems = append(elems, rpc.BatchElem{
+				Method: "eth_call",
+				Args:   []interface{}{callArgs{To: target, Data: data}, blockArg},
+				Result: new(hexutil.Bytes),
+			})
+		}
+
+		if err := c.rpc.BatchCallContext(ctx, elems); err != nil {
+			return err
+		}
+
+		for i, elem := range elems {
+			q := queries[start+i]
+			if elem.Error != nil {
+				results[start+i].Err = elem.Error
+				continue
+			}
+			if q.Kind == KindEthBalance {
+				results[start+i].Value = elem.Result.(*hexutil.Big).ToInt()
+				continue
+			}
+			results[start+i].Value, results[start+i].Err = unpackUint(outputMethod(q.Kind), *elem.Result.(*hexutil.Bytes))
+		}
+	}
+	return nil
+}
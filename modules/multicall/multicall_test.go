@@ -0,0 +1,281 @@
+package multicall
+
+import (
+	"context"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"os"
+	"testing"
+)
+
+type testChain struct {
+	backend    *backends.SimulatedBackend
+	deployer   common.Address
+	token      common.Address
+	instance   *contract.MyContract
+	aggregator common.Address
+	opts       *bind.TransactOpts
+}
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+// newTestChain deploys MyContract and the Multicall3 subset of testdata on a simulated chain.
+func newTestChain(t *testing.T) *testChain {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testChain{deployer: crypto.PubkeyToAddress(key.PublicKey)}
+	c.backend = backends.NewSimulatedBackend(core.GenesisAlloc{c.deployer: {Balance: ether(100)}}, 10000000)
+	t.Cleanup(func() { c.backend.Close() })
+	if c.opts, err = bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337)); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.token, _, c.instance, err = contract.DeployMyContract(c.opts, c.backend); err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.ReadFile("testdata/Multicall3.easm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex(src, false))
+	bin, errs := compiler.Compile()
+	if len(errs) > 0 {
+		t.Fatalf("compile Multicall3.easm: %v", errs)
+	}
+	if c.aggregator, _, _, err = bind.DeployContract(c.opts, abi.ABI{}, common.FromHex(bin), c.backend); err != nil {
+		t.Fatal(err)
+	}
+	c.backend.Commit()
+	return c
+}
+
+func TestAggregate(t *testing.T) {
+	c := newTestChain(t)
+	holder := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	spender := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+	empty := common.HexToAddress("0x00000000000000000000000000000000000000c3")
+	if _, err := c.instance.Transfer(c.opts, holder, ether(5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.instance.Approve(c.opts, spender, ether(7)); err != nil {
+		t.Fatal(err)
+	}
+	c.backend.Commit()
+
+	supply, err := c.instance.TotalSupply(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployerEth, err := c.backend.BalanceAt(context.Background(), c.deployer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := New(c.backend, nil, &c.aggregator)
+	if m := client.Method(); m != "multicall" {
+		t.Fatalf("Method() = %q, want multicall", m)
+	}
+	queries := []Query{
+		{Kind: KindBalance, Token: c.token, Owner: c.deployer},
+		{Kind: KindBalance, Token: c.token, Owner: holder},
+		{Kind: KindBalance, Token: c.token, Owner: empty},
+		{Kind: KindAllowance, Token: c.token, Owner: c.deployer, Spender: spender},
+		{Kind: KindAllowance, Token: c.token, Owner: holder, Spender: spender},
+		{Kind: KindEthBalance, Owner: c.deployer},
+		{Kind: KindEthBalance, Owner: empty},
+	}
+	want := []*big.Int{
+		new(big.Int).Sub(supply, ether(5)),
+		ether(5),
+		new(big.Int),
+		ether(7),
+		new(big.Int),
+		deployerEth,
+		new(big.Int),
+	}
+	block, results, err := client.Query(context.Background(), queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head := c.backend.Blockchain().CurrentBlock().NumberU64(); block != head {
+		t.Errorf("block = %d, want the head %d", block, head)
+	}
+	for i, res := range results {
+		if res.Err != nil {
+			t.Errorf("%s query %d: %v", queries[i].Kind, i, res.Err)
+			continue
+		}
+		if res.Value.Cmp(want[i]) != 0 {
+			t.Errorf("%s query %d = %s, want %s", queries[i].Kind, i, res.Value, want[i])
+		}
+	}
+}
+
+// A lookup that fails is reported on its own result and leaves the others alone.
+func TestAggregateFailures(t *testing.T) {
+	c := newTestChain(t)
+	client := New(c.backend, nil, &c.aggregator)
+	queries := []Query{
+		{Kind: KindBalance, Token: c.token, Owner: c.deployer},
+		// the aggregator has no balanceOf, so the call reverts
+		{Kind: KindBalance, Token: c.aggregator, Owner: c.deployer},
+		// an account without code returns nothing
+		{Kind: KindBalance, Token: common.HexToAddress("0x00000000000000000000000000000000000000d4"), Owner: c.deployer},
+		{Kind: KindAllowance, Token: c.token, Owner: c.deployer, Spender: c.aggregator},
+	}
+	_, results, err := client.Query(context.Background(), queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[0].Value.Sign() <= 0 {
+		t.Errorf("balance = %v, %v; want the minted supply", results[0].Value, results[0].Err)
+	}
+	if results[1].Err == nil || results[1].Err.Error() != "call reverted" {
+		t.Errorf("reverted call: err = %v, want call reverted", results[1].Err)
+	}
+	if results[2].Err == nil {
+		t.Errorf("call to an account without code: value %v, want an error", results[2].Value)
+	}
+	if results[3].Err != nil || results[3].Value.Sign() != 0 {
+		t.Errorf("allowance = %v, %v; want 0", results[3].Value, results[3].Err)
+	}
+}
+
+// More queries than fit one aggregate3 call are split and come back in order.
+func TestAggregateChunks(t *testing.T) {
+	c := newTestChain(t)
+	client := New(c.backend, nil, &c.aggregator)
+
+	holders := make([]common.Address, aggregateSize+25)
+	for i := range holders {
+		holders[i] = common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+	}
+	for _, i := range []int{0, aggregateSize - 1, aggregateSize, len(holders) - 1} {
+		if _, err := c.instance.Transfer(c.opts, holders[i], big.NewInt(int64(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.backend.Commit()
+
+	queries := make([]Query, len(holders))
+	for i, h := range holders {
+		queries[i] = Query{Kind: KindBalance, Token: c.token, Owner: h}
+	}
+	_, results, err := client.Query(context.Background(), queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		want := int64(0)
+		switch i {
+		case 0, aggregateSize - 1, aggregateSize, len(holders) - 1:
+			want = int64(i + 1)
+		}
+		if res.Err != nil || res.Value.Int64() != want {
+			t.Errorf("balance %d = %v, %v; want %d", i, res.Value, res.Err, want)
+		}
+	}
+}
+
+// ethAPI serves the eth_call and eth_getBalance requests of a batch from the simulated chain.
+type ethAPI struct {
+	backend *backends.SimulatedBackend
+}
+
+func (api *ethAPI) Call(ctx context.Context, args callArgs, block hexutil.Big) (hexutil.Bytes, error) {
+	return api.backend.CallContract(ctx, ethereum.CallMsg{To: &args.To, Data: args.Data}, block.ToInt())
+}
+
+func (api *ethAPI) GetBalance(ctx context.Context, account common.Address, block hexutil.Big) (*hexutil.Big, error) {
+	balance, err := api.backend.BalanceAt(ctx, account, block.ToInt())
+	return (*hexutil.Big)(balance), err
+}
+
+// Without an aggregator, queries go out as JSON-RPC batches of batchSize.
+func TestBatch(t *testing.T) {
+	c := newTestChain(t)
+	server := rpc.NewServer()
+	t.Cleanup(server.Stop)
+	if err := server.RegisterName("eth", &ethAPI{backend: c.backend}); err != nil {
+		t.Fatal(err)
+	}
+	rpcClient := rpc.DialInProc(server)
+	t.Cleanup(rpcClient.Close)
+
+	client := New(c.backend, rpcClient, nil)
+	if m := client.Method(); m != "batch" {
+		t.Fatalf("Method() = %q, want batch", m)
+	}
+	holders := make([]common.Address, batchSize+5)
+	for i := range holders {
+		holders[i] = common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+	}
+	for _, i := range []int{0, batchSize, len(holders) - 1} {
+		if _, err := c.instance.Transfer(c.opts, holders[i], big.NewInt(int64(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.backend.Commit()
+	deployerEth, err := c.backend.BalanceAt(context.Background(), c.deployer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := make([]Query, 0, len(holders)+3)
+	for _, h := range holders {
+		queries = append(queries, Query{Kind: KindBalance, Token: c.token, Owner: h})
+	}
+	queries = append(queries,
+		Query{Kind: KindEthBalance, Owner: c.deployer},
+		// the aggregator has no balanceOf, so the call reverts
+		Query{Kind: KindBalance, Token: c.aggregator, Owner: c.deployer},
+		Query{Kind: KindAllowance, Token: c.token, Owner: c.deployer, Spender: holders[0]},
+	)
+	block, results, err := client.Query(context.Background(), queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head := c.backend.Blockchain().CurrentBlock().NumberU64(); block != head {
+		t.Errorf("block = %d, want the head %d", block, head)
+	}
+	for i := range holders {
+		want := int64(0)
+		switch i {
+		case 0, batchSize, len(holders) - 1:
+			want = int64(i + 1)
+		}
+		if res := results[i]; res.Err != nil || res.Value.Int64() != want {
+			t.Errorf("balance %d = %v, %v; want %d", i, res.Value, res.Err, want)
+		}
+	}
+	rest := results[len(holders):]
+	if rest[0].Err != nil || rest[0].Value.Cmp(deployerEth) != 0 {
+		t.Errorf("eth balance = %v, %v; want %s", rest[0].Value, rest[0].Err, deployerEth)
+	}
+	if rest[1].Err == nil {
+		t.Errorf("reverted call: value %v, want an error", rest[1].Value)
+	}
+	if rest[2].Err != nil || rest[2].Value.Sign() != 0 {
+		t.Errorf("allowance = %v, %v; want 0", rest[2].Value, rest[2].Err)
+	}
+
+	if _, _, err := New(c.backend, nil, nil).Query(context.Background(), queries[:1]); err == nil {
+		t.Error("query without an aggregator or rpc client succeeded")
+	}
+}
@@ -0,0 +1,279 @@
+package payout
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/approval"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"io"
+	"log"
+	"math/big"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxUpload bounds request bodies, about 200 bytes per CSV line or JSON entry.
+const maxUpload = MaxItems * 200
+
+type transferRequest struct {
+	To     string `json:"to"`
+	Amount string `json:"amount"`
+}
+
+type batchRequest struct {
+	Token     string            `json:"token"`
+	Transfers []transferRequest `json:"transfers"`
+}
+
+type itemResponse struct {
+	*Item
+	AmountFormatted string `json:"amount_formatted"`
+}
+
+type batchResponse struct {
+	*Batch
+	TotalFormatted string         `json:"total_formatted"`
+	Items          []itemResponse `json:"items"`
+	Counts         map[string]int `json:"counts"`
+}
+
+func newBatchResponse(b *Batch) batchResponse {
+	resp := batchResponse{
+		Batch:          b,
+		TotalFormatted: units.FormatAmount(b.Total, b.Decimals),
+		Items:          []itemResponse{},
+		Counts:         map[string]int{StatusQueued: 0, StatusSubmitted: 0, StatusConfirmed: 0, StatusFailed: 0},
+	}
+	for _, item := range b.Items {
+		resp.Items = append(resp.Items, itemResponse{Item: item, AmountFormatted: units.FormatAmount(item.Amount, b.Decimals)})
+		resp.Counts[item.Status]++
+	}
+	return resp
+}
+
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrEmpty), errors.Is(err, ErrTooLarge):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrInsufficientBalance):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// GetHandler serves GET /contract/transfers/batch/{id}, the status of every transfer of a batch.
+func (s *Service) GetHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := s.Get(router.Param(r, "id"))
+	if err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, newBatchResponse(b))
+}
+
+// CreateHandler serves POST /contract/transfers/batch {"token", "transfers": [{"to", "amount"}]},
+// or a text/csv upload of "to,amount" lines with ?token=. Amounts are in token units, e.g. "1.5".
+// Bodies over maxUpload are refused with 413.
+func (s *Service) CreateHandler(registry *tokens.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := http.MaxBytesReader(w, r.Body, maxUpload)
+		tokenID := r.URL.Query().Get("token")
+
+		var requested []transferRequest
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "text/csv" {
+			rows, err := parseCSV(body)
+			if err != nil {
+				api.WriteError(w, uploadStatus(err), err)
+				return
+			}
+			requested = rows
+		} else {
+			var req batchRequest
+			if err := json.NewDecoder(body).Decode(&req); err != nil {
+				api.WriteError(w, uploadStatus(err), err)
+				return
+			}
+			requested = req.Transfers
+			if req.Token != "" {
+				tokenID = req.Token
+			}
+		}
+
+		token, instance, err := registry.Resolve(tokenID)
+		if err != nil {
+			api.WriteError(w, tokens.HTTPStatus(err), err)
+			return
+		}
+
+		transfers := make([]Transfer, 0, len(requested))
+		for i, t := range requested {
+			to, err := api.Address(fmt.Sprintf("transfers[%d].to", i), t.To)
+			if err != nil {
+				api.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			amount, err := api.Amount(fmt.Sprintf("transfers[%d].amount", i), t.Amount, token.Decimals)
+			if err != nil {
+				api.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			if err := auth.Authorize(r.Context(), auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}, amount); err != nil {
+				api.WriteError(w, auth.HTTPStatus(err), fmt.Errorf("transfer %d: %w", i, err))
+				return
+			}
+			if err := s.policy.Check(r.Context(), to, &token.Address, "batch"); err != nil {
+				api.WriteError(w, policy.HTTPStatus(err), fmt.Errorf("transfer %d: %w", i, err))
+				return
+			}
+			transfers = append(transfers, Transfer{To: to, Amount: amount})
+		}
+
+		total := new(big.Int)
+		for _, t := range transfers {
+			total.Add(total, t.Amount)
+		}
+		asset := auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}
+		// the whole batch counts against the threshold, so it can't be split under it
+		rule, err := s.approvals.Required(asset, total)
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if rule != nil {
+			req, err := s.RequestApproval(r.Context(), rule, token, transfers)
+			if err != nil {
+				api.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+			w.Header().Set("Location", "/approvals/"+req.ID)
+			api.WriteJSON(w, http.StatusAccepted, req)
+			return
+		}
+
+		b, err := s.submit(r.Context(), token, instance, transfers)
+		if err != nil {
+			if errors.Is(err, limits.ErrLimitExceeded) {
+				api.WriteError(w, limits.HTTPStatus(err), err)
+				return
+			}
+			api.WriteError(w, httpStatus(err), err)
+			return
+		}
+		w.Header().Set("Location", "/contract/transfers/batch/"+b.ID)
+		api.WriteJSON(w, http.StatusAccepted, newBatchResponse(b))
+	}
+}
+
+// submit records the spend against the limits of the caller in ctx and submits the batch.
+// A batch that was accepted keeps its spend, even if some of its transfers fail later.
+func (s *Service) submit(ctx context.Context, token *tokens.Token, instance *contract.MyContract, transfers []Transfer) (*Batch, error) {
+	amounts := make([]*big.Int, len(transfers))
+	for i, t := range transfers {
+		amounts[i] = t.Amount
+	}
+	asset := auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}
+	spent, err := s.limits.Spend(ctx, asset, amounts, "batch")
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.Submit(ctx, instance, token.Address, token.Decimals, transfers)
+	if err != nil {
+		if releaseErr := s.limits.Release(spent); releaseErr != nil {
+			log.Printf("payout: release spend: %v", releaseErr)
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// RequestApproval submits transfers of token to the approval workflow under rule; once
+// approved they are sent as a batch.
+func (s *Service) RequestApproval(ctx context.Context, rule *config.ApprovalRule, token *tokens.Token, transfers []Transfer) (*approval.Request, error) {
+	total := new(big.Int)
+	for _, t := range transfers {
+		total.Add(total, t.Amount)
+	}
+	asset := auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}
+	summary := fmt.Sprintf("batch of %d transfers, %s %s in total", len(transfers), units.FormatAmount(total, token.Decimals), token.Symbol)
+	if len(transfers) == 1 {
+		summary = fmt.Sprintf("send %s %s to %s", units.FormatAmount(total, token.Decimals), token.Symbol, transfers[0].To.Hex())
+	}
+	return s.approvals.Submit(ctx, rule, ApprovalKind, summary, asset, total, approvedBatch{Token: token.Address, Transfers: transfers})
+}
+
+// approvedBatch is the payload of a batch waiting for approval.
+type approvedBatch struct {
+	Token     common.Address `json:"token"`
+	Transfers []Transfer     `json:"transfers"`
+}
+
+// ExecuteApproved returns the approval executor for batches. Recipients are checked
+// again, the lists may have changed while the batch waited.
+func (s *Service) ExecuteApproved(registry *tokens.Registry) approval.Executor {
+	return func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var p approvedBatch
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, err
+		}
+		token, instance, err := registry.Resolve(p.Token.Hex())
+		if err != nil {
+			return nil, err
+		}
+		for i, t := range p.Transfers {
+			if err := s.policy.Check(ctx, t.To, &token.Address, "batch"); err != nil {
+				return nil, fmt.Errorf("transfer %d: %w", i, err)
+			}
+		}
+		b, err := s.submit(ctx, token, instance, p.Transfers)
+		if err != nil {
+			return nil, err
+		}
+		return newBatchResponse(b), nil
+	}
+}
+
+// uploadStatus answers 413 for a body over maxUpload, which is refused rather than cut
+// short, and 400 for anything else that can't be parsed.
+func uploadStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// parseCSV reads "to,amount" rows; a header row is skipped.
+func parseCSV(r io.Reader) ([]transferRequest, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var rows []transferRequest
+	for i, record := range records {
+		if i == 0 && !common.IsHexAddress(record[0]) && strings.EqualFold(record[0], "to") {
+			continue
+		}
+		rows = append(rows, transferRequest{To: record[0], Amount: record[1]})
+	}
+	return rows, nil
+}
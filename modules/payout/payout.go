@@ -0,0 +1,317 @@
+package payout
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/approval"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusSubmitted = "submitted"
+	StatusConfirmed = "confirmed"
+	StatusFailed    = "failed"
+
+	BatchRunning  = "running"
+	BatchComplete = "complete"
+
+	MaxItems = 1000
+
+	// ApprovalKind names batches in the approval workflow.
+	ApprovalKind = "batch"
+)
+
+var (
+	ErrNotFound            = errors.New("batch not found")
+	ErrEmpty               = errors.New("batch has no transfers")
+	ErrTooLarge            = fmt.Errorf("batch has more than %d transfers", MaxItems)
+	ErrInsufficientBalance = errors.New("insufficient token balance")
+)
+
+// Item is one transfer of a batch.
+type Item struct {
+	Index  int            `json:"index"`
+	To     common.Address `json:"to"`
+	Amount *big.Int       `json:"amount"`
+	Nonce  uint64         `json:"nonce"`
+	Status string         `json:"status"`
+	TxHash *common.Hash   `json:"tx_hash,omitempty"`
+	Block  uint64         `json:"block,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Batch is a set of transfers sent from the service account with sequential nonces.
+type Batch struct {
+	ID        string         `json:"id"`
+	Token     common.Address `json:"token"`
+	Decimals  uint8          `json:"decimals"`
+	From      common.Address `json:"from"`
+	Total     *big.Int       `json:"total"`
+	Status    string         `json:"status"`
+	CreatedAt time.Time      `json:"created_at"`
+	Items     []*Item        `json:"items"`
+}
+
+// Transfer is a requested payout before it is queued.
+type Transfer struct {
+	To     common.Address `json:"to"`
+	Amount *big.Int       `json:"amount"`
+}
+
+// Service submits batches and tracks the status of every item.
+type Service struct {
+	backend   bind.DeployBackend // receipts
+	store     *store.Store
+	signer    *signer.Signer
+	limits    *limits.Engine
+	policy    *policy.Policy
+	approvals *approval.Workflow
+
+	Concurrency int           // transactions in flight per batch
+	Timeout     time.Duration // how long to wait for each receipt
+
+	mu sync.Mutex // serializes writes of batch records
+}
+
+func New(backend bind.DeployBackend, db *store.Store, s *signer.Signer, spend *limits.Engine, recipients *policy.Policy, approvals *approval.Workflow) *Service {
+	return &Service{
+		backend:     backend,
+		store:       db,
+		signer:      s,
+		limits:      spend,
+		policy:      recipients,
+		approvals:   approvals,
+		Concurrency: 4,
+		Timeout:     10 * time.Minute,
+	}
+}
+
+func batchKey(id string) []byte {
+	return []byte("b/" + id)
+}
+
+// newBatchID returns an ID that sorts by creation time.
+func newBatchID(now time.Time) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%016x%s", now.UnixNano(), hex.EncodeToString(b))
+}
+
+// Submit checks that the service account holds the total amount, allocates one nonce per
+// transfer and sends them in the background. The returned batch is already stored.
+func (s *Service) Submit(ctx context.Context, instance *contract.MyContract, token common.Address, decimals uint8, transfers []Transfer) (*Batch, error) {
+	if len(transfers) == 0 {
+		return nil, ErrEmpty
+	}
+	if len(transfers) > MaxItems {
+		return nil, ErrTooLarge
+	}
+
+	total := new(big.Int)
+	for _, t := range transfers {
+		total.Add(total, t.Amount)
+	}
+	balance, err := instance.BalanceOf(&bind.CallOpts{Context: ctx}, s.signer.Address())
+	if err != nil {
+		return nil, err
+	}
+	if balance.Cmp(total) < 0 {
+		return nil, fmt.Errorf("%w: need %s, have %s", ErrInsufficientBalance, units.FormatAmount(total, decimals), units.FormatAmount(balance, decimals))
+	}
+
+	first, err := s.signer.Reserve(ctx, len(transfers))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	b := &Batch{
+		ID:        newBatchID(now),
+		Token:     token,
+		Decimals:  decimals,
+		From:      s.signer.Address(),
+		Total:     total,
+		Status:    BatchRunning,
+		CreatedAt: now,
+	}
+	for i, t := range transfers {
+		b.Items = append(b.Items, &Item{Index: i, To: t.To, Amount: t.Amount, Nonce: first + uint64(i), Status: StatusQueued})
+	}
+	if err := s.save(b); err != nil {
+		for i := len(b.Items) - 1; i >= 0; i-- {
+			if abandonErr := s.signer.Abandon(ctx, b.Items[i].Nonce); abandonErr != nil {
+				log.Printf("payout: batch %s: abandon nonce %d: %v", b.ID, b.Items[i].Nonce, abandonErr)
+			}
+		}
+		return nil, err
+	}
+
+	go s.run(instance, b)
+	return s.copy(b), nil
+}
+
+func (s *Service) save(b *Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Put(batchKey(b.ID), b)
+}
+
+// copy snapshots b under the write lock so callers never see an item mid-update.
+func (s *Service) copy(b *Batch) *Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, _ := json.Marshal(b)
+	var c Batch
+	json.Unmarshal(data, &c)
+	return &c
+}
+
+// update applies fn to the item under the write lock and persists the batch.
+func (s *Service) update(b *Batch, item *Item, fn func(item *Item)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(item)
+	if err := s.store.Put(batchKey(b.ID), b); err != nil {
+		log.Printf("payout: batch %s: %v", b.ID, err)
+	}
+}
+
+// run sends the items in nonce order with at most Concurrency transactions awaiting receipts.
+func (s *Service) run(instance *contract.MyContract, b *Batch) {
+	sem := make(chan struct{}, s.Concurrency)
+	var wg sync.WaitGroup
+	for _, item := range b.Items {
+		item := item
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.send(instance, b, item)
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	b.Status = BatchComplete
+	err := s.store.Put(batchKey(b.ID), b)
+	s.mu.Unlock()
+	if err != nil {
+		log.Printf("payout: batch %s: %v", b.ID, err)
+	}
+}
+
+func (s *Service) send(instance *contract.MyContract, b *Batch, item *Item) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	fail := func(err error) {
+		s.update(b, item, func(item *Item) {
+			item.Status = StatusFailed
+			item.Error = err.Error()
+		})
+	}
+
+	opts, err := s.signer.Opts(ctx, item.Nonce)
+	if err != nil {
+		fail(err)
+		return
+	}
+	tx, err := instance.Transfer(opts, item.To, item.Amount)
+	if err != nil {
+		// the nonce must still be used or every later transaction of the account is stuck
+		if abandonErr := s.signer.Abandon(ctx, item.Nonce); abandonErr != nil {
+			log.Printf("payout: batch %s: abandon nonce %d: %v", b.ID, item.Nonce, abandonErr)
+		}
+		fail(err)
+		return
+	}
+	hash := tx.Hash()
+	s.update(b, item, func(item *Item) {
+		item.Status = StatusSubmitted
+		item.TxHash = &hash
+	})
+
+	receipt, err := bind.WaitMined(ctx, s.backend, tx)
+	if err != nil {
+		fail(fmt.Errorf("waiting for receipt: %w", err))
+		return
+	}
+	s.update(b, item, func(item *Item) {
+		item.Block = receipt.BlockNumber.Uint64()
+		if receipt.Status == types.ReceiptStatusSuccessful {
+			item.Status = StatusConfirmed
+		} else {
+			item.Status = StatusFailed
+			item.Error = "transaction reverted"
+		}
+	})
+}
+
+func (s *Service) Get(id string) (*Batch, error) {
+	var b Batch
+	err := s.store.Get(batchKey(id), &b)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Recover marks batches left running by a previous process. Items that were never sent
+// failed; submitted items keep their hash and status so they can be checked on chain.
+func (s *Service) Recover() error {
+	var running []*Batch
+	var decodeErr error
+	err := s.store.Iterate([]byte("b/"), nil, nil, false, func(key, value []byte) bool {
+		var b Batch
+		if decodeErr = json.Unmarshal(value, &b); decodeErr != nil {
+			return false
+		}
+		if b.Status == BatchRunning {
+			running = append(running, &b)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+
+	for _, b := range running {
+		for _, item := range b.Items {
+			if item.Status == StatusQueued {
+				item.Status = StatusFailed
+				item.Error = "interrupted by restart"
+			}
+		}
+		b.Status = BatchComplete
+		if err := s.save(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"net/http"
+)
+
+const (
+	defaultViolations = 50
+	maxViolations     = 500
+)
+
+type addRequest struct {
+	Address string `json:"address"`
+	Note    string `json:"note"`
+}
+
+// HTTPStatus maps policy errors to response status codes.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrRejected):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrInvalidList):
+		return http.StatusNotFound
+	case errors.Is(err, ErrStatic):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ViolationsHandler serves GET /policy/violations, rejected transfers newest first.
+func (p *Policy) ViolationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := api.ParseLimit(r.URL.Query(), "limit", defaultViolations, maxViolations)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	violations, err := p.Violations(limit)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, violations)
+}
+
+// ListHandler serves GET /policy/{list}, the entries of the allowlist or denylist.
+func (p *Policy) ListHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := p.List(router.Param(r, "list"))
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, entries)
+}
+
+// AddHandler serves POST /policy/{list} {"address", "note"}.
+func (p *Policy) AddHandler(w http.ResponseWriter, r *http.Request) {
+	var body addRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	address, err := api.Address("address", body.Address)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	entry, err := p.Add(router.Param(r, "list"), address, body.Note)
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, entry)
+}
+
+// RemoveHandler serves DELETE /policy/{list}/{address} for addresses added through the API.
+func (p *Policy) RemoveHandler(w http.ResponseWriter, r *http.Request) {
+	address, err := api.HexAddress("address", router.Param(r, "address"))
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := p.Remove(router.Param(r, "list"), address); err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,320 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/audit"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/ethereum/go-ethereum/common"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ListAllow = "allowlist"
+	ListDeny  = "denylist"
+
+	RuleZeroAddress = "zero_address"
+	RuleTokenSelf   = "token_contract"
+	RuleDenied      = "denylist"
+	RuleNotAllowed  = "allowlist"
+	RuleContract    = "require_eoa"
+)
+
+var (
+	ErrRejected    = errors.New("recipient rejected by policy")
+	ErrNotFound    = errors.New("address not in list")
+	ErrStatic      = errors.New("address comes from the list file and can only be removed there")
+	ErrInvalidList = errors.New("list must be allowlist or denylist")
+)
+
+// Violation is a rejected transfer, kept in the violation log.
+type Violation struct {
+	ID        string          `json:"id"`
+	Recipient common.Address  `json:"recipient"`
+	Token     *common.Address `json:"token,omitempty"` // nil for ETH
+	Rule      string          `json:"rule"`
+	Reason    string          `json:"reason"`
+	KeyID     string          `json:"key_id,omitempty"`
+	Source    string          `json:"source"`
+	At        time.Time       `json:"at"`
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%v: %s", ErrRejected, v.Reason)
+}
+
+func (v *Violation) Unwrap() error {
+	return ErrRejected
+}
+
+// Entry is an address on the allow or deny list.
+type Entry struct {
+	Address   common.Address `json:"address"`
+	Note      string         `json:"note,omitempty"`
+	Static    bool           `json:"static,omitempty"` // loaded from the list file
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Backend is what the EOA check needs from a node.
+type Backend interface {
+	CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// Policy decides which recipients transfers may go to.
+type Policy struct {
+	backend Backend
+	store   *store.Store
+	cfg     config.Policy
+	static  map[string]map[common.Address]*Entry // list -> entries from the files, read once
+}
+
+// New loads the list files; a missing file is an error, so a typo can't silently disable a list.
+func New(backend Backend, db *store.Store, cfg config.Policy) (*Policy, error) {
+	p := &Policy{backend: backend, store: db, cfg: cfg, static: map[string]map[common.Address]*Entry{}}
+	for list, path := range map[string]string{ListAllow: cfg.AllowlistFile, ListDeny: cfg.DenylistFile} {
+		entries := map[common.Address]*Entry{}
+		if path != "" {
+			var err error
+			if entries, err = readList(path); err != nil {
+				return nil, fmt.Errorf("%s file: %w", list, err)
+			}
+		}
+		p.static[list] = entries
+	}
+	return p, nil
+}
+
+func readList(path string) (map[common.Address]*Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	entries := map[common.Address]*Entry{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		note := ""
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line, note = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !common.IsHexAddress(line) {
+			return nil, fmt.Errorf("line %d: invalid address %q", n, line)
+		}
+		addr := common.HexToAddress(line)
+		entries[addr] = &Entry{Address: addr, Note: note, Static: true, CreatedAt: info.ModTime().UTC()}
+	}
+	return entries, scanner.Err()
+}
+
+func listKey(list string, addr common.Address) []byte {
+	prefix := "r/a/"
+	if list == ListDeny {
+		prefix = "r/d/"
+	}
+	return append([]byte(prefix), addr.Bytes()...)
+}
+
+func listPrefix(list string) []byte {
+	return listKey(list, common.Address{})[:4]
+}
+
+func violationKey(id string) []byte {
+	return []byte("r/v/" + id)
+}
+
+func newID(now time.Time) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%016x%s", now.UnixNano(), hex.EncodeToString(b))
+}
+
+func validList(list string) error {
+	if list != ListAllow && list != ListDeny {
+		return ErrInvalidList
+	}
+	return nil
+}
+
+// listed reports whether addr is on the list, from the file or the store.
+func (p *Policy) listed(list string, addr common.Address) (bool, error) {
+	if _, ok := p.static[list][addr]; ok {
+		return true, nil
+	}
+	return p.store.Has(listKey(list, addr))
+}
+
+// hasAllowlist reports whether any allowlist entry exists, which turns the allowlist on.
+func (p *Policy) hasAllowlist() (bool, error) {
+	if len(p.static[ListAllow]) > 0 {
+		return true, nil
+	}
+	found := false
+	err := p.store.Iterate(listPrefix(ListAllow), nil, nil, false, func(_, _ []byte) bool {
+		found = true
+		return false
+	})
+	return found, err
+}
+
+// Check returns a *Violation when a transfer of token (nil for ETH) to recipient is not
+// allowed, and records it in the violation log. source names the endpoint or job.
+func (p *Policy) Check(ctx context.Context, recipient common.Address, token *common.Address, source string) error {
+	if p == nil {
+		return nil
+	}
+	rule, reason, err := p.evaluate(ctx, recipient, token)
+	if err != nil || rule == "" {
+		return err
+	}
+	now := time.Now().UTC()
+	v := &Violation{
+		ID:        newID(now),
+		Recipient: recipient,
+		Token:     token,
+		Rule:      rule,
+		Reason:    reason,
+		Source:    source,
+		At:        now,
+	}
+	if principal := auth.FromContext(ctx); principal != nil {
+		v.KeyID = principal.ID
+	}
+	if err := p.store.Put(violationKey(v.ID), v); err != nil {
+		log.Printf("policy: record violation: %v", err)
+	}
+	audit.Note(ctx, audit.EventPolicy, v.Error())
+	return v
+}
+
+func (p *Policy) evaluate(ctx context.Context, recipient common.Address, token *common.Address) (rule, reason string, err error) {
+	if recipient == (common.Address{}) {
+		return RuleZeroAddress, "the zero address burns what is sent to it", nil
+	}
+	if token != nil && recipient == *token {
+		return RuleTokenSelf, "tokens sent to their own contract are lost", nil
+	}
+	denied, err := p.listed(ListDeny, recipient)
+	if err != nil {
+		return "", "", err
+	}
+	if denied {
+		return RuleDenied, fmt.Sprintf("%s is on the denylist", recipient.Hex()), nil
+	}
+	restricted, err := p.hasAllowlist()
+	if err != nil {
+		return "", "", err
+	}
+	if restricted {
+		allowed, err := p.listed(ListAllow, recipient)
+		if err != nil {
+			return "", "", err
+		}
+		if !allowed {
+			return RuleNotAllowed, fmt.Sprintf("%s is not on the allowlist", recipient.Hex()), nil
+		}
+	}
+	if p.cfg.RequireEOA {
+		code, err := p.backend.CodeAt(ctx, recipient, nil)
+		if err != nil {
+			return "", "", err
+		}
+		if len(code) > 0 {
+			return RuleContract, fmt.Sprintf("%s is a contract, only externally owned accounts are accepted", recipient.Hex()), nil
+		}
+	}
+	return "", "", nil
+}
+
+// List returns the entries of a list, file entries first.
+func (p *Policy) List(list string) ([]*Entry, error) {
+	if err := validList(list); err != nil {
+		return nil, err
+	}
+	entries := []*Entry{}
+	for _, e := range p.static[list] {
+		entries = append(entries, e)
+	}
+	var decodeErr error
+	err := p.store.Iterate(listPrefix(list), nil, nil, false, func(_, value []byte) bool {
+		var e Entry
+		if decodeErr = json.Unmarshal(value, &e); decodeErr != nil {
+			return false
+		}
+		entries = append(entries, &e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, decodeErr
+}
+
+// Add puts an address on a list.
+func (p *Policy) Add(list string, addr common.Address, note string) (*Entry, error) {
+	if err := validList(list); err != nil {
+		return nil, err
+	}
+	e := &Entry{Address: addr, Note: note, CreatedAt: time.Now().UTC()}
+	if err := p.store.Put(listKey(list, addr), e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Remove takes an address added through the API off a list.
+func (p *Policy) Remove(list string, addr common.Address) error {
+	if err := validList(list); err != nil {
+		return err
+	}
+	ok, err := p.store.Has(listKey(list, addr))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if _, static := p.static[list][addr]; static {
+			return ErrStatic
+		}
+		return ErrNotFound
+	}
+	return p.store.Delete(listKey(list, addr))
+}
+
+// Violations returns the most recent rejections, newest first.
+func (p *Policy) Violations(limit int) ([]*Violation, error) {
+	violations := []*Violation{}
+	var decodeErr error
+	err := p.store.Iterate([]byte("r/v/"), nil, nil, true, func(_, value []byte) bool {
+		var v Violation
+		if decodeErr = json.Unmarshal(value, &v); decodeErr != nil {
+			return false
+		}
+		violations = append(violations, &v)
+		return len(violations) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return violations, decodeErr
+}
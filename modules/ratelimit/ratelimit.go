@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// buckets is a set of token buckets sharing one rate, by client.
+type buckets struct {
+	rate config.Rate
+
+	mu        sync.Mutex
+	byKey     map[string]*bucket
+	nextPrune time.Time
+}
+
+func newBuckets(rate config.Rate) *buckets {
+	if rate.Burst <= 0 {
+		rate.Burst = 1
+	}
+	return &buckets{rate: rate, byKey: map[string]*bucket{}}
+}
+
+// take removes a token from the bucket of key. When it is empty it returns false and how
+// long until the next token.
+func (b *buckets) take(key string, now time.Time) (bool, time.Duration) {
+	if b.rate.PerSecond <= 0 {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.After(b.nextPrune) {
+		// a bucket that has refilled is the same as a new one
+		for k, bk := range b.byKey {
+			if bk.tokens+now.Sub(bk.last).Seconds()*b.rate.PerSecond >= float64(b.rate.Burst) {
+				delete(b.byKey, k)
+			}
+		}
+		b.nextPrune = now.Add(time.Minute)
+	}
+
+	bk, ok := b.byKey[key]
+	if !ok {
+		bk = &bucket{tokens: float64(b.rate.Burst), last: now}
+		b.byKey[key] = bk
+	}
+	bk.tokens = math.Min(float64(b.rate.Burst), bk.tokens+now.Sub(bk.last).Seconds()*b.rate.PerSecond)
+	bk.last = now
+	if bk.tokens >= 1 {
+		bk.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bk.tokens) / b.rate.PerSecond * float64(time.Second))
+	return false, wait
+}
+
+// Limiter applies token bucket rate limits per client IP and per authenticated caller,
+// with separate budgets for reads and writes.
+type Limiter struct {
+	cfg               config.RateLimits
+	ipRead, ipWrite   *buckets
+	keyRead, keyWrite *buckets
+}
+
+func New(cfg config.RateLimits) *Limiter {
+	return &Limiter{
+		cfg:      cfg,
+		ipRead:   newBuckets(cfg.PerIP.Read),
+		ipWrite:  newBuckets(cfg.PerIP.Write),
+		keyRead:  newBuckets(cfg.PerKey.Read),
+		keyWrite: newBuckets(cfg.PerKey.Write),
+	}
+}
+
+// isRead reports whether a request uses the read budget: safe methods, and the POSTs that
+// auth.RequiredRole lets readers make because they change nothing, such as contract calls
+// and balance lookups.
+func isRead(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return auth.RequiredRole(r.Method, r.URL.Path) == auth.RoleReader
+}
+
+func reject(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	api.WriteError(w, http.StatusTooManyRequests, ErrRateLimited)
+}
+
+// ByIP limits requests per client IP. It goes in front of authentication, so failed
+// attempts count too.
+func (l *Limiter) ByIP(next http.Handler) http.Handler {
+	if !l.cfg.Enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := l.ipWrite
+		if isRead(r) {
+			b = l.ipRead
+		}
+		if ok, wait := b.take(api.ClientIP(r, l.cfg.TrustProxy), time.Now()); !ok {
+			reject(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ByKey limits requests per authenticated caller. It goes after authentication; requests
+// without a caller, such as to public endpoints, are only limited by IP.
+func (l *Limiter) ByKey(next http.Handler) http.Handler {
+	if !l.cfg.Enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := auth.FromContext(r.Context())
+		if p == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		b := l.keyWrite
+		if isRead(r) {
+			b = l.keyRead
+		}
+		if ok, wait := b.take(p.ID, time.Now()); !ok {
+			reject(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRefill(t *testing.T) {
+	b := newBuckets(config.Rate{PerSecond: 2, Burst: 2})
+	t0 := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.take("k", t0); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	if ok, wait := b.take("k", t0); ok || wait != 500*time.Millisecond {
+		t.Fatalf("empty bucket: ok %v, wait %s; want a refusal for 500ms", ok, wait)
+	}
+	if ok, wait := b.take("k", t0.Add(250*time.Millisecond)); ok || wait != 250*time.Millisecond {
+		t.Fatalf("half a token later: ok %v, wait %s; want a refusal for 250ms", ok, wait)
+	}
+	if ok, _ := b.take("k", t0.Add(500*time.Millisecond)); !ok {
+		t.Fatal("a refilled token was refused")
+	}
+	if ok, _ := b.take("other", t0); !ok {
+		t.Fatal("another client shares the bucket")
+	}
+
+	// a long pause refills no more than the burst
+	later := t0.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.take("k", later); ok != (i < 2) {
+			t.Errorf("request %d after an hour: ok %v", i+1, ok)
+		}
+	}
+
+	unlimited := newBuckets(config.Rate{})
+	for i := 0; i < 100; i++ {
+		if ok, _ := unlimited.take("k", t0); !ok {
+			t.Fatal("a zero rate refused a request")
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	b := newBuckets(config.Rate{PerSecond: 1.0 / 60, Burst: 3})
+	t0 := time.Now()
+	b.take("full", t0)
+	for i := 0; i < 3; i++ {
+		b.take("empty", t0)
+	}
+	// a minute later "full" has refilled and is dropped, "empty" has one token of three
+	b.take("new", t0.Add(61*time.Second))
+	if _, ok := b.byKey["full"]; ok {
+		t.Error("a refilled bucket was kept")
+	}
+	if bk, ok := b.byKey["empty"]; !ok || bk.tokens >= 1 {
+		t.Errorf("a bucket still refilling was dropped or changed: %+v", bk)
+	}
+	if len(b.byKey) != 2 {
+		t.Errorf("%d buckets, want empty and new", len(b.byKey))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	l := New(config.RateLimits{Enabled: true, PerIP: config.Budget{
+		Read:  config.Rate{PerSecond: 100, Burst: 1},
+		Write: config.Rate{PerSecond: 0.4, Burst: 1},
+	}})
+	h := l.ByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = "203.0.113.7:5123"
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request(http.MethodPost, "/contract/transfer"); w.Code != http.StatusOK {
+		t.Fatalf("first write: status %d", w.Code)
+	}
+	// 2.5s until the next token, rounded up
+	w := request(http.MethodPost, "/contract/transfer")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "3" {
+		t.Fatalf("second write: status %d, Retry-After %q; want 429 after 3s", w.Code, w.Header().Get("Retry-After"))
+	}
+	// read-only POSTs use the read budget
+	if w := request(http.MethodPost, "/contract/balances"); w.Code != http.StatusOK {
+		t.Errorf("balance lookup after the write budget ran out: status %d", w.Code)
+	}
+}
+
+func TestIsRead(t *testing.T) {
+	tests := []struct {
+		method, path string
+		read         bool
+	}{
+		{http.MethodGet, "/contract/transfers", true},
+		{http.MethodHead, "/health", true},
+		{http.MethodOptions, "/contract/transfer", true},
+		{http.MethodPost, "/contract/balances", true},
+		{http.MethodPost, "/contracts/usdc/call/balanceOf", true},
+		{http.MethodPost, "/auth/token", true},
+		{http.MethodPost, "/contract/transfer", false},
+		{http.MethodPost, "/contracts/usdc/transact/mint", false},
+		{http.MethodPost, "/faucet", false},
+		{http.MethodDelete, "/schedules/1", false},
+		{http.MethodGet, "/webhooks", true},
+	}
+	for _, tt := range tests {
+		if got := isRead(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.read {
+			t.Errorf("%s %s: read %v, want %v", tt.method, tt.path, got, tt.read)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrCrossSite        = errors.New("cross-site request refused")
+)
+
+// Router dispatches requests on method and path. Patterns are matched segment by segment:
+// "{name}" matches any one segment, which handlers read with Param. When several patterns
+// match, the one with the most literal segments wins, so "/policy/violations" takes
+// precedence over "/policy/{list}".
+//
+// HEAD is served by the GET handler of a route unless one is registered for it; the
+// server drops the body. A path that matches but not for the request method is answered
+// with 405 and an Allow header. Requests that may change state, i.e. anything but GET, HEAD and OPTIONS, are
+// refused when a browser marks them as coming from another site.
+type Router struct {
+	routes []*route
+}
+
+type route struct {
+	segments []string
+	handlers map[string]http.Handler
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers h for method on pattern.
+func (rt *Router) Handle(method, pattern string, h http.Handler) {
+	segments := split(pattern)
+	for _, r := range rt.routes {
+		if equal(r.segments, segments) {
+			if _, ok := r.handlers[method]; ok {
+				panic("router: duplicate route " + method + " " + pattern)
+			}
+			r.handlers[method] = h
+			return
+		}
+	}
+	rt.routes = append(rt.routes, &route{segments: segments, handlers: map[string]http.Handler{method: h}})
+}
+
+func (rt *Router) Get(pattern string, h http.HandlerFunc) {
+	rt.Handle(http.MethodGet, pattern, h)
+}
+
+func (rt *Router) Post(pattern string, h http.HandlerFunc) {
+	rt.Handle(http.MethodPost, pattern, h)
+}
+
+func (rt *Router) Delete(pattern string, h http.HandlerFunc) {
+	rt.Handle(http.MethodDelete, pattern, h)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := split(r.URL.Path)
+	var best *route
+	var bestParams map[string]string
+	bestScore := -1
+	for _, candidate := range rt.routes {
+		params, score, ok := candidate.match(path)
+		if ok && score > bestScore {
+			best, bestParams, bestScore = candidate, params, score
+		}
+	}
+	if best == nil {
+		api.WriteError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+
+	h, ok := best.handlers[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		if h, ok = best.handlers[http.MethodGet]; ok {
+			// handlers that check the method themselves see the GET they serve
+			r = r.Clone(r.Context())
+			r.Method = http.MethodGet
+		}
+	}
+	if !ok {
+		w.Header().Set("Allow", best.allow())
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		api.WriteError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	if !safe(r.Method) && crossSite(r) {
+		api.WriteError(w, http.StatusForbidden, ErrCrossSite)
+		return
+	}
+	if len(bestParams) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), paramsKey{}, bestParams))
+	}
+	h.ServeHTTP(w, r)
+}
+
+// match reports whether path matches the route, with its parameters and the number of
+// literal segments it matched.
+func (rt *route) match(path []string) (map[string]string, int, bool) {
+	var params map[string]string
+	score := 0
+	if len(path) != len(rt.segments) {
+		return nil, 0, false
+	}
+	for i, seg := range rt.segments {
+		if path[i] == "" {
+			return nil, 0, false
+		}
+		switch {
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[seg[1:len(seg)-1]] = path[i]
+		case seg == path[i]:
+			score++
+		default:
+			return nil, 0, false
+		}
+	}
+	return params, score, true
+}
+
+func (rt *route) allow() string {
+	methods := make([]string, 0, len(rt.handlers)+2)
+	for method := range rt.handlers {
+		methods = append(methods, method)
+	}
+	_, get := rt.handlers[http.MethodGet]
+	if _, head := rt.handlers[http.MethodHead]; get && !head {
+		methods = append(methods, http.MethodHead)
+	}
+	methods = append(methods, http.MethodOptions)
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+type paramsKey struct{}
+
+// Param returns the path segment matched by "{name}" in the route of r.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+func safe(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// crossSite reports whether a browser sent r on behalf of another site. Clients other
+// than browsers send neither header and are not affected.
+func crossSite(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "cross-site", "same-site":
+		return true
+	case "same-origin", "none":
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || !strings.EqualFold(u.Host, r.Host)
+}
+
+func split(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestRouter() *Router {
+	rt := New()
+	reply := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body+" "+r.Method+" "+Param(r, "list")+Param(r, "address"))
+		}
+	}
+	rt.Get("/policy/violations", reply("violations"))
+	rt.Get("/policy/{list}", reply("list"))
+	rt.Post("/policy/{list}", reply("add"))
+	rt.Delete("/policy/{list}/{address}", reply("remove"))
+	return rt
+}
+
+func serve(rt *Router, method, path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "http://api.example"+path, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	return w
+}
+
+func TestRoutes(t *testing.T) {
+	rt := newTestRouter()
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{http.MethodGet, "/policy/violations", http.StatusOK, "violations GET "},
+		{http.MethodGet, "/policy/allowlist", http.StatusOK, "list GET allowlist"},
+		{http.MethodGet, "/policy/allowlist/", http.StatusOK, "list GET allowlist"},
+		{http.MethodPost, "/policy/denylist", http.StatusOK, "add POST denylist"},
+		{http.MethodDelete, "/policy/denylist/0xab", http.StatusOK, "remove DELETE denylist0xab"},
+		{http.MethodGet, "/policy", http.StatusNotFound, ""},
+		{http.MethodGet, "/policy//0xab", http.StatusNotFound, ""},
+		{http.MethodGet, "/policy/denylist/0xab/more", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := serve(rt, tt.method, tt.path, nil)
+		if w.Code != tt.status || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s %s: status %d %q, want %d %q", tt.method, tt.path, w.Code, w.Body, tt.status, tt.body)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	rt := newTestRouter()
+	w := serve(rt, http.MethodPut, "/policy/allowlist", nil)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT: status %d, want 405", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("PUT: Allow %q", allow)
+	}
+	w = serve(rt, http.MethodGet, "/policy/allowlist/0xab", nil)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "DELETE, OPTIONS" {
+		t.Errorf("GET of a DELETE route: status %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	w = serve(rt, http.MethodOptions, "/policy/allowlist", nil)
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("OPTIONS: status %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestHead(t *testing.T) {
+	rt := newTestRouter()
+	w := serve(rt, http.MethodHead, "/policy/allowlist", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "list GET allowlist" {
+		t.Errorf("HEAD: status %d %q, want the GET handler", w.Code, w.Body)
+	}
+
+	rt.Handle(http.MethodHead, "/policy/violations", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Count", "3")
+	}))
+	if w := serve(rt, http.MethodHead, "/policy/violations", nil); w.Header().Get("X-Count") != "3" {
+		t.Error("HEAD with its own handler was served by GET")
+	}
+	if w := serve(rt, http.MethodHead, "/policy/allowlist/0xab", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("HEAD without a GET handler: status %d, want 405", w.Code)
+	}
+}
+
+func TestCrossSite(t *testing.T) {
+	rt := newTestRouter()
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		status int
+	}{
+		{"cross-site post", http.MethodPost, http.Header{"Sec-Fetch-Site": {"cross-site"}}, http.StatusForbidden},
+		{"same-site post", http.MethodPost, http.Header{"Sec-Fetch-Site": {"same-site"}}, http.StatusForbidden},
+		{"same-origin post", http.MethodPost, http.Header{"Sec-Fetch-Site": {"same-origin"}}, http.StatusOK},
+		{"typed url", http.MethodPost, http.Header{"Sec-Fetch-Site": {"none"}}, http.StatusOK},
+		{"foreign origin", http.MethodPost, http.Header{"Origin": {"https://evil.example"}}, http.StatusForbidden},
+		{"own origin", http.MethodPost, http.Header{"Origin": {"https://api.example"}}, http.StatusOK},
+		{"bad origin", http.MethodPost, http.Header{"Origin": {"::"}}, http.StatusForbidden},
+		{"no browser headers", http.MethodPost, nil, http.StatusOK},
+		{"cross-site read", http.MethodGet, http.Header{"Sec-Fetch-Site": {"cross-site"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serve(rt, tt.method, "/policy/allowlist", tt.header); w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+	if w := serve(rt, http.MethodDelete, "/policy/allowlist/0xab", http.Header{"Origin": {"https://evil.example"}}); w.Code != http.StatusForbidden {
+		t.Errorf("cross-site delete: status %d, want 403", w.Code)
+	}
+}
+
+func TestDuplicateRoute(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a route twice did not panic")
+		}
+	}()
+	rt := newTestRouter()
+	rt.Get("/policy/{list}", func(http.ResponseWriter, *http.Request) {})
+}
@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseField(t *testing.T) {
+	minute, dom, dow := fields[0], fields[2], fields[4]
+	tests := []struct {
+		in   string
+		f    field
+		want []int
+	}{
+		{"5", minute, []int{5}},
+		{"1,3,5", minute, []int{1, 3, 5}},
+		{"10-13", minute, []int{10, 11, 12, 13}},
+		{"*/15", minute, []int{0, 15, 30, 45}},
+		{"10-20/5", minute, []int{10, 15, 20}},
+		{"50/4", minute, []int{50, 54, 58}},
+		{"*/10", dom, []int{1, 11, 21, 31}},
+		{"1-5,0", dow, []int{0, 1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		set, err := parseField(tt.in, tt.f)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		var want uint64
+		for _, v := range tt.want {
+			want |= 1 << uint(v)
+		}
+		if set != want {
+			t.Errorf("%q = %b, want %v", tt.in, set, tt.want)
+		}
+	}
+
+	for _, in := range []string{"60", "-1", "5-1", "*/0", "*/x", "a", "1-", "1,,2", ""} {
+		if _, err := parseField(in, minute); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+	if _, err := parseField("0", dom); err == nil {
+		t.Error("day of month 0: no error")
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * *", "* * * * * *", "0 24 * * *", "0 0 * 13 *", "0 0 * * 8"} {
+		if _, err := ParseCron(expr); !errors.Is(err, ErrInvalidCron) {
+			t.Errorf("%q: %v, want ErrInvalidCron", expr, err)
+		}
+	}
+	c, err := ParseCron(" @daily ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.domStar || !c.dowStar || c.minute != 1 || c.hour != 1 {
+		t.Errorf("@daily parsed as %+v", c)
+	}
+	// 7 is Sunday too
+	if c, _ := ParseCron("0 0 * * 7"); !has(c.dow, 0) {
+		t.Error("7 does not match Sunday")
+	}
+}
+
+func TestDayMatches(t *testing.T) {
+	// 2024-06-01 is a Saturday
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		expr string
+		day  int
+		want bool
+	}{
+		{"0 0 * * *", 4, true},
+		{"0 0 1 * *", 1, true},
+		{"0 0 1 * *", 2, false},
+		{"0 0 * * 1", 3, true},
+		{"0 0 * * 1", 4, false},
+		// both restricted: either matches
+		{"0 0 15 * 1", 3, true},
+		{"0 0 15 * 1", 15, true},
+		{"0 0 15 * 1", 4, false},
+		// a day field starting with * is unrestricted, so both must match
+		{"0 0 */2 * 1", 3, true},
+		{"0 0 */2 * 1", 5, false},
+		{"0 0 */2 * 1", 10, false},
+		{"0 0 1 * */7", 1, false},
+		{"0 0 1 * */7", 2, false},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.dayMatches(day(tt.day)); got != tt.want {
+			t.Errorf("%q on June %d = %v, want %v", tt.expr, tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		expr, from, want string
+	}{
+		{"* * * * *", "2024-06-01 10:00", "2024-06-01 10:01"},
+		{"*/15 * * * *", "2024-06-01 10:07", "2024-06-01 10:15"},
+		{"0 9 * * *", "2024-06-01 09:00", "2024-06-02 09:00"},
+		{"0 9 1 * *", "2024-06-15 12:00", "2024-07-01 09:00"},
+		{"30 23 31 * *", "2024-06-01 00:00", "2024-07-31 23:30"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 * * 1", "2024-06-01 00:00", "2024-06-03 00:00"},
+		{"0 0 1 1 *", "2024-12-31 23:59", "2025-01-01 00:00"},
+		{"0 0 15 * 1", "2024-06-01 00:00", "2024-06-03 00:00"},
+		{"0 0 */2 * 1", "2024-06-01 00:00", "2024-06-03 00:00"},
+		{"0 0 */2 * 1", "2024-06-03 00:00", "2024-06-17 00:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// seconds are dropped and the result is strictly after the start
+		if got := c.Next(at(tt.from).Add(30 * time.Second)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+
+	c, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := c.Next(at("2024-01-01 00:00")); !next.IsZero() {
+		t.Errorf("February 30th runs at %s", next)
+	}
+}
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"net/http"
+)
+
+const (
+	defaultHistory = 50
+	maxHistory     = 500
+)
+
+type createRequest struct {
+	Name      string `json:"name"`
+	Token     string `json:"token"`
+	Recipient string `json:"recipient"`
+	Amount    string `json:"amount"`
+	Cron      string `json:"cron"`
+	CatchUp   string `json:"catch_up"`
+}
+
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidCron), errors.Is(err, ErrInvalidCatchUp), errors.Is(err, ErrNeverRuns):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNoOwnerKey):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ListHandler serves GET /schedules.
+func (s *Scheduler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	schedules, err := s.List()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, schedules)
+}
+
+// GetHandler serves GET /schedules/{id}.
+func (s *Scheduler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	sch, err := s.Get(router.Param(r, "id"))
+	if err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, sch)
+}
+
+// DeleteHandler serves DELETE /schedules/{id}, which deletes a schedule and its history.
+func (s *Scheduler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.Delete(router.Param(r, "id")); err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PauseHandler serves POST /schedules/{id}/pause, which stops running a schedule.
+func (s *Scheduler) PauseHandler(w http.ResponseWriter, r *http.Request) {
+	s.change(w, r, s.Pause)
+}
+
+// ResumeHandler serves POST /schedules/{id}/resume, which runs a schedule again from its
+// next match, without catching up.
+func (s *Scheduler) ResumeHandler(w http.ResponseWriter, r *http.Request) {
+	s.change(w, r, s.Resume)
+}
+
+func (s *Scheduler) change(w http.ResponseWriter, r *http.Request, fn func(id string) (*Schedule, error)) {
+	sch, err := fn(router.Param(r, "id"))
+	if err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, sch)
+}
+
+// ExecutionsHandler serves GET /schedules/{id}/executions, the history newest first.
+func (s *Scheduler) ExecutionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	if _, err := s.Get(id); err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	limit, err := api.ParseLimit(r.URL.Query(), "limit", defaultHistory, maxHistory)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	executions, err := s.Executions(id, limit)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, executions)
+}
+
+func keyID(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.ID
+	}
+	return ""
+}
+
+// CreateHandler serves POST /schedules {"name", "token", "recipient", "amount", "cron",
+// "catch_up"}. Amounts are in token units; cron is a five field expression in UTC such as
+// "0 9 1 * *". The caller's API key owns the schedule and is checked again on every run,
+// so callers without a stored key, such as client certificates, can't create one.
+func (s *Scheduler) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.owner(r.Context(), keyID(r)); err != nil {
+		if errors.Is(err, auth.ErrKeyNotFound) || errors.Is(err, auth.ErrRevoked) {
+			err = ErrNoOwnerKey
+		}
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	var body createRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	token, _, err := s.registry.Resolve(body.Token)
+	if err != nil {
+		api.WriteError(w, tokens.HTTPStatus(err), err)
+		return
+	}
+	recipient, err := api.Address("recipient", body.Recipient)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	amount, err := api.Amount("amount", body.Amount, token.Decimals)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := auth.Authorize(r.Context(), auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}, amount); err != nil {
+		api.WriteError(w, auth.HTTPStatus(err), err)
+		return
+	}
+	if err := s.policy.Check(r.Context(), recipient, &token.Address, "schedule"); err != nil {
+		api.WriteError(w, policy.HTTPStatus(err), err)
+		return
+	}
+
+	sch, err := s.Create(Schedule{
+		Name:      body.Name,
+		Token:     token.Address,
+		Recipient: recipient,
+		Amount:    amount,
+		Cron:      body.Cron,
+		CatchUp:   body.CatchUp,
+		KeyID:     keyID(r),
+	})
+	if err != nil {
+		api.WriteError(w, httpStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, sch)
+}
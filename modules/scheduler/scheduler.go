@@ -0,0 +1,567 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/approval"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/limits"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/policy"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/signer"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	// CatchUpSkip drops runs missed while the service was down.
+	CatchUpSkip = "skip"
+	// CatchUpOnce makes a single payment for any number of missed runs.
+	CatchUpOnce = "once"
+	// CatchUpAll makes one payment per missed run, up to MaxCatchUp.
+	CatchUpAll = "all"
+
+	StatusPending   = "pending"
+	StatusApproval  = "awaiting_approval" // above an approval threshold, sent once the request is approved
+	StatusSubmitted = "submitted"
+	StatusConfirmed = "confirmed"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+	StatusUnknown   = "unknown" // interrupted while sending, check the chain before paying by hand
+
+	MaxCatchUp = 100
+
+	// ApprovalKind names scheduled transfers in the approval workflow.
+	ApprovalKind = "scheduled_transfer"
+)
+
+var (
+	ErrNotFound       = errors.New("schedule not found")
+	ErrInvalidCatchUp = errors.New("catch_up must be \"skip\", \"once\" or \"all\"")
+	ErrNeverRuns      = errors.New("cron expression never matches")
+	ErrNoOwnerKey     = errors.New("schedules must be created with an api key, or a token issued for one")
+	ErrNotAwaiting    = errors.New("execution is not awaiting approval")
+)
+
+// Schedule is a recurring transfer of Amount raw token units to Recipient.
+type Schedule struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Token     common.Address `json:"token"`
+	Recipient common.Address `json:"recipient"`
+	Amount    *big.Int       `json:"amount"`
+	Cron      string         `json:"cron"`
+	CatchUp   string         `json:"catch_up"`
+	KeyID     string         `json:"key_id,omitempty"` // API key that created it, its restrictions and spending limits apply
+	Paused    bool           `json:"paused"`
+	NextRun   time.Time      `json:"next_run"`
+	LastRun   *time.Time     `json:"last_run,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Execution is one occurrence of a schedule.
+type Execution struct {
+	ID           string       `json:"id"`
+	ScheduleID   string       `json:"schedule_id"`
+	ScheduledFor time.Time    `json:"scheduled_for"`
+	StartedAt    time.Time    `json:"started_at"`
+	CatchUp      bool         `json:"catch_up"` // run late, after the service was down
+	Status       string       `json:"status"`
+	TxHash       *common.Hash `json:"tx_hash,omitempty"`
+	Block        uint64       `json:"block,omitempty"`
+	ApprovalID   string       `json:"approval_id,omitempty"`
+	Error        string       `json:"error,omitempty"`
+}
+
+// approvedRun is the approval payload of an execution above an approval threshold.
+type approvedRun struct {
+	ScheduleID  string `json:"schedule_id"`
+	ExecutionID string `json:"execution_id"`
+}
+
+// Scheduler runs due schedules with the service signer, each as the key that created it.
+type Scheduler struct {
+	backend   bind.DeployBackend // receipts
+	store     *store.Store
+	registry  *tokens.Registry
+	signer    *signer.Signer
+	limits    *limits.Engine
+	policy    *policy.Policy
+	keys      *auth.Keys
+	approvals *approval.Workflow
+
+	Interval time.Duration // how often due schedules are checked
+	Grace    time.Duration // how late a run may start before it counts as missed
+
+	mu sync.Mutex // serializes schedule updates between the API and the run loop
+}
+
+func New(backend bind.DeployBackend, db *store.Store, registry *tokens.Registry, s *signer.Signer, spend *limits.Engine, recipients *policy.Policy, keys *auth.Keys, approvals *approval.Workflow) *Scheduler {
+	return &Scheduler{
+		backend:   backend,
+		store:     db,
+		registry:  registry,
+		signer:    s,
+		limits:    spend,
+		policy:    recipients,
+		keys:      keys,
+		approvals: approvals,
+		Interval:  30 * time.Second,
+		Grace:     5 * time.Minute,
+	}
+}
+
+func scheduleKey(id string) []byte {
+	return []byte("s/s/" + id)
+}
+
+func executionPrefix(scheduleID string) []byte {
+	return []byte("s/h/" + scheduleID + "/")
+}
+
+func executionKey(scheduleID, id string) []byte {
+	return append(executionPrefix(scheduleID), id...)
+}
+
+// newID returns an ID that sorts by creation time.
+func newID(now time.Time) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%016x%s", now.UnixNano(), hex.EncodeToString(b))
+}
+
+// Create validates and stores a schedule; its first run is the next cron match after now.
+func (s *Scheduler) Create(sch Schedule) (*Schedule, error) {
+	c, err := ParseCron(sch.Cron)
+	if err != nil {
+		return nil, err
+	}
+	if sch.CatchUp == "" {
+		sch.CatchUp = CatchUpOnce
+	}
+	if sch.CatchUp != CatchUpSkip && sch.CatchUp != CatchUpOnce && sch.CatchUp != CatchUpAll {
+		return nil, ErrInvalidCatchUp
+	}
+	now := time.Now().UTC()
+	sch.NextRun = c.Next(now)
+	if sch.NextRun.IsZero() {
+		return nil, ErrNeverRuns
+	}
+	sch.ID = newID(now)
+	sch.CreatedAt = now
+	sch.LastRun = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.store.Put(scheduleKey(sch.ID), sch); err != nil {
+		return nil, err
+	}
+	return &sch, nil
+}
+
+func (s *Scheduler) Get(id string) (*Schedule, error) {
+	var sch Schedule
+	err := s.store.Get(scheduleKey(id), &sch)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sch, nil
+}
+
+func (s *Scheduler) List() ([]*Schedule, error) {
+	schedules := []*Schedule{}
+	var decodeErr error
+	err := s.store.Iterate([]byte("s/s/"), nil, nil, false, func(key, value []byte) bool {
+		var sch Schedule
+		if decodeErr = json.Unmarshal(value, &sch); decodeErr != nil {
+			return false
+		}
+		schedules = append(schedules, &sch)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schedules, decodeErr
+}
+
+// Pause stops a schedule. Resume restarts it from the next match after now; runs
+// missed while paused are never caught up.
+func (s *Scheduler) Pause(id string) (*Schedule, error) {
+	return s.modify(id, func(sch *Schedule) error {
+		sch.Paused = true
+		return nil
+	})
+}
+
+func (s *Scheduler) Resume(id string) (*Schedule, error) {
+	return s.modify(id, func(sch *Schedule) error {
+		c, err := ParseCron(sch.Cron)
+		if err != nil {
+			return err
+		}
+		sch.Paused = false
+		sch.NextRun = c.Next(time.Now().UTC())
+		return nil
+	})
+}
+
+func (s *Scheduler) modify(id string, fn func(sch *Schedule) error) (*Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(sch); err != nil {
+		return nil, err
+	}
+	if err := s.store.Put(scheduleKey(id), sch); err != nil {
+		return nil, err
+	}
+	return sch, nil
+}
+
+// Delete removes a schedule and its execution history.
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	batch := new(store.Batch)
+	batch.Delete(scheduleKey(id))
+	err := s.store.Iterate(executionPrefix(id), nil, nil, false, func(key, value []byte) bool {
+		batch.Delete(append([]byte(nil), key...))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return s.store.Write(batch)
+}
+
+// Executions returns the most recent executions of a schedule, newest first.
+func (s *Scheduler) Executions(id string, limit int) ([]*Execution, error) {
+	executions := []*Execution{}
+	var decodeErr error
+	err := s.store.Iterate(executionPrefix(id), nil, nil, true, func(key, value []byte) bool {
+		var e Execution
+		if decodeErr = json.Unmarshal(value, &e); decodeErr != nil {
+			return false
+		}
+		executions = append(executions, &e)
+		return len(executions) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return executions, decodeErr
+}
+
+// Run executes due schedules until ctx is cancelled. Executions a previous process left
+// pending are marked unknown rather than retried, since their transfer may have been sent.
+func (s *Scheduler) Run(ctx context.Context) {
+	if err := s.recover(); err != nil {
+		log.Printf("scheduler: %v", err)
+	}
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.runDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("scheduler: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) recover() error {
+	var stale []*Execution
+	var decodeErr error
+	err := s.store.Iterate([]byte("s/h/"), nil, nil, false, func(key, value []byte) bool {
+		var e Execution
+		if decodeErr = json.Unmarshal(value, &e); decodeErr != nil {
+			return false
+		}
+		if e.Status == StatusPending {
+			stale = append(stale, &e)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+	for _, e := range stale {
+		e.Status = StatusUnknown
+		e.Error = "interrupted by restart"
+		if err := s.store.Put(executionKey(e.ScheduleID, e.ID), e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) runDue(ctx context.Context) error {
+	schedules, err := s.List()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, sch := range schedules {
+		if sch.Paused || sch.NextRun.IsZero() || sch.NextRun.After(now) {
+			continue
+		}
+		if err := s.fire(ctx, sch.ID, now); err != nil {
+			log.Printf("scheduler: schedule %s: %v", sch.ID, err)
+		}
+	}
+	return nil
+}
+
+// fire records the executions for every run of the schedule due by now, applying its
+// catch-up policy, and advances NextRun in the same write so no run is paid twice.
+func (s *Scheduler) fire(ctx context.Context, id string, now time.Time) error {
+	s.mu.Lock()
+	sch, err := s.Get(id)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if sch.Paused || sch.NextRun.After(now) {
+		s.mu.Unlock()
+		return nil
+	}
+	c, err := ParseCron(sch.Cron)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	var due []time.Time
+	for t := sch.NextRun; !t.IsZero() && !t.After(now) && len(due) < MaxCatchUp; t = c.Next(t) {
+		due = append(due, t)
+	}
+
+	var pay []*Execution
+	batch := new(store.Batch)
+	for i, t := range due {
+		e := &Execution{
+			ID:           newID(now.Add(time.Duration(i))),
+			ScheduleID:   sch.ID,
+			ScheduledFor: t,
+			StartedAt:    now,
+			CatchUp:      now.Sub(t) > s.Grace,
+			Status:       StatusPending,
+		}
+		switch {
+		case !e.CatchUp && i == len(due)-1:
+		case sch.CatchUp == CatchUpAll:
+		case sch.CatchUp == CatchUpOnce && i == len(due)-1:
+		default:
+			e.Status = StatusSkipped
+		}
+		if err := batch.Put(executionKey(sch.ID, e.ID), e); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		if e.Status == StatusPending {
+			pay = append(pay, e)
+		}
+	}
+
+	sch.NextRun = c.Next(now)
+	sch.LastRun = &now
+	if err := batch.Put(scheduleKey(sch.ID), sch); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	err = s.store.Write(batch)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range pay {
+		s.execute(ctx, sch, e)
+	}
+	return nil
+}
+
+// owner returns ctx as the API key that owns the schedule. The key is looked up again on
+// every run, so a schedule stops paying once its key is revoked or deleted. Schedules
+// created while authentication was disabled have no key and run as the service.
+func (s *Scheduler) owner(ctx context.Context, keyID string) (context.Context, error) {
+	if keyID == "" {
+		return ctx, nil
+	}
+	key, err := s.keys.Get(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, auth.ErrRevoked
+	}
+	p := &auth.Principal{ID: key.ID, Name: key.Name, Role: key.Role, Method: "schedule", Tokens: key.Tokens, MaxAmount: key.MaxAmount}
+	return auth.WithPrincipal(ctx, p), nil
+}
+
+// execute pays one run as the schedule's key, or submits it for approval when the
+// amount is above a threshold. A schedule whose key is gone is paused.
+func (s *Scheduler) execute(ctx context.Context, sch *Schedule, e *Execution) {
+	ctx, err := s.owner(ctx, sch.KeyID)
+	if errors.Is(err, auth.ErrKeyNotFound) || errors.Is(err, auth.ErrRevoked) {
+		if _, pauseErr := s.Pause(sch.ID); pauseErr != nil {
+			log.Printf("scheduler: schedule %s: pause: %v", sch.ID, pauseErr)
+		}
+		err = fmt.Errorf("%v, schedule paused", err)
+	}
+	var tx *types.Transaction
+	if err == nil {
+		tx, err = s.submit(ctx, sch, e)
+	}
+	if err != nil {
+		e.Status, e.Error = StatusFailed, err.Error()
+	}
+	s.save(e)
+	if tx != nil {
+		go s.confirm(e, tx)
+	}
+}
+
+func (s *Scheduler) save(e *Execution) {
+	if err := s.store.Put(executionKey(e.ScheduleID, e.ID), e); err != nil {
+		log.Printf("scheduler: execution %s: %v", e.ID, err)
+	}
+}
+
+// submit checks the run against the key's restrictions and the approval rules, then
+// either sends it or leaves it awaiting approval.
+func (s *Scheduler) submit(ctx context.Context, sch *Schedule, e *Execution) (*types.Transaction, error) {
+	token, _, err := s.registry.Resolve(sch.Token.Hex())
+	if err != nil {
+		return nil, err
+	}
+	asset := auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}
+	if err := auth.Authorize(ctx, asset, sch.Amount); err != nil {
+		return nil, err
+	}
+	rule, err := s.approvals.Required(asset, sch.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		return s.send(ctx, sch, e)
+	}
+	summary := fmt.Sprintf("schedule %s: %s %s to %s", sch.ID, units.FormatAmount(sch.Amount, token.Decimals), token.Symbol, sch.Recipient.Hex())
+	req, err := s.approvals.Submit(ctx, rule, ApprovalKind, summary, asset, sch.Amount, approvedRun{ScheduleID: sch.ID, ExecutionID: e.ID})
+	if err != nil {
+		return nil, err
+	}
+	e.Status, e.ApprovalID = StatusApproval, req.ID
+	return nil, nil
+}
+
+// send makes the transfer, counting it against the spending limits of the schedule's key.
+// The caller saves the submitted execution before confirming it.
+func (s *Scheduler) send(ctx context.Context, sch *Schedule, e *Execution) (*types.Transaction, error) {
+	token, instance, err := s.registry.Resolve(sch.Token.Hex())
+	if err != nil {
+		return nil, err
+	}
+	// the recipient may have been denylisted since the schedule was created
+	if err := s.policy.Check(ctx, sch.Recipient, &token.Address, "schedule "+sch.ID); err != nil {
+		return nil, err
+	}
+	asset := auth.Asset{Symbol: token.Symbol, Address: token.Address, Decimals: token.Decimals}
+	spent, err := s.limits.SpendAs(sch.KeyID, asset, []*big.Int{sch.Amount}, "schedule "+sch.ID)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.signer.Transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return instance.Transfer(opts, sch.Recipient, sch.Amount)
+	})
+	if err != nil {
+		if releaseErr := s.limits.Release(spent); releaseErr != nil {
+			log.Printf("scheduler: execution %s: %v", e.ID, releaseErr)
+		}
+		return nil, err
+	}
+	hash := tx.Hash()
+	e.Status, e.TxHash = StatusSubmitted, &hash
+	return tx, nil
+}
+
+// ExecuteApproved sends an approved run. It runs as the key that owns the schedule,
+// which is checked again since it may have been revoked while the run waited.
+func (s *Scheduler) ExecuteApproved(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var run approvedRun
+	if err := json.Unmarshal(payload, &run); err != nil {
+		return nil, err
+	}
+	sch, err := s.Get(run.ScheduleID)
+	if err != nil {
+		return nil, err
+	}
+	var e Execution
+	if err := s.store.Get(executionKey(run.ScheduleID, run.ExecutionID), &e); err != nil {
+		return nil, err
+	}
+	if e.Status != StatusApproval {
+		return nil, ErrNotAwaiting
+	}
+	ctx, err = s.owner(ctx, sch.KeyID)
+	var tx *types.Transaction
+	if err == nil {
+		tx, err = s.send(ctx, sch, &e)
+	}
+	if err != nil {
+		e.Status, e.Error = StatusFailed, err.Error()
+	}
+	s.save(&e)
+	if err != nil {
+		return nil, err
+	}
+	result := e
+	go s.confirm(&e, tx)
+	return &result, nil
+}
+
+func (s *Scheduler) confirm(e *Execution, tx *types.Transaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	receipt, err := bind.WaitMined(ctx, s.backend, tx)
+	if err != nil {
+		log.Printf("scheduler: execution %s: %v", e.ID, err)
+		return
+	}
+	e.Block = receipt.BlockNumber.Uint64()
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		e.Status = StatusConfirmed
+	} else {
+		e.Status, e.Error = StatusFailed, "transaction reverted"
+	}
+	s.save(e)
+}
@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/approval"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/tokens"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tokenUnits(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+// newTestScheduler deploys MyContract on a simulated chain and registers it as TST, with
+// transfers above 10 TST needing approval. It has no signer, so nothing can be sent.
+func newTestScheduler(t *testing.T) (*Scheduler, *auth.Keys, *approval.Workflow, common.Address) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployer := crypto.PubkeyToAddress(key.PublicKey)
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{deployer: {Balance: tokenUnits(100)}}, 10000000)
+	t.Cleanup(func() { backend.Close() })
+	opts, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, _, _, err := contract.DeployMyContract(opts, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+
+	db, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	registry := tokens.NewRegistry(backend, db)
+	if _, err := registry.Add(address, "TST", 0); err != nil {
+		t.Fatal(err)
+	}
+	keys := auth.NewKeys(db, "")
+	approvals := approval.New(db, config.Approvals{Rules: []config.ApprovalRule{{Token: "TST", Threshold: "10"}}})
+	return New(backend, db, registry, nil, nil, nil, keys, approvals), keys, approvals, address
+}
+
+func run(t *testing.T, s *Scheduler, sch *Schedule) *Execution {
+	t.Helper()
+	e := &Execution{ID: newID(time.Now()), ScheduleID: sch.ID, StartedAt: time.Now().UTC(), Status: StatusPending}
+	s.execute(context.Background(), sch, e)
+	var stored Execution
+	if err := s.store.Get(executionKey(sch.ID, e.ID), &stored); err != nil {
+		t.Fatal(err)
+	}
+	return &stored
+}
+
+func TestRunAsOwner(t *testing.T) {
+	s, keys, approvals, token := newTestScheduler(t)
+	key, _, err := keys.Create(auth.Key{Name: "payroll", Role: auth.RoleOperator, MaxAmount: tokenUnits(50).String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := func(amount int64) *Schedule {
+		sch, err := s.Create(Schedule{Token: token, Recipient: common.HexToAddress("0x01"), Amount: tokenUnits(amount), Cron: "0 9 * * *", KeyID: key.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sch
+	}
+
+	// above the approval threshold: submitted as the key, nothing sent yet
+	large := schedule(20)
+	e := run(t, s, large)
+	if e.Status != StatusApproval || e.ApprovalID == "" {
+		t.Fatalf("run above the threshold: %+v", e)
+	}
+	req, err := approvals.Get(e.ApprovalID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Kind != ApprovalKind || req.RequestedBy == nil || req.RequestedBy.ID != key.ID {
+		t.Fatalf("approval request %+v", req)
+	}
+
+	// above the key's max_amount
+	if e := run(t, s, schedule(60)); e.Status != StatusFailed || !strings.Contains(e.Error, auth.ErrForbidden.Error()) {
+		t.Fatalf("run above max_amount: %+v", e)
+	}
+
+	if _, err := keys.Revoke(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if e := run(t, s, large); e.Status != StatusFailed || !strings.Contains(e.Error, auth.ErrRevoked.Error()) {
+		t.Fatalf("run with a revoked key: %+v", e)
+	}
+	if sch, _ := s.Get(large.ID); !sch.Paused {
+		t.Error("schedule of a revoked key was not paused")
+	}
+
+	// the key was revoked while the run waited for approval
+	payload, _ := json.Marshal(approvedRun{ScheduleID: large.ID, ExecutionID: e.ID})
+	if _, err := s.ExecuteApproved(context.Background(), payload); !errors.Is(err, auth.ErrRevoked) {
+		t.Fatalf("approved run with a revoked key: %v, want ErrRevoked", err)
+	}
+	var stored Execution
+	if err := s.store.Get(executionKey(large.ID, e.ID), &stored); err != nil || stored.Status != StatusFailed {
+		t.Fatalf("approved run stored as %+v: %v", stored, err)
+	}
+	if _, err := s.ExecuteApproved(context.Background(), payload); !errors.Is(err, ErrNotAwaiting) {
+		t.Errorf("second approved run: %v, want ErrNotAwaiting", err)
+	}
+}
+
+func TestOwnerKey(t *testing.T) {
+	s, _, _, _ := newTestScheduler(t)
+	if ctx, err := s.owner(context.Background(), ""); err != nil || auth.FromContext(ctx) != nil {
+		t.Errorf("schedule without a key: %v", err)
+	}
+	if _, err := s.owner(context.Background(), "cert:ops"); !errors.Is(err, auth.ErrKeyNotFound) {
+		t.Errorf("caller without a stored key: %v, want ErrKeyNotFound", err)
+	}
+}
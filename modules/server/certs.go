@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const certValidity = 365 * 24 * time.Hour
+
+// GenerateCerts writes a throwaway CA, a server certificate for hosts and a client
+// certificate per name in clients to dir, for trying TLS and mTLS locally:
+//
+//	ca.pem                                   the CA, for client_ca_file and clients
+//	server.pem, server-key.pem               cert_file and key_file
+//	client-<name>.pem, client-<name>-key.pem with subject CN=<name>
+//
+// It returns the paths written.
+func GenerateCerts(dir string, hosts, clients []string) ([]string, error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost"}
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := template("eth-testnet-smartcontract local CA")
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+	var written []string
+	if err := writePEM(filepath.Join(dir, "ca.pem"), "CERTIFICATE", caDER, 0o644); err != nil {
+		return nil, err
+	}
+	written = append(written, filepath.Join(dir, "ca.pem"))
+
+	issue := func(name, cn string, usage x509.ExtKeyUsage, hosts []string) error {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		t := template(cn)
+		t.KeyUsage = x509.KeyUsageDigitalSignature
+		t.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				t.IPAddresses = append(t.IPAddresses, ip)
+			} else {
+				t.DNSNames = append(t.DNSNames, h)
+			}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, t, ca, &key.PublicKey, caKey)
+		if err != nil {
+			return err
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return err
+		}
+		certPath, keyPath := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+		if err := writePEM(certPath, "CERTIFICATE", der, 0o644); err != nil {
+			return err
+		}
+		if err := writePEM(keyPath, "EC PRIVATE KEY", keyDER, 0o600); err != nil {
+			return err
+		}
+		written = append(written, certPath, keyPath)
+		return nil
+	}
+
+	if err := issue("server", hosts[0], x509.ExtKeyUsageServerAuth, hosts); err != nil {
+		return nil, err
+	}
+	for _, c := range clients {
+		if err := issue("client-"+c, c, x509.ExtKeyUsageClientAuth, nil); err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
+
+func template(cn string) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+	}
+}
+
+func writePEM(path, typ string, der []byte, perm os.FileMode) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), perm)
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultAddr           = ":8080"
+	defaultReloadInterval = 30 * time.Second
+)
+
+var ErrMissingCert = errors.New("tls needs cert_file and key_file")
+
+// ListenAndServe serves handler on cfg.Addr, over HTTPS when TLS is enabled.
+func ListenAndServe(ctx context.Context, cfg config.Server, handler http.Handler) error {
+	addr := cfg.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	if !cfg.TLS.Enabled {
+		log.Printf("server: listening on %s", addr)
+		return http.ListenAndServe(addr, handler)
+	}
+
+	tlsConfig, err := newTLSConfig(ctx, cfg.TLS)
+	if err != nil {
+		return err
+	}
+	if cfg.TLS.RedirectAddr != "" {
+		go func() {
+			log.Printf("server: redirecting %s to https", cfg.TLS.RedirectAddr)
+			if err := http.ListenAndServe(cfg.TLS.RedirectAddr, redirect(addr)); err != nil {
+				log.Printf("server: redirect listener: %v", err)
+			}
+		}()
+	}
+	srv := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig}
+	log.Printf("server: listening on %s with tls", addr)
+	return srv.ListenAndServeTLS("", "")
+}
+
+func newTLSConfig(ctx context.Context, cfg config.TLS) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, ErrMissingCert
+	}
+	certs, err := newReloader(cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	interval := time.Duration(cfg.ReloadInterval)
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	go certs.watch(ctx, interval)
+
+	base := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+	}
+	switch {
+	case cfg.ClientCAFile == "":
+	case cfg.RequireClientCert:
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		// verified when sent, so other callers can still use API keys
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetCertificate:     certs.getCertificate,
+		GetConfigForClient: certs.config(base),
+	}, nil
+}
+
+// redirect sends every request to the same URL on https, on the port of tlsAddr.
+func redirect(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		// 308 keeps the method and body, unlike 301
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/auth"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/config"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readCert(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s: no PEM block", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestGenerateCerts(t *testing.T) {
+	dir := t.TempDir()
+	written, err := GenerateCerts(dir, []string{"localhost", "127.0.0.1"}, []string{"ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ca.pem", "server.pem", "server-key.pem", "client-ops.pem", "client-ops-key.pem"}
+	if len(written) != len(want) {
+		t.Fatalf("wrote %v, want %v", written, want)
+	}
+	for i, name := range want {
+		if written[i] != filepath.Join(dir, name) {
+			t.Errorf("file %d = %s, want %s", i, written[i], name)
+		}
+	}
+	for _, name := range []string{"server-key.pem", "client-ops-key.pem"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Errorf("%s is readable by others: %v", name, perm)
+		}
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(readCert(t, filepath.Join(dir, "ca.pem")))
+	server := readCert(t, filepath.Join(dir, "server.pem"))
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		opts := x509.VerifyOptions{Roots: roots, DNSName: host, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+		if _, err := server.Verify(opts); err != nil {
+			t.Errorf("server certificate for %s: %v", host, err)
+		}
+	}
+	client := readCert(t, filepath.Join(dir, "client-ops.pem"))
+	if client.Subject.CommonName != "ops" {
+		t.Errorf("client subject = %s, want CN=ops", client.Subject)
+	}
+	if _, err := client.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("client certificate: %v", err)
+	}
+	if _, err := client.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err == nil {
+		t.Error("client certificate is valid for servers")
+	}
+}
+
+// touch moves the modification time of the files forward, in case they were rewritten
+// within the resolution of the file system clock.
+func touch(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	later := time.Now().Add(time.Minute)
+	for _, name := range names {
+		if err := os.Chtimes(filepath.Join(dir, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateCerts(dir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile, caFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"), filepath.Join(dir, "ca.pem")
+	r, err := newReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.changed() {
+		t.Fatal("changed right after loading")
+	}
+	first, err := r.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate
+	if _, err := GenerateCerts(dir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, dir, "server.pem", "server-key.pem", "ca.pem")
+	if !r.changed() {
+		t.Fatal("rotated files not noticed")
+	}
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _ := r.getCertificate(nil)
+	if string(rotated.Certificate[0]) == string(first.Certificate[0]) {
+		t.Fatal("still serving the old certificate")
+	}
+	conf, err := r.config(&tls.Config{})(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCert(t, certFile).Verify(x509.VerifyOptions{Roots: conf.ClientCAs}); err != nil {
+		t.Errorf("client CAs are not the rotated CA: %v", err)
+	}
+
+	// a certificate written before its key fails to load and keeps the last good pair
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, dir, "server-key.pem")
+	if err := r.load(); err == nil {
+		t.Fatal("loaded a broken key")
+	}
+	if kept, _ := r.getCertificate(nil); kept != rotated {
+		t.Error("a failed reload replaced the certificate")
+	}
+}
+
+func TestReloaderEmptyCA(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateCerts(dir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, []byte("no certificates"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := newReloader(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"), caFile)
+	if !errors.Is(err, ErrNoCertificates) {
+		t.Fatalf("err = %v, want ErrNoCertificates", err)
+	}
+}
+
+// serveMTLS serves the auth middleware over TLS with the config built from cfg and
+// returns its address. The handler answers with the role and method of the caller.
+func serveMTLS(t *testing.T, cfg config.TLS, authCfg config.Auth) string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	tlsConfig, err := newTLSConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	authenticator := auth.New(auth.NewKeys(db, ""), authCfg)
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := auth.FromContext(r.Context())
+		fmt.Fprintf(w, "%s %s", p.Role, p.Method)
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// handshakes refused on purpose are not worth logging
+	srv := &http.Server{Handler: handler, ErrorLog: log.New(io.Discard, "", 0)}
+	go srv.Serve(tls.NewListener(ln, tlsConfig))
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func mtlsClient(t *testing.T, dir, name string) *http.Client {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(readCert(t, filepath.Join(dir, "ca.pem")))
+	conf := &tls.Config{RootCAs: roots}
+	if name != "" {
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client-"+name+".pem"), filepath.Join(dir, "client-"+name+"-key.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: conf}, Timeout: 5 * time.Second}
+}
+
+func TestClientCertRoles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateCerts(dir, []string{"127.0.0.1"}, []string{"ops", "viewer", "stranger"}); err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg := config.TLS{
+		Enabled:      true,
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server-key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	authCfg := config.Auth{ClientCerts: []config.ClientCert{
+		{Subject: "ops", Role: "operator"},
+		{Subject: "CN=viewer", Role: "reader"},
+	}}
+	addr := serveMTLS(t, tlsCfg, authCfg)
+
+	tests := []struct {
+		client string
+		method string
+		status int
+		body   string
+	}{
+		{"ops", http.MethodPost, http.StatusOK, "operator mtls"},
+		{"viewer", http.MethodGet, http.StatusOK, "reader mtls"},
+		{"viewer", http.MethodPost, http.StatusForbidden, ""},
+		{"stranger", http.MethodGet, http.StatusUnauthorized, ""},
+		{"", http.MethodGet, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "https://"+addr+"/contract/transfer", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := mtlsClient(t, dir, tt.client).Do(req)
+		if err != nil {
+			t.Fatalf("%s %s as %q: %v", tt.method, req.URL.Path, tt.client, err)
+		}
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s as %q: status %d, want %d", tt.method, tt.client, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.body != "" && string(body[:n]) != tt.body {
+			t.Errorf("%s as %q: caller %q, want %q", tt.method, tt.client, body[:n], tt.body)
+		}
+	}
+}
+
+func TestRequireClientCert(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateCerts(dir, []string{"127.0.0.1"}, []string{"ops"}); err != nil {
+		t.Fatal(err)
+	}
+	addr := serveMTLS(t, config.TLS{
+		Enabled:           true,
+		CertFile:          filepath.Join(dir, "server.pem"),
+		KeyFile:           filepath.Join(dir, "server-key.pem"),
+		ClientCAFile:      filepath.Join(dir, "ca.pem"),
+		RequireClientCert: true,
+	}, config.Auth{ClientCerts: []config.ClientCert{{Subject: "ops", Role: "admin"}}})
+
+	if _, err := mtlsClient(t, dir, "").Get("https://" + addr + "/health"); err == nil {
+		t.Error("served a client without a certificate")
+	}
+	resp, err := mtlsClient(t, dir, "ops").Get("https://" + addr + "/tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestMissingCert(t *testing.T) {
+	if _, err := newTLSConfig(context.Background(), config.TLS{Enabled: true}); !errors.Is(err, ErrMissingCert) {
+		t.Fatalf("err = %v, want ErrMissingCert", err)
+	}
+}
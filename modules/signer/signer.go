@@ -0,0 +1,238 @@
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"log"
+	"math/big"
+	"sync"
+)
+
+// Backend is what the signer needs from a node to allocate nonces and send gap fillers.
+type Backend interface {
+	bind.ContractTransactor
+	ChainID(ctx context.Context) (*big.Int, error)
+}
+
+// Signer owns the service key and hands out nonces, so concurrent transactions
+// from the same account never reuse or skip one.
+type Signer struct {
+	backend Backend
+	key     *ecdsa.PrivateKey
+	address common.Address
+
+	mu      sync.Mutex
+	next    *uint64
+	chainID *big.Int
+	onSent  []func(ctx context.Context, tx *types.Transaction)
+}
+
+func New(backend Backend, key *ecdsa.PrivateKey) *Signer {
+	return &Signer{backend: backend, key: key, address: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+func (s *Signer) Address() common.Address {
+	return s.address
+}
+
+// ChainID returns the chain id, cached after the first successful call.
+func (s *Signer) ChainID(ctx context.Context) (*big.Int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.chainID != nil {
+		return s.chainID, nil
+	}
+	id, err := s.backend.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.chainID = id
+	return id, nil
+}
+
+// Reserve allocates n sequential nonces and returns the first. The pending nonce of the
+// node is used when it is ahead, e.g. after transactions were sent with the key elsewhere.
+func (s *Signer) Reserve(ctx context.Context, n int) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending, err := s.backend.PendingNonceAt(ctx, s.address)
+	if err != nil {
+		return 0, err
+	}
+	if s.next == nil || pending > *s.next {
+		s.next = &pending
+	}
+	first := *s.next
+	*s.next += uint64(n)
+	return first, nil
+}
+
+// Opts returns transaction options that sign with the key at nonce.
+func (s *Signer) Opts(ctx context.Context, nonce uint64) (*bind.TransactOpts, error) {
+	chainID, err := s.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := bind.NewKeyedTransactorWithChainID(s.key, chainID)
+	if err != nil {
+		return nil, err
+	}
+	opts.Context = ctx
+	opts.Nonce = new(big.Int).SetUint64(nonce)
+	return opts, nil
+}
+
+// SignTx signs a raw transaction with the key.
+func (s *Signer) SignTx(ctx context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	chainID, err := s.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+// Abandon gives back a reserved nonce that was never used. The last nonce handed out is
+// simply reused; an earlier one would block every later transaction, so the gap is
+// filled with a zero value transfer to self.
+func (s *Signer) Abandon(ctx context.Context, nonce uint64) error {
+	s.mu.Lock()
+	if s.next != nil && *s.next == nonce+1 {
+		*s.next = nonce
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	gasPrice, err := s.backend.SuggestGasPrice(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := s.SignTx(ctx, types.NewTransaction(nonce, s.address, new(big.Int), 21000, gasPrice, nil))
+	if err != nil {
+		return err
+	}
+	if err := s.backend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	log.Printf("signer: filled nonce gap %d with %s", nonce, tx.Hash().Hex())
+	return nil
+}
+
+// OnSent registers fn to be called with every transaction sent through Transact or Sent.
+func (s *Signer) OnSent(fn func(ctx context.Context, tx *types.Transaction)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onSent = append(s.onSent, fn)
+}
+
+// Sent reports a transaction that was signed with the key and sent outside of Transact.
+func (s *Signer) Sent(ctx context.Context, tx *types.Transaction) {
+	s.mu.Lock()
+	listeners := append([]func(context.Context, *types.Transaction){}, s.onSent...)
+	s.mu.Unlock()
+	for _, fn := range listeners {
+		fn(ctx, tx)
+	}
+}
+
+// Transact reserves a nonce and runs send with options for it, abandoning the nonce if send fails.
+func (s *Signer) Transact(ctx context.Context, send func(opts *bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	nonce, err := s.Reserve(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := s.Opts(ctx, nonce)
+	if err == nil {
+		var tx *types.Transaction
+		if tx, err = send(opts); err == nil {
+			s.Sent(ctx, tx)
+			return tx, nil
+		}
+	}
+	if abandonErr := s.Abandon(context.Background(), nonce); abandonErr != nil {
+		log.Printf("signer: abandon nonce %d: %v", nonce, abandonErr)
+	}
+	return nil, err
+}
+
+// Fees are the gas prices for a new transaction: a tip and fee cap when the chain has
+// a base fee (EIP-1559), otherwise a legacy gas price.
+type Fees struct {
+	GasPrice  *big.Int // legacy chains only
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+}
+
+// MaxPrice is the most that can be paid per unit of gas.
+func (f *Fees) MaxPrice() *big.Int {
+	if f.GasFeeCap != nil {
+		return f.GasFeeCap
+	}
+	return f.GasPrice
+}
+
+// SuggestFees uses the same rule as contract transactions: a fee cap of twice the base fee plus the tip.
+func (s *Signer) SuggestFees(ctx context.Context) (*Fees, error) {
+	head, err := s.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if head.BaseFee == nil {
+		price, err := s.backend.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Fees{GasPrice: price}, nil
+	}
+	tip, err := s.backend.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	feeCap := new(big.Int).Add(tip, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+	return &Fees{GasTipCap: tip, GasFeeCap: feeCap}, nil
+}
+
+// NewTx builds an unsigned transaction with the given fees.
+func NewTx(chainID *big.Int, nonce uint64, to common.Address, value *big.Int, gasLimit uint64, fees *Fees, data []byte) *types.Transaction {
+	if fees.GasFeeCap != nil {
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainID,
+			Nonce:     nonce,
+			GasTipCap: fees.GasTipCap,
+			GasFeeCap: fees.GasFeeCap,
+			Gas:       gasLimit,
+			To:        &to,
+			Value:     value,
+			Data:      data,
+		})
+	}
+	return types.NewTransaction(nonce, to, value, gasLimit, fees.GasPrice, data)
+}
+
+// SendEth sends value wei to the address.
+func (s *Signer) SendEth(ctx context.Context, to common.Address, value *big.Int) (*types.Transaction, error) {
+	return s.Transact(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		gasLimit, err := s.backend.EstimateGas(ctx, ethereum.CallMsg{From: s.address, To: &to, Value: value})
+		if err != nil {
+			return nil, err
+		}
+		fees, err := s.SuggestFees(ctx)
+		if err != nil {
+			return nil, err
+		}
+		chainID, err := s.ChainID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := opts.Signer(s.address, NewTx(chainID, opts.Nonce.Uint64(), to, value, gasLimit, fees, nil))
+		if err != nil {
+			return nil, err
+		}
+		return tx, s.backend.SendTransaction(ctx, tx)
+	})
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Store is an embedded key/value store backed by leveldb.
+// Values are serialized as JSON.
+type Store struct {
+	db *leveldb.DB
+}
+
+func Open(path string) (*Store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Get(key []byte, v interface{}) error {
+	data, err := s.db.Get(key, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *Store) Has(key []byte) (bool, error) {
+	return s.db.Has(key, nil)
+}
+
+func (s *Store) Put(key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(key, data, nil)
+}
+
+func (s *Store) Delete(key []byte) error {
+	return s.db.Delete(key, nil)
+}
+
+// Batch collects writes that are applied atomically by Write.
+type Batch struct {
+	batch leveldb.Batch
+}
+
+func (b *Batch) Put(key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b.batch.Put(key, data)
+	return nil
+}
+
+func (b *Batch) PutRaw(key, value []byte) {
+	b.batch.Put(key, value)
+}
+
+func (b *Batch) Delete(key []byte) {
+	b.batch.Delete(key)
+}
+
+func (b *Batch) Len() int {
+	return b.batch.Len()
+}
+
+func (s *Store) Write(b *Batch) error {
+	return s.db.Write(&b.batch, nil)
+}
+
+// Iterate walks the keys in [start, limit) in ascending or descending order.
+// A nil limit means "until the end of prefix". Iteration stops when fn returns false.
+// key and value are only valid during the call to fn.
+func (s *Store) Iterate(prefix, start, limit []byte, reverse bool, fn func(key, value []byte) bool) error {
+	r := util.BytesPrefix(prefix)
+	if start != nil {
+		r.Start = start
+	}
+	if limit != nil {
+		r.Limit = limit
+	}
+
+	it := s.db.NewIterator(r, nil)
+	defer it.Release()
+
+	if reverse {
+		for ok := it.Last(); ok; ok = it.Prev() {
+			if !fn(it.Key(), it.Value()) {
+				break
+			}
+		}
+	} else {
+		for ok := it.First(); ok; ok = it.Next() {
+			if !fn(it.Key(), it.Value()) {
+				break
+			}
+		}
+	}
+	return it.Error()
+}
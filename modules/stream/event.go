@@ -0,0 +1,136 @@
+package stream
+
+import (
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/units"
+	"github.com/ethereum/go-ethereum/common"
+	"strconv"
+	"strings"
+)
+
+const (
+	KindTransfer = "transfer"
+	KindApproval = "approval"
+)
+
+// Event is a contract event ready to be delivered to subscribers.
+// ID is "block:logIndex" and is what clients send back as Last-Event-ID to resume.
+type Event struct {
+	ID       string
+	Kind     string
+	Block    uint64
+	LogIndex uint
+	Removed  bool // the log was reverted by a chain reorganisation
+	Data     interface{}
+
+	addresses []common.Address
+}
+
+type transferData struct {
+	BlockNumber    uint64 `json:"block_number"`
+	LogIndex       uint   `json:"log_index"`
+	TxHash         string `json:"tx_hash"`
+	From           string `json:"from"`
+	To             string `json:"to"`
+	Value          string `json:"value"`
+	ValueFormatted string `json:"value_formatted"`
+	Removed        bool   `json:"removed"`
+}
+
+type approvalData struct {
+	BlockNumber    uint64 `json:"block_number"`
+	LogIndex       uint   `json:"log_index"`
+	TxHash         string `json:"tx_hash"`
+	Owner          string `json:"owner"`
+	Spender        string `json:"spender"`
+	Value          string `json:"value"`
+	ValueFormatted string `json:"value_formatted"`
+	Removed        bool   `json:"removed"`
+}
+
+func eventID(block uint64, logIndex uint) string {
+	return fmt.Sprintf("%d:%d", block, logIndex)
+}
+
+// ParseEventID parses a "block:logIndex" event ID.
+func ParseEventID(id string) (uint64, uint, error) {
+	parts := strings.Split(id, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+	block, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+	logIndex, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+	return block, uint(logIndex), nil
+}
+
+// After reports whether e comes strictly after the given position in chain order.
+func (e *Event) After(block uint64, logIndex uint) bool {
+	return e.Block > block || (e.Block == block && e.LogIndex > logIndex)
+}
+
+// Addresses returns the addresses the event involves: sender and recipient,
+// or owner and spender.
+func (e *Event) Addresses() []common.Address {
+	return e.addresses
+}
+
+func (e *Event) matches(filter map[common.Address]bool) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, addr := range e.addresses {
+		if filter[addr] {
+			return true
+		}
+	}
+	return false
+}
+
+func newTransferEvent(ev *contract.MyContractTransfer, decimals uint8) *Event {
+	return &Event{
+		ID:       eventID(ev.Raw.BlockNumber, ev.Raw.Index),
+		Kind:     KindTransfer,
+		Block:    ev.Raw.BlockNumber,
+		LogIndex: ev.Raw.Index,
+		Removed:  ev.Raw.Removed,
+		Data: transferData{
+			BlockNumber:    ev.Raw.BlockNumber,
+			LogIndex:       ev.Raw.Index,
+			TxHash:         ev.Raw.TxHash.Hex(),
+			From:           ev.From.Hex(),
+			To:             ev.To.Hex(),
+			Value:          ev.Value.String(),
+			ValueFormatted: units.FormatAmount(ev.Value, decimals),
+			Removed:        ev.Raw.Removed,
+		},
+		addresses: []common.Address{ev.From, ev.To},
+	}
+}
+
+func newApprovalEvent(ev *contract.MyContractApproval, decimals uint8) *Event {
+	return &Event{
+		ID:       eventID(ev.Raw.BlockNumber, ev.Raw.Index),
+		Kind:     KindApproval,
+		Block:    ev.Raw.BlockNumber,
+		LogIndex: ev.Raw.Index,
+		Removed:  ev.Raw.Removed,
+		Data: approvalData{
+			BlockNumber:    ev.Raw.BlockNumber,
+			LogIndex:       ev.Raw.Index,
+			TxHash:         ev.Raw.TxHash.Hex(),
+			Owner:          ev.Owner.Hex(),
+			Spender:        ev.Spender.Hex(),
+			Value:          ev.Value.String(),
+			ValueFormatted: units.FormatAmount(ev.Value, decimals),
+			Removed:        ev.Raw.Removed,
+		},
+		addresses: []common.Address{ev.Owner, ev.Spender},
+	}
+}
@@ -0,0 +1,258 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	HeartbeatInterval = 15 * time.Second
+	writeTimeout      = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+type message struct {
+	ID   string      `json:"id,omitempty"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// TransfersHandler serves /stream/transfers, see Handler.
+func (h *Hub) TransfersHandler(w http.ResponseWriter, r *http.Request) {
+	h.Handler(KindTransfer)(w, r)
+}
+
+// ApprovalsHandler serves /stream/approvals, see Handler.
+func (h *Hub) ApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	h.Handler(KindApproval)(w, r)
+}
+
+// Handler streams events of kind over WebSocket when the request asks for an upgrade,
+// and as Server-Sent Events otherwise.
+//
+// address (repeatable or comma separated) restricts the stream to events touching those addresses.
+// The Last-Event-ID header, or the last_event_id query parameter, resumes delivery after that event.
+// Resuming from more than MaxReplayBlocks behind the head is refused with 400.
+func (h *Hub) Handler(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addresses, err := parseAddresses(r)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("last_event_id")
+		}
+		var resume bool
+		var block uint64
+		var logIndex uint
+		if lastID != "" {
+			if block, logIndex, err = ParseEventID(lastID); err != nil {
+				api.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			resume = true
+		}
+
+		// Subscribe before replaying so that nothing emitted in between is lost;
+		// duplicates are skipped by position below.
+		sub := h.Subscribe(kind, addresses)
+		defer h.Unsubscribe(sub)
+
+		var backlog []*Event
+		if resume {
+			err = h.Replay(r.Context(), kind, addresses, block, logIndex, func(ev *Event) error {
+				backlog = append(backlog, ev)
+				return nil
+			})
+			if errors.Is(err, ErrReplayTooFar) {
+				api.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			if err != nil {
+				api.WriteError(w, http.StatusBadGateway, err)
+				return
+			}
+		}
+
+		if websocket.IsWebSocketUpgrade(r) {
+			h.serveWebSocket(w, r, sub, backlog, block, logIndex, resume)
+		} else {
+			h.serveSSE(w, r, sub, backlog, block, logIndex, resume)
+		}
+	}
+}
+
+// cursor tracks the last delivered position so replayed and live events are not sent twice.
+type cursor struct {
+	block    uint64
+	logIndex uint
+	set      bool
+}
+
+// advance reports whether ev is new and moves the cursor past it. Removed events
+// are always delivered since they refer back to positions already sent.
+func (c *cursor) advance(ev *Event) bool {
+	if ev.Removed {
+		return true
+	}
+	if c.set && !ev.After(c.block, c.logIndex) {
+		return false
+	}
+	c.block, c.logIndex, c.set = ev.Block, ev.LogIndex, true
+	return true
+}
+
+func (h *Hub) serveSSE(w http.ResponseWriter, r *http.Request, sub *Subscriber, backlog []*Event, block uint64, logIndex uint, resume bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.WriteError(w, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	c := cursor{block: block, logIndex: logIndex, set: resume}
+	send := func(ev *Event) error {
+		if !c.advance(ev) {
+			return nil
+		}
+		data, err := json.Marshal(ev.Data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Kind, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	for _, ev := range backlog {
+		if err := send(ev); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev := <-sub.Events:
+			if err := send(ev); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-sub.Dropped:
+			// The client reconnects with Last-Event-ID and replays what it missed.
+			fmt.Fprint(w, "event: dropped\ndata: {\"reason\":\"slow consumer\"}\n\n")
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *Hub) serveWebSocket(w http.ResponseWriter, r *http.Request, sub *Subscriber, backlog []*Event, block uint64, logIndex uint, resume bool) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Read pump: handles pongs and notices when the client goes away.
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * HeartbeatInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * HeartbeatInterval))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	c := cursor{block: block, logIndex: logIndex, set: resume}
+	send := func(ev *Event) error {
+		if !c.advance(ev) {
+			return nil
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return conn.WriteJSON(message{ID: ev.ID, Type: ev.Kind, Data: ev.Data})
+	}
+
+	for _, ev := range backlog {
+		if err := send(ev); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev := <-sub.Events:
+			if err := send(ev); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(message{Type: "heartbeat"}); err != nil {
+				return
+			}
+		case <-sub.Dropped:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer"),
+				time.Now().Add(writeTimeout))
+			return
+		case <-closed:
+			return
+		}
+	}
+}
+
+func parseAddresses(r *http.Request) ([]common.Address, error) {
+	var addresses []common.Address
+	for _, v := range r.URL.Query()["address"] {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			addr, err := api.HexAddress("address", s)
+			if err != nil {
+				return nil, err
+			}
+			addresses = append(addresses, addr)
+		}
+	}
+	return addresses, nil
+}
@@ -0,0 +1,248 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// SubscriberBuffer is the number of events queued per subscriber. A subscriber whose queue
+	// is full is disconnected instead of slowing down everyone else; it can resume with its last event ID.
+	SubscriberBuffer = 256
+
+	// ReplayPageBlocks is the block range of one log query when replaying, so a resume
+	// from far back never asks the node for an unbounded range.
+	ReplayPageBlocks = 2000
+	// MaxReplayBlocks is how far behind the head a resume may start.
+	MaxReplayBlocks = 100000
+
+	resubscribeDelay = 5 * time.Second
+)
+
+var ErrReplayTooFar = fmt.Errorf("cannot resume more than %d blocks back", MaxReplayBlocks)
+
+// Subscriber receives the events of one kind that match its address filter.
+type Subscriber struct {
+	Events <-chan *Event
+	// Dropped is closed when the subscriber fell too far behind and was disconnected.
+	Dropped <-chan struct{}
+
+	kind    string
+	filter  map[common.Address]bool
+	events  chan *Event
+	dropped chan struct{}
+}
+
+// Hub fans out live Transfer and Approval events from a single pair of contract subscriptions.
+type Hub struct {
+	backend  bind.ContractBackend
+	instance *contract.MyContract
+	decimals uint8
+
+	mu   sync.Mutex
+	subs map[*Subscriber]struct{}
+}
+
+func NewHub(backend bind.ContractBackend, token common.Address) (*Hub, error) {
+	instance, err := contract.NewMyContract(token, backend)
+	if err != nil {
+		return nil, err
+	}
+	decimals, err := instance.Decimals(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Hub{
+		backend:  backend,
+		instance: instance,
+		decimals: decimals,
+		subs:     make(map[*Subscriber]struct{}),
+	}, nil
+}
+
+// Run keeps the contract subscriptions alive until ctx is cancelled.
+func (h *Hub) Run(ctx context.Context) {
+	go h.watch(ctx, KindTransfer, func(opts *bind.WatchOpts, done <-chan struct{}) (event.Subscription, error) {
+		sink := make(chan *contract.MyContractTransfer)
+		sub, err := h.instance.WatchTransfer(opts, sink, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			for {
+				select {
+				case ev := <-sink:
+					h.broadcast(newTransferEvent(ev, h.decimals))
+				case <-done:
+					return
+				}
+			}
+		}()
+		return sub, nil
+	})
+	h.watch(ctx, KindApproval, func(opts *bind.WatchOpts, done <-chan struct{}) (event.Subscription, error) {
+		sink := make(chan *contract.MyContractApproval)
+		sub, err := h.instance.WatchApproval(opts, sink, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			for {
+				select {
+				case ev := <-sink:
+					h.broadcast(newApprovalEvent(ev, h.decimals))
+				case <-done:
+					return
+				}
+			}
+		}()
+		return sub, nil
+	})
+}
+
+// watch (re)subscribes with subscribe until ctx is cancelled. done is closed once
+// the current subscription has ended so the forwarding goroutine can exit.
+func (h *Hub) watch(ctx context.Context, kind string, subscribe func(opts *bind.WatchOpts, done <-chan struct{}) (event.Subscription, error)) {
+	for {
+		done := make(chan struct{})
+		sub, err := subscribe(&bind.WatchOpts{Context: ctx}, done)
+		if err != nil {
+			log.Printf("stream: subscribe %s: %v", kind, err)
+		} else {
+			select {
+			case err := <-sub.Err():
+				log.Printf("stream: %s subscription ended: %v", kind, err)
+			case <-ctx.Done():
+				sub.Unsubscribe()
+			}
+		}
+		close(done)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+func (h *Hub) broadcast(ev *Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		if s.kind != ev.Kind || !ev.matches(s.filter) {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+			delete(h.subs, s)
+			close(s.dropped)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for events of kind touching any of addresses (all events if empty).
+func (h *Hub) Subscribe(kind string, addresses []common.Address) *Subscriber {
+	s := &Subscriber{
+		kind:    kind,
+		filter:  make(map[common.Address]bool),
+		events:  make(chan *Event, SubscriberBuffer),
+		dropped: make(chan struct{}),
+	}
+	s.Events = s.events
+	s.Dropped = s.dropped
+	for _, addr := range addresses {
+		s.filter[addr] = true
+	}
+
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+// Replay calls fn with the past events of kind after position block:logIndex, in chain
+// order, querying the node ReplayPageBlocks at a time. It returns ErrReplayTooFar when
+// block is more than MaxReplayBlocks behind the head.
+func (h *Hub) Replay(ctx context.Context, kind string, addresses []common.Address, block uint64, logIndex uint, fn func(ev *Event) error) error {
+	filter := make(map[common.Address]bool)
+	for _, addr := range addresses {
+		filter[addr] = true
+	}
+	header, err := h.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	head := header.Number.Uint64()
+	if head > block && head-block > MaxReplayBlocks {
+		return fmt.Errorf("%w: event %d:%d is %d blocks old", ErrReplayTooFar, block, logIndex, head-block)
+	}
+
+	for start := block; start <= head; start += ReplayPageBlocks {
+		end := start + ReplayPageBlocks - 1
+		if end > head {
+			end = head
+		}
+		events, err := h.replayPage(&bind.FilterOpts{Start: start, End: &end, Context: ctx}, kind)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if !ev.After(block, logIndex) || !ev.matches(filter) {
+				continue
+			}
+			if err := fn(ev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (h *Hub) replayPage(opts *bind.FilterOpts, kind string) ([]*Event, error) {
+	var events []*Event
+	switch kind {
+	case KindTransfer:
+		it, err := h.instance.FilterTransfer(opts, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer it.Close()
+		for it.Next() {
+			events = append(events, newTransferEvent(it.Event, h.decimals))
+		}
+		if err := it.Error(); err != nil {
+			return nil, err
+		}
+	case KindApproval:
+		it, err := h.instance.FilterApproval(opts, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer it.Close()
+		for it.Next() {
+			events = append(events, newApprovalEvent(it.Event, h.decimals))
+		}
+		if err := it.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown event kind %q", kind)
+	}
+	return events, nil
+}
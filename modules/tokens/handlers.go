@@ -0,0 +1,73 @@
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"net/http"
+)
+
+type addRequest struct {
+	Address    string `json:"address"`
+	Symbol     string `json:"symbol"`
+	StartBlock uint64 `json:"start_block"`
+}
+
+// HTTPStatus maps registry errors to response status codes.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnknownToken):
+		return http.StatusNotFound
+	case errors.Is(err, ErrExists), errors.Is(err, ErrConfigured):
+		return http.StatusConflict
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// ListHandler serves GET /tokens, the registered tokens.
+func (r *Registry) ListHandler(w http.ResponseWriter, req *http.Request) {
+	api.WriteJSON(w, http.StatusOK, r.List())
+}
+
+// GetHandler serves GET /tokens/{id}, a token by symbol or address.
+func (r *Registry) GetHandler(w http.ResponseWriter, req *http.Request) {
+	t, _, err := r.Resolve(router.Param(req, "id"))
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, t)
+}
+
+// RemoveHandler serves DELETE /tokens/{id} for tokens added through this API.
+func (r *Registry) RemoveHandler(w http.ResponseWriter, req *http.Request) {
+	if err := r.Remove(router.Param(req, "id")); err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddHandler serves POST /tokens {"address", "symbol", "start_block"}; the symbol defaults
+// to the on-chain symbol.
+func (r *Registry) AddHandler(w http.ResponseWriter, req *http.Request) {
+	var body addRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	address, err := api.Address("address", body.Address)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	t, err := r.Add(address, body.Symbol, body.StartBlock)
+	if err != nil {
+		api.WriteError(w, HTTPStatus(err), err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, t)
+}
@@ -0,0 +1,290 @@
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/contract"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownToken = errors.New("unknown token")
+	ErrExists       = errors.New("token already registered")
+	ErrConfigured   = errors.New("configured tokens can only be removed from the config file")
+)
+
+// Token is a registered ERC-20 and its cached metadata.
+type Token struct {
+	Address    common.Address `json:"address"`
+	Symbol     string         `json:"symbol"`
+	Name       string         `json:"name"`
+	Decimals   uint8          `json:"decimals"`
+	StartBlock uint64         `json:"start_block"`
+	Configured bool           `json:"configured"` // from the config file rather than the admin API
+}
+
+// entry is a registered token; instance is nil until the contract is bound.
+type entry struct {
+	token    Token
+	instance *contract.MyContract
+}
+
+// Registry resolves token identifiers, a symbol or an address, to bound contracts.
+// Contracts are bound and their name, symbol and decimals fetched on first use.
+type Registry struct {
+	backend bind.ContractBackend
+	store   *store.Store
+
+	mu       sync.Mutex
+	entries  map[common.Address]*entry
+	order    []common.Address // registration order, the first token is the default
+	onAdd    []func(Token)
+	onRemove []func(Token)
+}
+
+func NewRegistry(backend bind.ContractBackend, db *store.Store) *Registry {
+	return &Registry{
+		backend: backend,
+		store:   db,
+		entries: make(map[common.Address]*entry),
+	}
+}
+
+func storedKey(address common.Address) []byte {
+	return append([]byte("k/"), address.Bytes()...)
+}
+
+// OnAdd registers fn to be called for every token added from now on.
+func (r *Registry) OnAdd(fn func(Token)) {
+	r.mu.Lock()
+	r.onAdd = append(r.onAdd, fn)
+	r.mu.Unlock()
+}
+
+// OnRemove registers fn to be called for every token removed from now on.
+func (r *Registry) OnRemove(fn func(Token)) {
+	r.mu.Lock()
+	r.onRemove = append(r.onRemove, fn)
+	r.mu.Unlock()
+}
+
+// Register adds a configured token. Its metadata is loaded lazily.
+func (r *Registry) Register(address common.Address, symbol string, startBlock uint64) error {
+	return r.add(&entry{token: Token{Address: address, Symbol: symbol, StartBlock: startBlock, Configured: true}})
+}
+
+// LoadStored registers the tokens previously added through the admin API.
+func (r *Registry) LoadStored() error {
+	var tokens []Token
+	var decodeErr error
+	err := r.store.Iterate([]byte("k/"), nil, nil, false, func(key, value []byte) bool {
+		var t Token
+		if decodeErr = json.Unmarshal(value, &t); decodeErr != nil {
+			return false
+		}
+		tokens = append(tokens, t)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+	for _, t := range tokens {
+		if err := r.add(&entry{token: t}); err != nil && !errors.Is(err, ErrExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add registers a token through the admin API: the contract must answer the ERC-20
+// metadata calls, and the token is persisted so it survives restarts.
+func (r *Registry) Add(address common.Address, symbol string, startBlock uint64) (*Token, error) {
+	e, err := r.bind(Token{Address: address, Symbol: symbol, StartBlock: startBlock})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.add(e); err != nil {
+		return nil, err
+	}
+	if err := r.store.Put(storedKey(address), e.token); err != nil {
+		return nil, err
+	}
+	t := e.token
+	return &t, nil
+}
+
+func (r *Registry) add(e *entry) error {
+	t := e.token
+	r.mu.Lock()
+	if _, ok := r.entries[t.Address]; ok {
+		r.mu.Unlock()
+		return ErrExists
+	}
+	if t.Symbol != "" {
+		for _, other := range r.entries {
+			if strings.EqualFold(other.token.Symbol, t.Symbol) {
+				r.mu.Unlock()
+				return fmt.Errorf("%w: symbol %s", ErrExists, t.Symbol)
+			}
+		}
+	}
+	r.entries[t.Address] = e
+	r.order = append(r.order, t.Address)
+	listeners := append([]func(Token){}, r.onAdd...)
+	r.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(t)
+	}
+	return nil
+}
+
+// Remove unregisters a token added through the admin API.
+func (r *Registry) Remove(id string) error {
+	t, _, err := r.Resolve(id)
+	if err != nil {
+		return err
+	}
+	if t.Configured {
+		return ErrConfigured
+	}
+
+	r.mu.Lock()
+	delete(r.entries, t.Address)
+	for i, addr := range r.order {
+		if addr == t.Address {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	listeners := append([]func(Token){}, r.onRemove...)
+	r.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(*t)
+	}
+	return r.store.Delete(storedKey(t.Address))
+}
+
+// Default returns the first registered token.
+func (r *Registry) Default() (*Token, *contract.MyContract, error) {
+	r.mu.Lock()
+	if len(r.order) == 0 {
+		r.mu.Unlock()
+		return nil, nil, ErrUnknownToken
+	}
+	addr := r.order[0]
+	r.mu.Unlock()
+	return r.Resolve(addr.Hex())
+}
+
+// Resolve finds a token by address or case-insensitive symbol; an empty id means the default token.
+func (r *Registry) Resolve(id string) (*Token, *contract.MyContract, error) {
+	if id == "" {
+		return r.Default()
+	}
+
+	r.mu.Lock()
+	var found *entry
+	if common.IsHexAddress(id) {
+		found = r.entries[common.HexToAddress(id)]
+	} else {
+		for _, e := range r.entries {
+			if strings.EqualFold(e.token.Symbol, id) {
+				found = e
+				break
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	// Symbols of configured tokens may only be known once their metadata is loaded.
+	if found == nil && !common.IsHexAddress(id) {
+		for _, t := range r.List() {
+			if strings.EqualFold(t.Symbol, id) {
+				return r.Resolve(t.Address.Hex())
+			}
+		}
+	}
+	if found == nil {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownToken, id)
+	}
+
+	t, instance, err := r.load(found)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &t, instance, nil
+}
+
+// List returns every registered token, loading metadata where possible.
+func (r *Registry) List() []Token {
+	r.mu.Lock()
+	entries := make([]*entry, 0, len(r.order))
+	for _, addr := range r.order {
+		entries = append(entries, r.entries[addr])
+	}
+	r.mu.Unlock()
+
+	tokens := make([]Token, 0, len(entries))
+	for _, e := range entries {
+		// Metadata stays empty for tokens whose node calls fail.
+		t, _, err := r.load(e)
+		if err != nil {
+			r.mu.Lock()
+			t = e.token
+			r.mu.Unlock()
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// load binds e if needed and returns a copy of its token and the bound contract.
+func (r *Registry) load(e *entry) (Token, *contract.MyContract, error) {
+	r.mu.Lock()
+	if e.instance != nil {
+		defer r.mu.Unlock()
+		return e.token, e.instance, nil
+	}
+	t := e.token
+	r.mu.Unlock()
+
+	bound, err := r.bind(t)
+	if err != nil {
+		return Token{}, nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.token, e.instance = bound.token, bound.instance
+	return e.token, e.instance, nil
+}
+
+// bind binds the contract and fetches its metadata. A symbol given at registration is kept.
+func (r *Registry) bind(t Token) (*entry, error) {
+	instance, err := contract.NewMyContract(t.Address, r.backend)
+	if err != nil {
+		return nil, err
+	}
+	if t.Name, err = instance.Name(nil); err != nil {
+		return nil, fmt.Errorf("token %s: name: %w", t.Address.Hex(), err)
+	}
+	if t.Decimals, err = instance.Decimals(nil); err != nil {
+		return nil, fmt.Errorf("token %s: decimals: %w", t.Address.Hex(), err)
+	}
+	if t.Symbol == "" {
+		if t.Symbol, err = instance.Symbol(nil); err != nil {
+			return nil, fmt.Errorf("token %s: symbol: %w", t.Address.Hex(), err)
+		}
+	}
+	return &entry{token: t, instance: instance}, nil
+}
@@ -0,0 +1,74 @@
+package units
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// FormatAmount renders a raw token amount as a decimal string using the token decimals.
+// Trailing zeros of the fractional part are trimmed, e.g. 1500000000000000000 with 18 decimals is "1.5".
+func FormatAmount(value *big.Int, decimals uint8) string {
+	if value == nil {
+		return "0"
+	}
+	if decimals == 0 {
+		return value.String()
+	}
+
+	abs := new(big.Int).Abs(value)
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(abs, unit, new(big.Int))
+
+	result := whole.String()
+	if frac.Sign() != 0 {
+		fracStr := frac.String()
+		fracStr = strings.Repeat("0", int(decimals)-len(fracStr)) + fracStr
+		result += "." + strings.TrimRight(fracStr, "0")
+	}
+	if value.Sign() < 0 {
+		result = "-" + result
+	}
+	return result
+}
+
+// ParseAmount converts a decimal string such as "1.5" into raw token units.
+func ParseAmount(s string, decimals uint8) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, ErrInvalidAmount
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if len(frac) > int(decimals) {
+		return nil, ErrInvalidAmount
+	}
+	frac += strings.Repeat("0", int(decimals)-len(frac))
+
+	digits := whole + frac
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, ErrInvalidAmount
+		}
+	}
+
+	amount, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, ErrInvalidAmount
+	}
+	if negative {
+		amount.Neg(amount)
+	}
+	return amount, nil
+}
@@ -0,0 +1,457 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/stream"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	EventHeader     = "X-Webhook-Event"
+)
+
+// Attempt is one delivery try, kept as the delivery log.
+type Attempt struct {
+	At         time.Time     `json:"at"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Delivery is an event queued for one subscription.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Tries          int             `json:"tries"` // attempts since created or last replayed
+	NextAttempt    time.Time       `json:"next_attempt"`
+	Attempts       []Attempt       `json:"attempts"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type payload struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Dispatcher turns stream events into signed webhook deliveries and retries failed ones
+// with exponential backoff. Deliveries that exhaust MaxAttempts are moved to the dead-letter set.
+type Dispatcher struct {
+	store  *store.Store
+	hub    *stream.Hub
+	client *http.Client
+
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	Concurrency  int
+}
+
+func NewDispatcher(db *store.Store, hub *stream.Hub, client *http.Client) *Dispatcher {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Dispatcher{
+		store:        db,
+		hub:          hub,
+		client:       client,
+		MaxAttempts:  8,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   time.Hour,
+		PollInterval: time.Second,
+		Concurrency:  4,
+	}
+}
+
+// Store layout:
+//
+//	w/s/<id>                      -> Subscription
+//	w/d/<id>                      -> Delivery
+//	w/p/<next attempt><id>        -> pending queue ordered by due time
+//	w/x/<id>                      -> dead letters
+//	w/l/<subscription>/<id>       -> deliveries per subscription
+//	w/m/<kind>                    -> last consumed stream event ID
+func deliveryKey(id string) []byte {
+	return []byte("w/d/" + id)
+}
+
+func pendingKey(due time.Time, id string) []byte {
+	key := make([]byte, 4+8, 4+8+len(id))
+	copy(key, "w/p/")
+	binary.BigEndian.PutUint64(key[4:], uint64(due.UnixNano()))
+	return append(key, id...)
+}
+
+func deadKey(id string) []byte {
+	return []byte("w/x/" + id)
+}
+
+func logKey(subID, id string) []byte {
+	return []byte("w/l/" + subID + "/" + id)
+}
+
+func cursorKey(kind string) []byte {
+	return []byte("w/m/" + kind)
+}
+
+// newDeliveryID returns an ID that sorts by creation time.
+func newDeliveryID(now time.Time) string {
+	return fmt.Sprintf("%016x%s", now.UnixNano(), newID()[:16])
+}
+
+// Sign returns the signature of body sent in the X-Webhook-Signature header:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the subscription secret.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign, for use by receivers.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Run consumes the stream and delivers webhooks until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	go d.consume(ctx, stream.KindTransfer)
+	go d.consume(ctx, stream.KindApproval)
+
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.deliverDue(ctx); err != nil {
+				log.Printf("webhook: %v", err)
+			}
+		}
+	}
+}
+
+// consume enqueues deliveries for every event of kind. The last consumed event ID is
+// persisted so events emitted while the service was down, or while the dispatcher was
+// dropped as a slow consumer, are replayed.
+func (d *Dispatcher) consume(ctx context.Context, kind string) {
+	for ctx.Err() == nil {
+		sub := d.hub.Subscribe(kind, nil)
+		if err := d.consumeSubscription(ctx, kind, sub); err != nil {
+			log.Printf("webhook: consume %s: %v", kind, err)
+		}
+		d.hub.Unsubscribe(sub)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(d.PollInterval):
+		}
+	}
+}
+
+func (d *Dispatcher) consumeSubscription(ctx context.Context, kind string, sub *stream.Subscriber) error {
+	var last *stream.Event
+	var lastID string
+	err := d.store.Get(cursorKey(kind), &lastID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if lastID != "" {
+		block, logIndex, err := stream.ParseEventID(lastID)
+		if err != nil {
+			return err
+		}
+		last = &stream.Event{Block: block, LogIndex: logIndex}
+
+		err = d.hub.Replay(ctx, kind, nil, block, logIndex, func(ev *stream.Event) error {
+			if err := d.enqueue(ev); err != nil {
+				return err
+			}
+			last = ev
+			return nil
+		})
+		if errors.Is(err, stream.ErrReplayTooFar) {
+			// The events in between are not delivered; carry on with the live ones.
+			log.Printf("webhook: %s: %v, resuming from the live events", kind, err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case ev := <-sub.Events:
+			if last != nil && !ev.Removed && !ev.After(last.Block, last.LogIndex) {
+				continue
+			}
+			if err := d.enqueue(ev); err != nil {
+				return err
+			}
+			if !ev.Removed {
+				last = ev
+			}
+		case <-sub.Dropped:
+			return errors.New("dropped as slow consumer, resuming")
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) enqueue(ev *stream.Event) error {
+	subs, err := d.List()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload{ID: ev.ID, Type: ev.Kind, Data: ev.Data})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	batch := new(store.Batch)
+	for _, sub := range subs {
+		if !sub.wants(ev) {
+			continue
+		}
+		delivery := &Delivery{
+			ID:             newDeliveryID(now),
+			SubscriptionID: sub.ID,
+			EventID:        ev.ID,
+			Event:          ev.Kind,
+			Payload:        body,
+			Status:         StatusPending,
+			NextAttempt:    now,
+			Attempts:       []Attempt{},
+			CreatedAt:      now,
+		}
+		if err := batch.Put(deliveryKey(delivery.ID), delivery); err != nil {
+			return err
+		}
+		batch.PutRaw(pendingKey(now, delivery.ID), []byte(delivery.ID))
+		batch.PutRaw(logKey(sub.ID, delivery.ID), nil)
+	}
+	if !ev.Removed {
+		if err := batch.Put(cursorKey(ev.Kind), ev.ID); err != nil {
+			return err
+		}
+	}
+	return d.store.Write(batch)
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context) error {
+	type due struct {
+		key []byte
+		id  string
+	}
+	var queue []due
+	limit := pendingKey(time.Now(), "")
+	err := d.store.Iterate([]byte("w/p/"), nil, limit, false, func(key, value []byte) bool {
+		queue = append(queue, due{key: append([]byte(nil), key...), id: string(value)})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, d.Concurrency)
+	var wg sync.WaitGroup
+	for _, item := range queue {
+		item := item
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := d.attempt(ctx, item.key, item.id); err != nil {
+				log.Printf("webhook: delivery %s: %v", item.id, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, queueKey []byte, id string) error {
+	delivery, err := d.Delivery(id)
+	if err != nil {
+		return err
+	}
+	sub, err := d.Get(delivery.SubscriptionID)
+	if errors.Is(err, ErrNotFound) {
+		// The subscription was deleted, drop what is left in its queue.
+		return d.store.Delete(queueKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	result := d.post(ctx, sub, delivery)
+	delivery.Attempts = append(delivery.Attempts, result)
+	delivery.Tries++
+
+	batch := new(store.Batch)
+	batch.Delete(queueKey)
+	switch {
+	case result.Error == "":
+		delivery.Status = StatusDelivered
+	case delivery.Tries >= d.MaxAttempts:
+		delivery.Status = StatusDead
+		batch.PutRaw(deadKey(delivery.ID), nil)
+	default:
+		delivery.NextAttempt = time.Now().UTC().Add(d.backoff(delivery.Tries))
+		batch.PutRaw(pendingKey(delivery.NextAttempt, delivery.ID), []byte(delivery.ID))
+	}
+	if err := batch.Put(deliveryKey(delivery.ID), delivery); err != nil {
+		return err
+	}
+	return d.store.Write(batch)
+}
+
+func (d *Dispatcher) post(ctx context.Context, sub *Subscription, delivery *Delivery) Attempt {
+	start := time.Now()
+	result := Attempt{At: start.UTC()}
+
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, timestamp, delivery.Payload))
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(EventHeader, delivery.Event)
+
+	resp, err := d.client.Do(req)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Error = fmt.Sprintf("receiver responded %s", resp.Status)
+	}
+	return result
+}
+
+func (d *Dispatcher) backoff(tries int) time.Duration {
+	delay := d.BaseBackoff
+	for i := 1; i < tries && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
+
+func (d *Dispatcher) Delivery(id string) (*Delivery, error) {
+	delivery := new(Delivery)
+	err := d.store.Get(deliveryKey(id), delivery)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// Deliveries returns the most recent deliveries of a subscription, newest first.
+func (d *Dispatcher) Deliveries(subID string, limit int) ([]*Delivery, error) {
+	var ids []string
+	prefix := []byte("w/l/" + subID + "/")
+	err := d.store.Iterate(prefix, nil, nil, true, func(key, value []byte) bool {
+		ids = append(ids, string(key[len(prefix):]))
+		return len(ids) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.load(ids)
+}
+
+// DeadLetters returns deliveries that exhausted their retries.
+func (d *Dispatcher) DeadLetters() ([]*Delivery, error) {
+	var ids []string
+	prefix := []byte("w/x/")
+	err := d.store.Iterate(prefix, nil, nil, false, func(key, value []byte) bool {
+		ids = append(ids, string(key[len(prefix):]))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.load(ids)
+}
+
+func (d *Dispatcher) load(ids []string) ([]*Delivery, error) {
+	deliveries := make([]*Delivery, 0, len(ids))
+	for _, id := range ids {
+		delivery, err := d.Delivery(id)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// Replay queues a delivery again, whether it was delivered or dead-lettered.
+func (d *Dispatcher) Replay(id string) (*Delivery, error) {
+	delivery, err := d.Delivery(id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status == StatusPending {
+		return delivery, nil
+	}
+
+	now := time.Now().UTC()
+	delivery.Status = StatusPending
+	delivery.Tries = 0
+	delivery.NextAttempt = now
+
+	batch := new(store.Batch)
+	batch.Delete(deadKey(delivery.ID))
+	batch.PutRaw(pendingKey(now, delivery.ID), []byte(delivery.ID))
+	if err := batch.Put(deliveryKey(delivery.ID), delivery); err != nil {
+		return nil, err
+	}
+	return delivery, d.store.Write(batch)
+}
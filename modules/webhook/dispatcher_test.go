@@ -0,0 +1,207 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/stream"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook endpoint that checks signatures and answers with status.
+type receiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	status   int
+	received int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rc.t.Errorf("read body: %v", err)
+	}
+	if !Verify(rc.secret, r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader)) {
+		rc.t.Errorf("delivery %s has a bad signature", r.Header.Get(DeliveryHeader))
+	}
+	if got := r.Header.Get(EventHeader); got != stream.KindTransfer {
+		rc.t.Errorf("event header = %q, want %q", got, stream.KindTransfer)
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.received++
+	w.WriteHeader(rc.status)
+}
+
+func (rc *receiver) respond(status int) {
+	rc.mu.Lock()
+	rc.status = status
+	rc.mu.Unlock()
+}
+
+func newTestDispatcher(t *testing.T, status int) (*Dispatcher, *receiver) {
+	t.Helper()
+	db, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	rc := &receiver{t: t, secret: "s3cret", status: status}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	d := NewDispatcher(db, nil, srv.Client())
+	d.BaseBackoff = time.Millisecond
+	d.MaxBackoff = time.Millisecond
+	if err := d.Create(&Subscription{URL: srv.URL, Events: []string{stream.KindTransfer}, Secret: rc.secret}); err != nil {
+		t.Fatal(err)
+	}
+	return d, rc
+}
+
+// enqueueOne queues a delivery for a transfer event and returns it.
+func enqueueOne(t *testing.T, d *Dispatcher) *Delivery {
+	t.Helper()
+	ev := &stream.Event{ID: "7:1", Kind: stream.KindTransfer, Block: 7, LogIndex: 1, Data: map[string]string{"value": "1"}}
+	if err := d.enqueue(ev); err != nil {
+		t.Fatal(err)
+	}
+	var cursor string
+	if err := d.store.Get(cursorKey(stream.KindTransfer), &cursor); err != nil || cursor != ev.ID {
+		t.Fatalf("cursor = %q, %v; want %q", cursor, err, ev.ID)
+	}
+	subs, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := d.Deliveries(subs[0].ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	return deliveries[0]
+}
+
+// deliver runs one delivery round once the backoff has passed and returns the delivery.
+func deliver(t *testing.T, d *Dispatcher, id string) *Delivery {
+	t.Helper()
+	time.Sleep(2 * time.Millisecond)
+	if err := d.deliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	delivery, err := d.Delivery(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"id":"1:0"}`)
+	sig := Sign("secret", "1700000000", body)
+	if !Verify("secret", "1700000000", body, sig) {
+		t.Fatal("signature does not verify")
+	}
+	if len(sig) != len("sha256=")+64 || sig[:7] != "sha256=" {
+		t.Errorf("signature %q is not sha256=<hex>", sig)
+	}
+	for name, ok := range map[string]bool{
+		"secret":    Verify("other", "1700000000", body, sig),
+		"timestamp": Verify("secret", "1700000001", body, sig),
+		"body":      Verify("secret", "1700000000", []byte(`{"id":"1:1"}`), sig),
+	} {
+		if ok {
+			t.Errorf("signature verifies with a different %s", name)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	d, rc := newTestDispatcher(t, http.StatusOK)
+	delivery := deliver(t, d, enqueueOne(t, d).ID)
+	if delivery.Status != StatusDelivered || delivery.Tries != 1 || len(delivery.Attempts) != 1 {
+		t.Fatalf("delivery = %s after %d tries, %d attempts; want delivered after 1", delivery.Status, delivery.Tries, len(delivery.Attempts))
+	}
+	if code := delivery.Attempts[0].StatusCode; code != http.StatusOK {
+		t.Errorf("attempt status code = %d", code)
+	}
+	// nothing is left in the queue
+	deliver(t, d, delivery.ID)
+	if rc.received != 1 {
+		t.Errorf("receiver got %d requests, want 1", rc.received)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for tries, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 20: 5 * time.Second} {
+		if got := d.backoff(tries); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", tries, got, want)
+		}
+	}
+}
+
+func TestRetryDeadLetterReplay(t *testing.T) {
+	d, rc := newTestDispatcher(t, http.StatusInternalServerError)
+	d.MaxAttempts = 3
+	id := enqueueOne(t, d).ID
+
+	for try := 1; try < d.MaxAttempts; try++ {
+		delivery := deliver(t, d, id)
+		if delivery.Status != StatusPending || delivery.Tries != try {
+			t.Fatalf("try %d: delivery = %s after %d tries, want pending", try, delivery.Status, delivery.Tries)
+		}
+		if delivery.Attempts[try-1].Error == "" {
+			t.Fatalf("try %d: failed attempt has no error", try)
+		}
+	}
+	delivery := deliver(t, d, id)
+	if delivery.Status != StatusDead {
+		t.Fatalf("delivery = %s after %d tries, want dead", delivery.Status, delivery.Tries)
+	}
+	dead, err := d.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != id {
+		t.Fatalf("dead letters = %v, want %s", dead, id)
+	}
+	// dead letters are not retried
+	deliver(t, d, id)
+	if rc.received != d.MaxAttempts {
+		t.Fatalf("receiver got %d requests, want %d", rc.received, d.MaxAttempts)
+	}
+
+	rc.respond(http.StatusNoContent)
+	replayed, err := d.Replay(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Status != StatusPending || replayed.Tries != 0 {
+		t.Fatalf("replayed delivery = %s after %d tries, want pending after 0", replayed.Status, replayed.Tries)
+	}
+	if dead, _ := d.DeadLetters(); len(dead) != 0 {
+		t.Fatalf("replayed delivery is still a dead letter")
+	}
+	delivery = deliver(t, d, id)
+	if delivery.Status != StatusDelivered || len(delivery.Attempts) != d.MaxAttempts+1 {
+		t.Fatalf("delivery = %s with %d attempts, want delivered with %d", delivery.Status, len(delivery.Attempts), d.MaxAttempts+1)
+	}
+}
+
+func TestReplayUnknown(t *testing.T) {
+	d, _ := newTestDispatcher(t, http.StatusOK)
+	if _, err := d.Replay("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Replay(missing) = %v, want ErrNotFound", err)
+	}
+}
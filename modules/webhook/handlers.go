@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/api"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/router"
+	"net/http"
+	"time"
+)
+
+type createRequest struct {
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Addresses []string `json:"addresses"`
+	Secret    string   `json:"secret"`
+}
+
+type subscriptionResponse struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Addresses []string  `json:"addresses"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toResponse(sub *Subscription, withSecret bool) subscriptionResponse {
+	resp := subscriptionResponse{
+		ID:        sub.ID,
+		URL:       sub.URL,
+		Events:    sub.Events,
+		Addresses: make([]string, 0, len(sub.Addresses)),
+		CreatedAt: sub.CreatedAt,
+	}
+	for _, addr := range sub.Addresses {
+		resp.Addresses = append(resp.Addresses, addr.Hex())
+	}
+	if withSecret {
+		resp.Secret = sub.Secret
+	}
+	return resp
+}
+
+// CreateHandler serves POST /webhooks, which registers a subscription; the secret is only
+// returned here.
+func (d *Dispatcher) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sub := &Subscription{URL: req.URL, Events: req.Events, Secret: req.Secret}
+	for _, s := range req.Addresses {
+		addr, err := api.HexAddress("addresses", s)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		sub.Addresses = append(sub.Addresses, addr)
+	}
+
+	err := d.Create(sub)
+	if errors.Is(err, ErrInvalidURL) || errors.Is(err, ErrInvalidEvent) {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, toResponse(sub, true))
+}
+
+// ListHandler serves GET /webhooks.
+func (d *Dispatcher) ListHandler(w http.ResponseWriter, r *http.Request) {
+	subs, err := d.List()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := make([]subscriptionResponse, 0, len(subs))
+	for _, sub := range subs {
+		resp = append(resp, toResponse(sub, false))
+	}
+	api.WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetHandler serves GET /webhooks/{id}.
+func (d *Dispatcher) GetHandler(w http.ResponseWriter, r *http.Request) {
+	sub, err := d.Get(router.Param(r, "id"))
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, toResponse(sub, false))
+}
+
+// DeleteHandler serves DELETE /webhooks/{id}.
+func (d *Dispatcher) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if err := d.Delete(router.Param(r, "id")); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeliveriesHandler serves GET /webhooks/{id}/deliveries, the delivery log of a subscription.
+func (d *Dispatcher) DeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	if _, err := d.Get(id); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	limit, err := api.ParseInt(r.URL.Query(), "limit", 100)
+	if err == nil && limit == 0 {
+		err = api.Invalid("limit", r.URL.Query().Get("limit"), api.ReasonZero)
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	deliveries, err := d.Deliveries(id, limit)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, deliveries)
+}
+
+// DeadLettersHandler serves GET /webhooks/dead-letters, deliveries that exhausted their retries.
+func (d *Dispatcher) DeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := d.DeadLetters()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, deliveries)
+}
+
+// ReplayHandler serves POST /webhooks/deliveries/{id}/replay, which queues a delivery again.
+func (d *Dispatcher) ReplayHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, err := d.Replay(router.Param(r, "id"))
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusAccepted, delivery)
+}
+
+func writeLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		api.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	api.WriteError(w, http.StatusInternalServerError, err)
+}
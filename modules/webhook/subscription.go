@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/store"
+	"github.com/SeogyuGim/eth-testnet-smartcontract/modules/stream"
+	"github.com/ethereum/go-ethereum/common"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("webhook not found")
+	ErrInvalidURL   = errors.New("webhook url must be an absolute http(s) url")
+	ErrInvalidEvent = errors.New("event must be \"transfer\" or \"approval\"")
+)
+
+// Subscription registers a URL to be notified of events touching any of Addresses
+// (all events when empty). Payloads are signed with Secret.
+type Subscription struct {
+	ID        string           `json:"id"`
+	URL       string           `json:"url"`
+	Events    []string         `json:"events"`
+	Addresses []common.Address `json:"addresses"`
+	Secret    string           `json:"secret"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+func (s *Subscription) wants(ev *stream.Event) bool {
+	kindOK := false
+	for _, kind := range s.Events {
+		if kind == ev.Kind {
+			kindOK = true
+			break
+		}
+	}
+	if !kindOK {
+		return false
+	}
+	if len(s.Addresses) == 0 {
+		return true
+	}
+	for _, want := range s.Addresses {
+		for _, addr := range ev.Addresses() {
+			if want == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Subscription) validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if len(s.Events) == 0 {
+		return ErrInvalidEvent
+	}
+	for _, kind := range s.Events {
+		if kind != stream.KindTransfer && kind != stream.KindApproval {
+			return ErrInvalidEvent
+		}
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func subscriptionKey(id string) []byte {
+	return []byte("w/s/" + id)
+}
+
+// Create validates and stores a new subscription, generating a secret if none is given.
+func (d *Dispatcher) Create(sub *Subscription) error {
+	if err := sub.validate(); err != nil {
+		return err
+	}
+	sub.ID = newID()
+	if sub.Secret == "" {
+		sub.Secret = newID()
+	}
+	sub.CreatedAt = time.Now().UTC()
+	return d.store.Put(subscriptionKey(sub.ID), sub)
+}
+
+func (d *Dispatcher) Get(id string) (*Subscription, error) {
+	sub := new(Subscription)
+	err := d.store.Get(subscriptionKey(id), sub)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (d *Dispatcher) List() ([]*Subscription, error) {
+	subs := []*Subscription{}
+	var decodeErr error
+	err := d.store.Iterate([]byte("w/s/"), nil, nil, false, func(key, value []byte) bool {
+		sub := new(Subscription)
+		if decodeErr = json.Unmarshal(value, sub); decodeErr != nil {
+			return false
+		}
+		subs = append(subs, sub)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subs, decodeErr
+}
+
+func (d *Dispatcher) Delete(id string) error {
+	if _, err := d.Get(id); err != nil {
+		return err
+	}
+	return d.store.Delete(subscriptionKey(id))
+}